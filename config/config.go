@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
 
 	"focalors-go/slogger"
@@ -15,13 +18,17 @@ var logger = slogger.New("config")
 
 // Config holds all configuration for the application
 type Config struct {
-	App     AppConfig     `mapstructure:"app"`
-	Yunzai  YunzaiConfig  `mapstructure:"yunzai"`
-	Wechat  WechatConfig  `mapstructure:"wechat"`
-	Lark    LarkConfig    `mapstructure:"lark"`
-	Jiadan  JiadanConfig  `mapstructure:"jiadan"`
-	OpenAI  OpenAIConfig  `mapstructure:"openai"`
-	Weather WeatherConfig `mapstructure:"weather"`
+	App      AppConfig         `mapstructure:"app"`
+	Yunzai   YunzaiConfig      `mapstructure:"yunzai"`
+	Wechat   WechatConfig      `mapstructure:"wechat"`
+	Lark     LarkConfig        `mapstructure:"lark"`
+	Telegram TelegramConfig    `mapstructure:"telegram"`
+	OneBot   OneBotConfig      `mapstructure:"onebot"`
+	Console  ConsoleConfig     `mapstructure:"console"`
+	Jiadan   JiadanConfig      `mapstructure:"jiadan"`
+	OpenAI   OpenAIConfig      `mapstructure:"openai"`
+	MCP      []MCPServerConfig `mapstructure:"mcp"`
+	Weather  WeatherConfig     `mapstructure:"weather"`
 }
 
 // AppConfig holds application-specific configuration
@@ -31,7 +38,33 @@ type AppConfig struct {
 	Admin    []string    `mapstructure:"admin"`
 	SyncCron string      `mapstructure:"syncCron"`
 	Redis    RedisConfig `mapstructure:"redis"`
-	Platform string      `mapstructure:"platform"` // "wechat" or "lark"
+	Storage  Storage     `mapstructure:"storage"`  // "redis", "bolt" or "memory"
+	BoltPath string      `mapstructure:"boltPath"` // database file of the bolt storage
+	Platform string      `mapstructure:"platform"` // "wechat", "lark", "telegram", "onebot" or "console"
+	// Platforms lists the platform instances served by one process. When set, Platform is ignored
+	// and all ids are qualified with the instance name, e.g. "lark:oc_xxx".
+	Platforms []PlatformConfig `mapstructure:"platforms"`
+}
+
+// Storage selects the key-value backend all stores use
+type Storage string
+
+const (
+	StorageRedis  Storage = "redis"
+	StorageBolt   Storage = "bolt"   // embedded file, no external service needed
+	StorageMemory Storage = "memory" // nothing survives a restart
+)
+
+// PlatformConfig describes one platform instance. Its platform settings default to
+// the top level section of the same type, e.g. [lark], and can be overridden per instance.
+type PlatformConfig struct {
+	Name     string         `mapstructure:"name"` // qualifier used in ids, defaults to Type
+	Type     string         `mapstructure:"type"` // "wechat", "lark", "telegram", "onebot" or "console"
+	Wechat   WechatConfig   `mapstructure:"wechat"`
+	Lark     LarkConfig     `mapstructure:"lark"`
+	Telegram TelegramConfig `mapstructure:"telegram"`
+	OneBot   OneBotConfig   `mapstructure:"onebot"`
+	Console  ConsoleConfig  `mapstructure:"console"`
 }
 
 type RedisConfig struct {
@@ -41,7 +74,47 @@ type RedisConfig struct {
 }
 
 type YunzaiConfig struct {
-	Server string `mapstructure:"server"`
+	Server   string                `mapstructure:"server"`   // the only backend when backends is empty
+	Backends []YunzaiBackendConfig `mapstructure:"backends"` // gsuid backends, a command goes to the first that accepts it
+}
+
+// YunzaiBackendConfig is a Yunzai/gsuid backend and the commands it takes
+type YunzaiBackendConfig struct {
+	Name     string   `mapstructure:"name"`
+	Server   string   `mapstructure:"server"`
+	Prefixes []string `mapstructure:"prefixes"` // command prefixes, e.g. "*" or "#星铁"
+	Regex    string   `mapstructure:"regex"`    // commands matching it, in addition to the prefixes
+	Groups   []string `mapstructure:"groups"`   // groups the backend is enabled in, empty for all
+	Private  bool     `mapstructure:"private"`  // with groups, also take private chats
+}
+
+// YunzaiDefaultRegex matches the commands of a backend without prefixes and regex
+const YunzaiDefaultRegex = `^[#*%]`
+
+// BackendList returns the configured backends, or a single one for server
+func (c *YunzaiConfig) BackendList() []YunzaiBackendConfig {
+	if len(c.Backends) > 0 {
+		return c.Backends
+	}
+	if c.Server == "" {
+		return nil
+	}
+	return []YunzaiBackendConfig{{Name: "yunzai", Server: c.Server}}
+}
+
+// Pattern returns the regex of the commands the backend takes
+func (c *YunzaiBackendConfig) Pattern() string {
+	var alternatives []string
+	for _, prefix := range c.Prefixes {
+		alternatives = append(alternatives, "^"+regexp.QuoteMeta(prefix))
+	}
+	if c.Regex != "" {
+		alternatives = append(alternatives, "(?:"+c.Regex+")")
+	}
+	if len(alternatives) == 0 {
+		return YunzaiDefaultRegex
+	}
+	return strings.Join(alternatives, "|")
 }
 
 type PushType string
@@ -60,11 +133,82 @@ type WechatConfig struct {
 	PushType      PushType `mapstructure:"pushType"`
 }
 
+// OpenAIProvider selects the flavor of the chat completions API
+type OpenAIProvider string
+
+const (
+	OpenAIProviderAzure      OpenAIProvider = "azure"      // Azure OpenAI: endpoint, deployment and apiVersion
+	OpenAIProviderOpenAI     OpenAIProvider = "openai"     // api.openai.com, or baseURL if set
+	OpenAIProviderCompatible OpenAIProvider = "compatible" // any server speaking the OpenAI API, e.g. DeepSeek, Ollama, llama.cpp
+)
+
 type OpenAIConfig struct {
-	APIKey     string `mapstructure:"apiKey"`
-	Endpoint   string `mapstructure:"endpoint"`
-	APIVersion string `mapstructure:"apiVersion"`
-	Deployment string `mapstructure:"deployment"`
+	Provider   OpenAIProvider `mapstructure:"provider"`
+	APIKey     string         `mapstructure:"apiKey"`
+	Endpoint   string         `mapstructure:"endpoint"`   // azure only
+	APIVersion string         `mapstructure:"apiVersion"` // azure only
+	Deployment string         `mapstructure:"deployment"` // azure only
+	BaseURL    string         `mapstructure:"baseURL"`    // openai and compatible, e.g. http://localhost:11434/v1
+	Model      string         `mapstructure:"model"`      // openai and compatible, defaults to deployment
+	// extra HTTP headers sent with every request, names are case-insensitive
+	Headers map[string]string `mapstructure:"headers"`
+	// default system prompt, a text/template with the variables of service.PromptVars
+	SystemPrompt string `mapstructure:"systemPrompt"`
+	// conversation memory, kept per private chat and per user in groups
+	MemoryTurns  int           `mapstructure:"memoryTurns"`  // question/answer pairs to keep
+	MemoryTokens int           `mapstructure:"memoryTokens"` // estimated token budget of the kept turns
+	MemoryTTL    time.Duration `mapstructure:"memoryTTL"`    // forget a conversation after this idle time
+	// group chat history for #总结, only recorded in groups with the gpt access
+	HistorySize int           `mapstructure:"historySize"` // messages kept per group, 0 disables recording
+	HistoryTTL  time.Duration `mapstructure:"historyTTL"`  // forget the history after this idle time
+	// images shown to the model, disable for models without vision
+	Vision        bool `mapstructure:"vision"`
+	VisionMaxSize int  `mapstructure:"visionMaxSize"` // images larger than this many bytes are skipped
+	VisionMaxSide int  `mapstructure:"visionMaxSide"` // images are downscaled to this longer side
+	// answer every image sent in a private chat, otherwise only images asked about
+	VisionPrivate bool `mapstructure:"visionPrivate"`
+	// token limits per target (user/group), 0 for unlimited
+	DailyTokenLimit   int64 `mapstructure:"dailyTokenLimit"`
+	MonthlyTokenLimit int64 `mapstructure:"monthlyTokenLimit"`
+	// image generation tool, enabled when imageModel is set
+	ImageModel      string `mapstructure:"imageModel"`      // e.g. dall-e-3 or gpt-image-1, the deployment on Azure
+	ImageDailyQuota int    `mapstructure:"imageDailyQuota"` // images per target and day, 0 for unlimited
+	// tool calling loop
+	MaxToolRounds  int           `mapstructure:"maxToolRounds"`  // completions with tool calls before a final answer is forced
+	RequestTimeout time.Duration `mapstructure:"requestTimeout"` // deadline of a whole question, tool calls included
+}
+
+// Enabled reports whether the settings required by the provider are present
+func (c *OpenAIConfig) Enabled() bool {
+	switch c.Provider {
+	case OpenAIProviderOpenAI:
+		return c.APIKey != ""
+	case OpenAIProviderCompatible:
+		// local servers usually need no key
+		return c.BaseURL != ""
+	default:
+		return c.APIKey != "" && c.Endpoint != ""
+	}
+}
+
+// ModelName is the model sent in requests, for Azure the deployment
+func (c *OpenAIConfig) ModelName() string {
+	if c.Model != "" {
+		return c.Model
+	}
+	return c.Deployment
+}
+
+// MCPServerConfig is a Model Context Protocol server whose tools are offered to GPT,
+// either a command speaking over stdio or a streamable HTTP endpoint
+type MCPServerConfig struct {
+	Name    string            `mapstructure:"name"` // prefix of the tool names
+	Command string            `mapstructure:"command"`
+	Args    []string          `mapstructure:"args"`
+	Env     []string          `mapstructure:"env"` // KEY=value pairs added to the environment of the command
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"` // HTTP headers, names are case-insensitive
+	Access  string            `mapstructure:"access"`  // access required to use the tools, e.g. "draw", empty for none
 }
 
 type WeatherConfig struct {
@@ -81,6 +225,36 @@ type LarkConfig struct {
 	VerificationToken string `mapstructure:"verificationToken"`
 }
 
+type TelegramUpdateMode string
+
+const (
+	TelegramUpdatePolling TelegramUpdateMode = "polling"
+	TelegramUpdateWebhook TelegramUpdateMode = "webhook"
+)
+
+type TelegramConfig struct {
+	Token         string             `mapstructure:"token"`
+	ApiServer     string             `mapstructure:"apiServer"`
+	UpdateMode    TelegramUpdateMode `mapstructure:"updateMode"`
+	WebhookURL    string             `mapstructure:"webhookURL"`
+	WebhookListen string             `mapstructure:"webhookListen"`
+	WebhookSecret string             `mapstructure:"webhookSecret"`
+}
+
+// OneBotConfig configures the OneBot v11 reverse WebSocket server that NapCat, Lagrange, etc. connect to
+type OneBotConfig struct {
+	Listen      string `mapstructure:"listen"`
+	Path        string `mapstructure:"path"`
+	AccessToken string `mapstructure:"accessToken"`
+}
+
+// ConsoleConfig configures the stdin/stdout provider used for local development
+type ConsoleConfig struct {
+	UserId   string `mapstructure:"userId"`   // user impersonated at startup
+	GroupId  string `mapstructure:"groupId"`  // group impersonated at startup, empty for a private chat
+	ImageDir string `mapstructure:"imageDir"` // where sent images are written, defaults to a temp dir
+}
+
 // LoadConfig loads the configuration from the specified file
 func LoadConfig(configPath string) (*Config, error) {
 	v := viper.New()
@@ -134,9 +308,89 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("jiadan max sync count must be greater than 0")
 	}
 
+	switch config.OpenAI.Provider {
+	case OpenAIProviderAzure, OpenAIProviderOpenAI, OpenAIProviderCompatible:
+	default:
+		return nil, fmt.Errorf("unsupported openai provider: %s", config.OpenAI.Provider)
+	}
+	if config.OpenAI.Enabled() && config.OpenAI.ModelName() == "" {
+		return nil, fmt.Errorf("openai %s provider: model (deployment on Azure) is required", config.OpenAI.Provider)
+	}
+
+	mcpNames := make(map[string]bool, len(config.MCP))
+	for i, server := range config.MCP {
+		if server.Name == "" {
+			return nil, fmt.Errorf("mcp server #%d: name is required", i)
+		}
+		if mcpNames[server.Name] {
+			return nil, fmt.Errorf("mcp server %s: duplicated name", server.Name)
+		}
+		mcpNames[server.Name] = true
+		if (server.Command == "") == (server.URL == "") {
+			return nil, fmt.Errorf("mcp server %s: either command or url is required", server.Name)
+		}
+	}
+
+	yunzaiNames := make(map[string]bool, len(config.Yunzai.Backends))
+	for i, backend := range config.Yunzai.Backends {
+		if backend.Name == "" {
+			return nil, fmt.Errorf("yunzai backend #%d: name is required", i)
+		}
+		if yunzaiNames[backend.Name] {
+			return nil, fmt.Errorf("yunzai backend %s: duplicated name", backend.Name)
+		}
+		yunzaiNames[backend.Name] = true
+		if backend.Server == "" {
+			return nil, fmt.Errorf("yunzai backend %s: server is required", backend.Name)
+		}
+		if _, err := regexp.Compile(backend.Pattern()); err != nil {
+			return nil, fmt.Errorf("yunzai backend %s: invalid regex: %w", backend.Name, err)
+		}
+	}
+
+	if err := resolvePlatforms(v, &config); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
+// resolvePlatforms fills every platform instance with the top level settings of its type,
+// then applies the overrides given in the instance itself.
+func resolvePlatforms(v *viper.Viper, config *Config) error {
+	raw, _ := v.Get("app.platforms").([]any)
+	names := make(map[string]bool, len(config.App.Platforms))
+	for i := range config.App.Platforms {
+		p := &config.App.Platforms[i]
+		if p.Type == "" {
+			return fmt.Errorf("platform #%d: type is required", i)
+		}
+		if p.Name == "" {
+			p.Name = p.Type
+		}
+		if strings.Contains(p.Name, ":") {
+			return fmt.Errorf("platform %s: name must not contain ':'", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("platform %s: duplicated name", p.Name)
+		}
+		names[p.Name] = true
+
+		p.Wechat = config.Wechat
+		p.Lark = config.Lark
+		p.Telegram = config.Telegram
+		p.OneBot = config.OneBot
+		p.Console = config.Console
+		if i < len(raw) {
+			// decoding onto the copied sections keeps every field the instance does not set
+			if err := mapstructure.Decode(raw[i], p); err != nil {
+				return fmt.Errorf("platform %s: %w", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
 // setDefaults sets default values for configuration
 func setDefaults(v *viper.Viper) {
 	// App defaults
@@ -145,6 +399,10 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("app.admin", "")
 	v.SetDefault("app.syncCron", "*/60 8-23 * * *")
 
+	// Storage defaults
+	v.SetDefault("app.storage", StorageRedis)
+	v.SetDefault("app.boltPath", "./data/focalors.db")
+
 	// Redis defaults
 	v.SetDefault("app.redis.addr", "localhost:6379")
 	v.SetDefault("app.redis.password", "")
@@ -161,11 +419,36 @@ func setDefaults(v *viper.Viper) {
 	// Jiadan defaults
 	v.SetDefault("jiadan.maxSyncCount", 4)
 
+	v.SetDefault("openai.provider", "azure")
 	v.SetDefault("openai.apiVersion", "2025-03-01-preview")
+	v.SetDefault("openai.systemPrompt", "你是一个友好的聊天助手，请用用户使用的语言简洁地回答。今天是{{.Date}} {{.Weekday}}。")
+	v.SetDefault("openai.memoryTurns", 10)
+	v.SetDefault("openai.memoryTokens", 2000)
+	v.SetDefault("openai.memoryTTL", "1h")
+	v.SetDefault("openai.historySize", 500)
+	v.SetDefault("openai.historyTTL", "24h")
+	v.SetDefault("openai.vision", true)
+	v.SetDefault("openai.visionMaxSize", 10<<20)
+	v.SetDefault("openai.visionMaxSide", 1024)
+	v.SetDefault("openai.imageDailyQuota", 10)
+	v.SetDefault("openai.maxToolRounds", 5)
+	v.SetDefault("openai.requestTimeout", "2m")
 
 	v.SetDefault("wechat.webhookHost", "localhost")
 	v.SetDefault("wechat.pushType", PushTypeWebSocket)
 
+	// Telegram defaults
+	v.SetDefault("telegram.apiServer", "https://api.telegram.org")
+	v.SetDefault("telegram.updateMode", TelegramUpdatePolling)
+	v.SetDefault("telegram.webhookListen", ":8443")
+
+	// OneBot defaults
+	v.SetDefault("onebot.listen", ":6700")
+	v.SetDefault("onebot.path", "/onebot/v11/ws")
+
+	// Console defaults
+	v.SetDefault("console.userId", "console_user")
+
 	// App platform default
 	v.SetDefault("app.platform", "wechat")
 }
@@ -32,6 +32,7 @@ const (
 	CardElementImage
 	CardElementDivider
 	CardElementButtons
+	CardElementMention
 )
 
 // Button represents a clickable button
@@ -43,9 +44,11 @@ type Button struct {
 // CardElement represents a single element in a card
 type CardElement struct {
 	Type    CardElementType
-	Content string     // markdown text or image key
-	AltText string     // alt text for images
+	Content string     // markdown text, image key or mentioned user id
+	AltText string     // alt text for images, display name for mentions
 	Buttons [][]Button // 2D array of buttons (rows)
+	Width   int        // image size in pixels, 0 if unknown
+	Height  int
 }
 
 // CardBuilder helps build cards with multiple elements
@@ -74,11 +77,31 @@ func (b *CardBuilder) AddImage(imageKey string, altText string) *CardBuilder {
 	return b
 }
 
+// AddSizedImage adds an image with its size, platforms able to size images use it as display size
+func (b *CardBuilder) AddSizedImage(imageKey string, altText string, width, height int) *CardBuilder {
+	b.Elements = append(b.Elements, CardElement{Type: CardElementImage, Content: imageKey, AltText: altText, Width: width, Height: height})
+	return b
+}
+
 func (b *CardBuilder) AddDivider() *CardBuilder {
 	b.Elements = append(b.Elements, CardElement{Type: CardElementDivider})
 	return b
 }
 
+// AddMention mentions a user, platforms without mentions show "@name" instead
+func (b *CardBuilder) AddMention(userId string, name string) *CardBuilder {
+	b.Elements = append(b.Elements, CardElement{Type: CardElementMention, Content: userId, AltText: name})
+	return b
+}
+
+// MentionName is the text shown for a mention element
+func (e *CardElement) MentionName() string {
+	if e.AltText != "" {
+		return "@" + e.AltText
+	}
+	return "@" + e.Content
+}
+
 // AddButtons adds button rows to the card
 func (b *CardBuilder) AddButtons(buttons [][]Button) *CardBuilder {
 	b.Elements = append(b.Elements, CardElement{Type: CardElementButtons, Buttons: buttons})
@@ -123,3 +146,17 @@ func SendImage(c GenericClient, msg SendTarget, base64Content string) (string, e
 	}
 	return c.SendRichCard(msg, NewCardBuilder().AddImage(imageKey, "image"))
 }
+
+// SelfUserIdResolver is implemented by clients serving several platforms, where the bot id
+// depends on the platform the target belongs to
+type SelfUserIdResolver interface {
+	SelfUserIdFor(target string) string
+}
+
+// GetSelfUserIdFor returns the bot id as seen in the chat of the given target
+func GetSelfUserIdFor(c GenericClient, target string) string {
+	if r, ok := c.(SelfUserIdResolver); ok {
+		return r.SelfUserIdFor(target)
+	}
+	return c.GetSelfUserId()
+}
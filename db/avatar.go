@@ -4,15 +4,9 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
-	"image"
 	"image/png"
 	"strings"
 	"sync"
-
-	_ "image/gif"
-	_ "image/jpeg"
-
-	"golang.org/x/image/draw"
 )
 
 const avatarKeyPrefix = "avatar:u:"
@@ -22,16 +16,16 @@ const avatarScanBatchSize = 50
 // AvatarCallback is invoked when an avatar is saved successfully.
 type AvatarCallback func(userId string, base64Content string)
 
-// AvatarStore manages user avatar storage in Redis with an in-memory cache.
+// AvatarStore manages user avatar storage in the KV store with an in-memory cache.
 type AvatarStore struct {
-	redis     *Redis
+	kv        KV
 	cache     sync.Map
 	watcherMu sync.RWMutex
 	watchers  []AvatarCallback
 }
 
-func NewAvatarStore(redis *Redis) *AvatarStore {
-	return &AvatarStore{redis: redis}
+func NewAvatarStore(kv KV) *AvatarStore {
+	return &AvatarStore{kv: kv}
 }
 
 func avatarKey(userId string) string {
@@ -46,7 +40,7 @@ func (s *AvatarStore) Save(userId string, base64Content string) error {
 		return fmt.Errorf("resize avatar: %w", err)
 	}
 	key := avatarKey(userId)
-	if err := s.redis.Set(key, resized, 0); err != nil {
+	if err := s.kv.Set(key, resized, 0); err != nil {
 		return err
 	}
 	s.cache.Store(key, resized)
@@ -65,21 +59,13 @@ func (s *AvatarStore) Save(userId string, base64Content string) error {
 // resizeAvatar decodes a base64 image, resizes it to avatarSize x avatarSize,
 // and returns the result as a base64-encoded PNG string.
 func resizeAvatar(base64Content string) (string, error) {
-	raw, err := base64.StdEncoding.DecodeString(base64Content)
-	if err != nil {
-		return "", fmt.Errorf("decode base64: %w", err)
-	}
-
-	src, _, err := image.Decode(bytes.NewReader(raw))
+	src, _, err := decodeImage(base64Content)
 	if err != nil {
-		return "", fmt.Errorf("decode image: %w", err)
+		return "", err
 	}
 
-	dst := image.NewRGBA(image.Rect(0, 0, avatarSize, avatarSize))
-	draw.BiLinear.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
-
 	var buf bytes.Buffer
-	if err := png.Encode(&buf, dst); err != nil {
+	if err := png.Encode(&buf, scaleImage(src, avatarSize, avatarSize)); err != nil {
 		return "", fmt.Errorf("encode png: %w", err)
 	}
 
@@ -103,8 +89,8 @@ func (s *AvatarStore) Get(userId string) (string, bool) {
 		return val.(string), true
 	}
 
-	// Fall back to Redis
-	val, err := s.redis.Get(key)
+	// Fall back to the KV store
+	val, err := s.kv.Get(key)
 	if err != nil || val == "" {
 		return "", false
 	}
@@ -119,8 +105,8 @@ func (s *AvatarStore) Has(userId string) bool {
 	if _, ok := s.cache.Load(key); ok {
 		return true
 	}
-	exists, _ := s.redis.Exists(key)
-	return exists > 0
+	exists, _ := s.kv.Exists(key)
+	return exists
 }
 
 // List returns all saved avatars as a map of userId to base64 content.
@@ -128,13 +114,13 @@ func (s *AvatarStore) List() (map[string]string, error) {
 	result := make(map[string]string)
 	var cursor uint64
 	for {
-		keys, nextCursor, err := s.redis.Scan(cursor, avatarKeyPrefix+"*", avatarScanBatchSize)
+		keys, nextCursor, err := s.kv.Scan(cursor, avatarKeyPrefix+"*", avatarScanBatchSize)
 		if err != nil {
 			return nil, err
 		}
 		for _, key := range keys {
 			userId := strings.TrimPrefix(key, avatarKeyPrefix)
-			val, err := s.redis.Get(key)
+			val, err := s.kv.Get(key)
 			if err != nil || val == "" {
 				continue
 			}
@@ -0,0 +1,326 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("kv")
+
+// how often expired keys are removed from the file, reads skip them anyway
+const boltSweepInterval = 10 * time.Minute
+
+// boltEntry is the JSON value stored for every key
+type boltEntry struct {
+	Value     string            `json:"v,omitempty"`
+	Hash      map[string]string `json:"h,omitempty"`
+	List      []string          `json:"l,omitempty"`
+	ExpiresAt int64             `json:"e,omitempty"`
+}
+
+// BoltKV stores everything in a single bbolt file, for single instance deployments without Redis
+type BoltKV struct {
+	db   *bolt.DB
+	stop chan struct{}
+}
+
+var _ KV = (*BoltKV)(nil)
+
+func NewBoltKV(path string) (*BoltKV, error) {
+	if path == "" {
+		return nil, fmt.Errorf("bolt storage path is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create bolt storage dir: %w", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt storage %s: %w", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create bolt bucket: %w", err)
+	}
+	b := &BoltKV{db: db, stop: make(chan struct{})}
+	go b.sweepLoop()
+	return b, nil
+}
+
+func (b *BoltKV) sweepLoop() {
+	b.sweep()
+	ticker := time.NewTicker(boltSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			b.sweep()
+		}
+	}
+}
+
+// sweep deletes expired keys
+func (b *BoltKV) sweep() {
+	now := time.Now()
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		var expiredKeys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var entry boltEntry
+			if err := json.Unmarshal(v, &entry); err != nil || expired(entry.ExpiresAt, now) {
+				expiredKeys = append(expiredKeys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expiredKeys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warn("failed to sweep expired keys", slog.Any("error", err))
+	}
+}
+
+// load reads the live entry of a key
+func load(bucket *bolt.Bucket, key string) (*boltEntry, bool, error) {
+	raw := bucket.Get([]byte(key))
+	if raw == nil {
+		return nil, false, nil
+	}
+	var entry boltEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, false, fmt.Errorf("corrupted value of %s: %w", key, err)
+	}
+	if expired(entry.ExpiresAt, time.Now()) {
+		return nil, false, nil
+	}
+	return &entry, true, nil
+}
+
+func store(bucket *bolt.Bucket, key string, entry *boltEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), raw)
+}
+
+func (b *BoltKV) Get(key string) (string, error) {
+	var value string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		entry, ok, err := load(tx.Bucket(boltBucket), key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNotFound
+		}
+		if entry.Hash != nil || entry.List != nil {
+			return fmt.Errorf("key %s does not hold a string", key)
+		}
+		value = entry.Value
+		return nil
+	})
+	return value, err
+}
+
+func (b *BoltKV) Set(key string, value any, ttl time.Duration) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return store(tx.Bucket(boltBucket), key, &boltEntry{Value: formatValue(value), ExpiresAt: expiresAt(ttl)})
+	})
+}
+
+func (b *BoltKV) SetNX(key string, value any, ttl time.Duration) (bool, error) {
+	set := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		if _, ok, err := load(bucket, key); err != nil || ok {
+			return err
+		}
+		set = true
+		return store(bucket, key, &boltEntry{Value: formatValue(value), ExpiresAt: expiresAt(ttl)})
+	})
+	return set, err
+}
+
+func (b *BoltKV) Del(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+}
+
+func (b *BoltKV) Exists(key string) (bool, error) {
+	exists := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		_, ok, err := load(tx.Bucket(boltBucket), key)
+		exists = ok
+		return err
+	})
+	return exists, err
+}
+
+// Scan returns all matching keys at once, in key order
+func (b *BoltKV) Scan(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	var keys []string
+	now := time.Now()
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			if !matchPattern(match, string(k)) {
+				return nil
+			}
+			var entry boltEntry
+			if err := json.Unmarshal(v, &entry); err != nil || expired(entry.ExpiresAt, now) {
+				return nil
+			}
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, 0, err
+}
+
+func (b *BoltKV) IncrBy(key string, delta int64, ttl time.Duration) (int64, error) {
+	var value int64
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		entry, ok, err := load(bucket, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			entry = &boltEntry{}
+		}
+		if entry.Hash != nil || entry.List != nil {
+			return fmt.Errorf("key %s does not hold a string", key)
+		}
+		if value, err = incr(entry.Value, delta); err != nil {
+			return fmt.Errorf("value of %s: %w", key, err)
+		}
+		entry.Value = strconv.FormatInt(value, 10)
+		entry.ExpiresAt = expiresAt(ttl)
+		return store(bucket, key, entry)
+	})
+	return value, err
+}
+
+func (b *BoltKV) HSet(key string, values map[string]string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		entry, ok, err := load(bucket, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			entry = &boltEntry{Hash: make(map[string]string)}
+		}
+		if entry.Hash == nil {
+			if entry.Value != "" || entry.List != nil {
+				return fmt.Errorf("key %s does not hold a hash", key)
+			}
+			entry.Hash = make(map[string]string)
+		}
+		maps.Copy(entry.Hash, values)
+		return store(bucket, key, entry)
+	})
+}
+
+func (b *BoltKV) HGetAll(key string) (map[string]string, error) {
+	result := map[string]string{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		entry, ok, err := load(tx.Bucket(boltBucket), key)
+		if err != nil || !ok {
+			return err
+		}
+		maps.Copy(result, entry.Hash)
+		return nil
+	})
+	return result, err
+}
+
+func (b *BoltKV) HIncrBy(key, field string, delta int64, ttl time.Duration) (int64, error) {
+	var value int64
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		entry, ok, err := load(bucket, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			entry = &boltEntry{}
+		}
+		if entry.Hash == nil {
+			if entry.Value != "" || entry.List != nil {
+				return fmt.Errorf("key %s does not hold a hash", key)
+			}
+			entry.Hash = make(map[string]string)
+		}
+		if value, err = incr(entry.Hash[field], delta); err != nil {
+			return fmt.Errorf("field %s of %s: %w", field, key, err)
+		}
+		entry.Hash[field] = strconv.FormatInt(value, 10)
+		entry.ExpiresAt = expiresAt(ttl)
+		return store(bucket, key, entry)
+	})
+	return value, err
+}
+
+func (b *BoltKV) RPush(key string, maxLen int64, ttl time.Duration, values ...string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		entry, ok, err := load(bucket, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			entry = &boltEntry{}
+		}
+		if entry.Hash != nil || (entry.List == nil && entry.Value != "") {
+			return fmt.Errorf("key %s does not hold a list", key)
+		}
+		entry.List = pushList(entry.List, maxLen, values)
+		entry.ExpiresAt = expiresAt(ttl)
+		return store(bucket, key, entry)
+	})
+}
+
+func (b *BoltKV) LRange(key string, start, stop int64) ([]string, error) {
+	result := []string{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		entry, ok, err := load(tx.Bucket(boltBucket), key)
+		if err != nil || !ok {
+			return err
+		}
+		if entry.List == nil && (entry.Hash != nil || entry.Value != "") {
+			return fmt.Errorf("key %s does not hold a list", key)
+		}
+		result = listRange(entry.List, start, stop)
+		return nil
+	})
+	return result, err
+}
+
+func (b *BoltKV) Close() error {
+	close(b.stop)
+	return b.db.Close()
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const conversationKeyPrefix = "gpt:conv:"
+
+// Turn is one message of a conversation
+type Turn struct {
+	Role    string `json:"role"` // "user" or "assistant"
+	Content string `json:"content"`
+}
+
+// ConversationStore keeps the recent turns of GPT conversations. A conversation is a private chat,
+// or one user in a group chat. Stored turns are capped by count and by an estimated token budget,
+// and the whole conversation expires after ttl without new turns.
+type ConversationStore struct {
+	kv        KV
+	maxTurns  int
+	maxTokens int
+	ttl       time.Duration
+	// appends are read-modify-write, serialized per conversation
+	locks sync.Map // key -> *sync.Mutex
+}
+
+func NewConversationStore(kv KV, maxTurns int, maxTokens int, ttl time.Duration) *ConversationStore {
+	return &ConversationStore{kv: kv, maxTurns: maxTurns, maxTokens: maxTokens, ttl: ttl}
+}
+
+func conversationKey(target, userId string) string {
+	if userId == "" || userId == target {
+		return conversationKeyPrefix + target
+	}
+	return fmt.Sprintf("%s%s:%s", conversationKeyPrefix, target, userId)
+}
+
+// Load returns the stored turns, oldest first
+func (s *ConversationStore) Load(target, userId string) ([]Turn, error) {
+	raw, err := s.kv.Get(conversationKey(target, userId))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var turns []Turn
+	if err := json.Unmarshal([]byte(raw), &turns); err != nil {
+		return nil, fmt.Errorf("decode conversation: %w", err)
+	}
+	return turns, nil
+}
+
+// Append adds turns to the conversation, drops the oldest ones beyond the limits and renews the ttl
+func (s *ConversationStore) Append(target, userId string, turns ...Turn) error {
+	lock, _ := s.locks.LoadOrStore(conversationKey(target, userId), &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	stored, err := s.Load(target, userId)
+	if err != nil {
+		return err
+	}
+	stored = s.trim(append(stored, turns...))
+	raw, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return s.kv.Set(conversationKey(target, userId), string(raw), s.ttl)
+}
+
+// Reset forgets the conversation
+func (s *ConversationStore) Reset(target, userId string) error {
+	return s.kv.Del(conversationKey(target, userId))
+}
+
+// trim keeps the newest turns fitting both the turn count (a question and its answer count as one)
+// and the token budget
+func (s *ConversationStore) trim(turns []Turn) []Turn {
+	if s.maxTurns > 0 && len(turns) > s.maxTurns*2 {
+		turns = turns[len(turns)-s.maxTurns*2:]
+	}
+	if s.maxTokens <= 0 {
+		return turns
+	}
+	tokens := 0
+	for i := len(turns) - 1; i >= 0; i-- {
+		tokens += EstimateTokens(turns[i].Content)
+		if tokens > s.maxTokens {
+			turns = turns[i+1:]
+			break
+		}
+	}
+	// never start a conversation with a dangling answer
+	for len(turns) > 0 && turns[0].Role != "user" {
+		turns = turns[1:]
+	}
+	return turns
+}
+
+// EstimateTokens roughly counts tokens without a tokenizer: one per CJK character,
+// one per four other characters
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConversationAppendConcurrent(t *testing.T) {
+	store := NewConversationStore(NewMemoryKV(), 100, 0, time.Hour)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Append("g1", "u1",
+				Turn{Role: "user", Content: fmt.Sprintf("q%d", i)},
+				Turn{Role: "assistant", Content: fmt.Sprintf("a%d", i)},
+			)
+		}()
+	}
+	wg.Wait()
+	turns, err := store.Load("g1", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 40 {
+		t.Fatalf("%d turns stored, want 40: concurrent appends lost turns", len(turns))
+	}
+}
+
+func TestConversationTrim(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxTurns  int
+		maxTokens int
+		turns     []Turn
+		want      int
+	}{
+		{"under limits", 10, 1000, []Turn{{"user", "hi"}, {"assistant", "hello"}}, 2},
+		{"turn count", 1, 0, []Turn{{"user", "1"}, {"assistant", "1"}, {"user", "2"}, {"assistant", "2"}}, 2},
+		// 8 CJK characters are 8 tokens, only the last question and answer fit into 10
+		{"token budget", 0, 10, []Turn{{"user", "一二三四"}, {"assistant", "一二三四"}, {"user", "一二"}, {"assistant", "一二三"}}, 2},
+		{"no dangling answer", 0, 5, []Turn{{"user", "一二三"}, {"assistant", "一二三"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewConversationStore(NewMemoryKV(), tt.maxTurns, tt.maxTokens, time.Hour)
+			if got := store.trim(tt.turns); len(got) != tt.want {
+				t.Errorf("trim kept %d turns, want %d: %v", len(got), tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const historyKeyPrefix = "history:"
+
+// HistoryMessage is a text message recorded in a group chat
+type HistoryMessage struct {
+	Time   time.Time `json:"time"`
+	UserId string    `json:"user"`
+	Text   string    `json:"text"`
+}
+
+// HistoryStore keeps the recent text messages of group chats in a KV list, capped by count.
+// The history of a group expires after ttl without new messages.
+type HistoryStore struct {
+	kv   KV
+	size int
+	ttl  time.Duration
+}
+
+func NewHistoryStore(kv KV, size int, ttl time.Duration) *HistoryStore {
+	return &HistoryStore{kv: kv, size: size, ttl: ttl}
+}
+
+func historyKey(groupId string) string {
+	return historyKeyPrefix + groupId
+}
+
+// Append records a message, dropping the oldest ones beyond the size, and renews the ttl
+func (s *HistoryStore) Append(groupId string, msg HistoryMessage) error {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.kv.RPush(historyKey(groupId), int64(s.size), s.ttl, string(raw))
+}
+
+// Recent returns up to the last n messages sent after since, oldest first.
+// n <= 0 means no count limit, a zero since no time limit.
+func (s *HistoryStore) Recent(groupId string, n int, since time.Time) ([]HistoryMessage, error) {
+	start := int64(0)
+	if n > 0 {
+		start = -int64(n)
+	}
+	items, err := s.kv.LRange(historyKey(groupId), start, -1)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]HistoryMessage, 0, len(items))
+	for _, item := range items {
+		var msg HistoryMessage
+		if err := json.Unmarshal([]byte(item), &msg); err != nil {
+			return nil, fmt.Errorf("decode history: %w", err)
+		}
+		if !msg.Time.Before(since) {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
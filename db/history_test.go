@@ -0,0 +1,65 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistoryRecent(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			history := NewHistoryStore(kv, 5, time.Hour)
+			start := time.Now().Add(-time.Hour)
+			for i := range 8 {
+				history.Append("g1", HistoryMessage{Time: start.Add(time.Duration(i) * time.Minute), UserId: "u1", Text: fmt.Sprint(i)})
+			}
+			tests := []struct {
+				name  string
+				n     int
+				since time.Time
+				want  string
+			}{
+				{"all kept", 0, time.Time{}, "[3 4 5 6 7]"},
+				{"last n", 2, time.Time{}, "[6 7]"},
+				{"since", 0, start.Add(5 * time.Minute), "[5 6 7]"},
+				{"last n since", 4, start.Add(5 * time.Minute), "[5 6 7]"},
+				{"nothing since", 0, time.Now(), "[]"},
+			}
+			for _, tt := range tests {
+				messages, err := history.Recent("g1", tt.n, tt.since)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var texts []string
+				for _, msg := range messages {
+					texts = append(texts, msg.Text)
+				}
+				if got := fmt.Sprint(texts); got != tt.want {
+					t.Errorf("%s: %s, want %s", tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryAppendConcurrent(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			history := NewHistoryStore(kv, 100, time.Hour)
+			var wg sync.WaitGroup
+			for i := range 50 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					history.Append("g1", HistoryMessage{Time: time.Now(), Text: fmt.Sprint(i)})
+				}()
+			}
+			wg.Wait()
+			if messages, _ := history.Recent("g1", 0, time.Time{}); len(messages) != 50 {
+				t.Errorf("%d messages kept, want 50", len(messages))
+			}
+		})
+	}
+}
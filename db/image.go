@@ -0,0 +1,65 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const downscaleJPEGQuality = 85
+
+// decodeImage decodes a base64 encoded image, returns its format name (e.g. "png")
+func decodeImage(base64Content string) (image.Image, string, error) {
+	raw, err := base64.StdEncoding.DecodeString(base64Content)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode base64: %w", err)
+	}
+	src, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image: %w", err)
+	}
+	return src, format, nil
+}
+
+// scaleImage resizes src to width x height, flattened onto white since JPEG has no alpha channel
+func scaleImage(src image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.BiLinear.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+	return dst
+}
+
+// DownscaleImage shrinks a base64 image so that its longer side is at most maxSide, keeping the aspect ratio,
+// and returns it with its mime type. Small png, jpeg and gif images are returned unchanged, everything else
+// is re-encoded as JPEG with transparent areas turned white.
+func DownscaleImage(base64Content string, maxSide int) (string, string, error) {
+	src, format, err := decodeImage(base64Content)
+	if err != nil {
+		return "", "", err
+	}
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	if width <= maxSide && height <= maxSide {
+		switch format {
+		case "png", "jpeg", "gif":
+			return base64Content, "image/" + format, nil
+		}
+	} else if width >= height {
+		width, height = maxSide, max(1, height*maxSide/width)
+	} else {
+		width, height = max(1, width*maxSide/height), maxSide
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleImage(src, width, height), &jpeg.Options{Quality: downscaleJPEGQuality}); err != nil {
+		return "", "", fmt.Errorf("encode jpeg: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), "image/jpeg", nil
+}
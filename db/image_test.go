@@ -0,0 +1,62 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) string {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestDownscaleImage(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		fill          color.Color
+		wantMime      string
+		wantW, wantH  int
+		wantColor     color.Gray
+	}{
+		{"small png unchanged", 100, 50, color.Black, "image/png", 100, 50, color.Gray{}},
+		{"wide", 2000, 1000, color.Black, "image/jpeg", 500, 250, color.Gray{}},
+		{"tall", 1000, 2000, color.Black, "image/jpeg", 250, 500, color.Gray{}},
+		{"transparent turns white", 2000, 1000, color.Transparent, "image/jpeg", 500, 250, color.Gray{Y: 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height))
+			for y := range tt.height {
+				for x := range tt.width {
+					img.Set(x, y, tt.fill)
+				}
+			}
+			content, mime, err := DownscaleImage(encodePNG(t, img), 500)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mime != tt.wantMime {
+				t.Errorf("mime = %s, want %s", mime, tt.wantMime)
+			}
+			out, _, err := decodeImage(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w, h := out.Bounds().Dx(), out.Bounds().Dy(); w != tt.wantW || h != tt.wantH {
+				t.Errorf("size = %dx%d, want %dx%d", w, h, tt.wantW, tt.wantH)
+			}
+			got := color.GrayModel.Convert(out.At(tt.wantW/2, tt.wantH/2)).(color.Gray)
+			if diff := int(got.Y) - int(tt.wantColor.Y); diff < -8 || diff > 8 {
+				t.Errorf("center = %d, want about %d", got.Y, tt.wantColor.Y)
+			}
+		})
+	}
+}
@@ -10,11 +10,11 @@ const jiandanKeyPrefix = "jiandan:"
 
 // JiandanStore manages visited status of jiandan comments per target (user/group).
 type JiandanStore struct {
-	redis *Redis
+	kv KV
 }
 
-func NewJiandanStore(redis *Redis) *JiandanStore {
-	return &JiandanStore{redis: redis}
+func NewJiandanStore(kv KV) *JiandanStore {
+	return &JiandanStore{kv: kv}
 }
 
 func jiandanKey(targetId, commentId string) string {
@@ -24,11 +24,11 @@ func jiandanKey(targetId, commentId string) string {
 // IsVisited checks whether a comment has been visited for the given target.
 func (s *JiandanStore) IsVisited(targetId, commentId string) bool {
 	key := jiandanKey(targetId, commentId)
-	exists, err := s.redis.Exists(key)
+	exists, err := s.kv.Exists(key)
 	if err != nil {
 		return false
 	}
-	return exists > 0
+	return exists
 }
 
 // MarkVisited marks a comment as visited for the given target.
@@ -40,5 +40,5 @@ func (s *JiandanStore) MarkVisited(targetId, commentId string, pics []string, co
 	if ttl <= 0 {
 		ttl = 24 * time.Hour // minimum 1 day TTL for old posts
 	}
-	s.redis.Set(key, strings.Join(pics, ","), ttl)
+	s.kv.Set(key, strings.Join(pics, ","), ttl)
 }
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"focalors-go/config"
+	"focalors-go/slogger"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var logger = slogger.New("db")
+
+// ErrNotFound is returned by Get when the key does not exist or has expired
+var ErrNotFound = errors.New("key not found")
+
+// KV is the key-value storage used by all stores. Patterns follow Redis glob syntax
+// ("*" and "?"), a ttl of 0 means the key never expires.
+type KV interface {
+	Get(key string) (string, error)
+	Set(key string, value any, ttl time.Duration) error
+	// SetNX sets the key only if it does not exist, returns whether it was set
+	SetNX(key string, value any, ttl time.Duration) (bool, error)
+	Del(key string) error
+	Exists(key string) (bool, error)
+	// Scan iterates keys matching the pattern, a returned cursor of 0 ends the iteration
+	Scan(cursor uint64, match string, count int64) ([]string, uint64, error)
+	// IncrBy atomically adds delta to the integer value of the key (missing keys count as 0) and returns
+	// the new value. The ttl is applied on every call.
+	IncrBy(key string, delta int64, ttl time.Duration) (int64, error)
+	HSet(key string, values map[string]string) error
+	HGetAll(key string) (map[string]string, error)
+	// HIncrBy atomically adds delta to the integer value of a hash field and returns the new value.
+	// The ttl is applied to the whole hash on every call.
+	HIncrBy(key, field string, delta int64, ttl time.Duration) (int64, error)
+	// RPush appends values to the list of the key, keeps only its last maxLen items (all if maxLen <= 0)
+	// and applies the ttl, all at once. Pushing no values does nothing.
+	RPush(key string, maxLen int64, ttl time.Duration, values ...string) error
+	// LRange returns the items of the list from start to stop inclusive, negative indexes count from the end
+	LRange(key string, start, stop int64) ([]string, error)
+	Close() error
+}
+
+// NewKV creates the storage backend selected by app.storage
+func NewKV(ctx context.Context, cfg *config.AppConfig) (KV, error) {
+	switch cfg.Storage {
+	case config.StorageRedis, "":
+		return NewRedis(ctx, &cfg.Redis)
+	case config.StorageBolt:
+		return NewBoltKV(cfg.BoltPath)
+	case config.StorageMemory:
+		return NewMemoryKV(), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage: %s", cfg.Storage)
+	}
+}
+
+// ScanAll returns all keys matching the pattern
+func ScanAll(kv KV, match string) ([]string, error) {
+	var result []string
+	var cursor uint64
+	for {
+		keys, nextCursor, err := kv.Scan(cursor, match, 100)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, keys...)
+		if nextCursor == 0 {
+			return result, nil
+		}
+		cursor = nextCursor
+	}
+}
+
+// formatValue converts values the way Redis stores them
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// incr adds delta to an integer stored as a string, an empty string counts as 0
+func incr(value string, delta int64) (int64, error) {
+	if value == "" {
+		return delta, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("not an integer: %q", value)
+	}
+	return n + delta, nil
+}
+
+// listRange slices a list the way LRANGE does
+func listRange(list []string, start, stop int64) []string {
+	n := int64(len(list))
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return []string{}
+	}
+	return slices.Clone(list[start : stop+1])
+}
+
+// pushList appends values and keeps the last maxLen items
+func pushList(list []string, maxLen int64, values []string) []string {
+	list = append(list, values...)
+	if maxLen > 0 && int64(len(list)) > maxLen {
+		list = slices.Clone(list[int64(len(list))-maxLen:])
+	}
+	return list
+}
+
+// matchPattern reports whether key matches a Redis glob pattern supporting "*", "?" and "\" escapes
+func matchPattern(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// collapse consecutive stars, then try every split point
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if matchPattern(pattern, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if key == "" {
+				return false
+			}
+			pattern, key = pattern[1:], key[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if key == "" || pattern[0] != key[0] {
+				return false
+			}
+			pattern, key = pattern[1:], key[1:]
+		}
+	}
+	return key == ""
+}
+
+// expiresAt converts a ttl to an absolute unix nano deadline, 0 means never
+func expiresAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+func expired(deadline int64, now time.Time) bool {
+	return deadline != 0 && now.UnixNano() >= deadline
+}
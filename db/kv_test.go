@@ -0,0 +1,276 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// backends returns every KV implementation that runs without a server
+func backends(t *testing.T) map[string]KV {
+	t.Helper()
+	bolt, err := NewBoltKV(filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := NewMemoryKV()
+	t.Cleanup(func() {
+		bolt.Close()
+		memory.Close()
+	})
+	return map[string]KV{"memory": memory, "bolt": bolt}
+}
+
+func TestKVGetSet(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := kv.Get("missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get of a missing key: %v, want ErrNotFound", err)
+			}
+			tests := []struct {
+				value any
+				want  string
+			}{
+				{"text", "text"},
+				{42, "42"},
+				{[]byte("raw"), "raw"},
+				{true, "true"},
+			}
+			for _, tt := range tests {
+				if err := kv.Set("k", tt.value, 0); err != nil {
+					t.Fatal(err)
+				}
+				if got, err := kv.Get("k"); err != nil || got != tt.want {
+					t.Errorf("Get after Set(%v) = %q, %v, want %q", tt.value, got, err, tt.want)
+				}
+			}
+			if err := kv.Del("k"); err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := kv.Exists("k"); ok {
+				t.Error("key exists after Del")
+			}
+		})
+	}
+}
+
+func TestKVTTL(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			kv.Set("short", "v", 50*time.Millisecond)
+			kv.Set("forever", "v", 0)
+			if ok, _ := kv.Exists("short"); !ok {
+				t.Fatal("key expired too early")
+			}
+			time.Sleep(80 * time.Millisecond)
+			if _, err := kv.Get("short"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get of an expired key: %v, want ErrNotFound", err)
+			}
+			if ok, _ := kv.Exists("short"); ok {
+				t.Error("expired key exists")
+			}
+			keys, _ := ScanAll(kv, "*")
+			if !slices.Equal(keys, []string{"forever"}) {
+				t.Errorf("Scan = %v, want only the key without ttl", keys)
+			}
+		})
+	}
+}
+
+func TestKVSetNX(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if set, err := kv.SetNX("k", "first", 50*time.Millisecond); err != nil || !set {
+				t.Fatalf("SetNX of a new key = %v, %v", set, err)
+			}
+			if set, _ := kv.SetNX("k", "second", 0); set {
+				t.Error("SetNX overwrote an existing key")
+			}
+			if v, _ := kv.Get("k"); v != "first" {
+				t.Errorf("value = %q, want first", v)
+			}
+			time.Sleep(80 * time.Millisecond)
+			if set, _ := kv.SetNX("k", "third", 0); !set {
+				t.Error("SetNX failed on an expired key")
+			}
+		})
+	}
+}
+
+func TestKVHash(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if got, err := kv.HGetAll("missing"); err != nil || len(got) != 0 {
+				t.Errorf("HGetAll of a missing key = %v, %v", got, err)
+			}
+			kv.HSet("h", map[string]string{"a": "1", "b": "2"})
+			kv.HSet("h", map[string]string{"b": "3"})
+			got, err := kv.HGetAll("h")
+			if err != nil || len(got) != 2 || got["a"] != "1" || got["b"] != "3" {
+				t.Errorf("HGetAll = %v, %v, want merged fields", got, err)
+			}
+			if _, err := kv.Get("h"); err == nil {
+				t.Error("Get of a hash should fail")
+			}
+
+			kv.Set("s", "value", 0)
+			if err := kv.HSet("s", map[string]string{"a": "1"}); err == nil {
+				t.Error("HSet on a string value should fail")
+			}
+			if v, _ := kv.Get("s"); v != "value" {
+				t.Errorf("failed HSet changed the value to %q", v)
+			}
+		})
+	}
+}
+
+func TestKVIncrBy(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			tests := []struct {
+				delta int64
+				want  int64
+			}{
+				{1, 1},
+				{5, 6},
+				{-2, 4},
+			}
+			for _, tt := range tests {
+				if got, err := kv.IncrBy("n", tt.delta, 0); err != nil || got != tt.want {
+					t.Errorf("IncrBy(%d) = %d, %v, want %d", tt.delta, got, err, tt.want)
+				}
+				if got, err := kv.HIncrBy("h", "f", tt.delta, 0); err != nil || got != tt.want {
+					t.Errorf("HIncrBy(%d) = %d, %v, want %d", tt.delta, got, err, tt.want)
+				}
+			}
+			if v, _ := kv.Get("n"); v != "4" {
+				t.Errorf("value = %q, want 4", v)
+			}
+
+			kv.Set("s", "text", 0)
+			if _, err := kv.IncrBy("s", 1, 0); err == nil {
+				t.Error("IncrBy of a non integer should fail")
+			}
+			if _, err := kv.IncrBy("h", 1, 0); err == nil {
+				t.Error("IncrBy of a hash should fail")
+			}
+			if _, err := kv.HIncrBy("s", "f", 1, 0); err == nil {
+				t.Error("HIncrBy of a string value should fail")
+			}
+
+			kv.IncrBy("short", 1, 50*time.Millisecond)
+			time.Sleep(80 * time.Millisecond)
+			if got, _ := kv.IncrBy("short", 1, 0); got != 1 {
+				t.Errorf("IncrBy of an expired key = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestKVIncrByConcurrent(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			const n = 50
+			var wg sync.WaitGroup
+			for range n {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					kv.IncrBy("n", 1, 0)
+					kv.HIncrBy("h", "f", 2, 0)
+				}()
+			}
+			wg.Wait()
+			if v, _ := kv.Get("n"); v != "50" {
+				t.Errorf("counter = %s, want %d", v, n)
+			}
+			if h, _ := kv.HGetAll("h"); h["f"] != "100" {
+				t.Errorf("hash counter = %s, want %d", h["f"], 2*n)
+			}
+		})
+	}
+}
+
+func TestKVList(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if got, err := kv.LRange("missing", 0, -1); err != nil || len(got) != 0 {
+				t.Errorf("LRange of a missing key = %v, %v", got, err)
+			}
+			kv.RPush("l", 3, 0, "a", "b")
+			kv.RPush("l", 3, 0, "c", "d")
+			kv.RPush("l", 3, 0)
+			tests := []struct {
+				start, stop int64
+				want        []string
+			}{
+				{0, -1, []string{"b", "c", "d"}},
+				{-2, -1, []string{"c", "d"}},
+				{-10, 0, []string{"b"}},
+				{1, 10, []string{"c", "d"}},
+				{2, 1, []string{}},
+				{5, -1, []string{}},
+			}
+			for _, tt := range tests {
+				if got, err := kv.LRange("l", tt.start, tt.stop); err != nil || !slices.Equal(got, tt.want) {
+					t.Errorf("LRange(%d, %d) = %v, %v, want %v", tt.start, tt.stop, got, err, tt.want)
+				}
+			}
+
+			kv.RPush("uncapped", 0, 0, "a", "b", "c")
+			if got, _ := kv.LRange("uncapped", 0, -1); len(got) != 3 {
+				t.Errorf("uncapped list = %v", got)
+			}
+
+			kv.Set("s", "value", 0)
+			if err := kv.RPush("s", 0, 0, "a"); err == nil {
+				t.Error("RPush on a string value should fail")
+			}
+			if _, err := kv.LRange("s", 0, -1); err == nil {
+				t.Error("LRange of a string value should fail")
+			}
+			if _, err := kv.Get("l"); err == nil {
+				t.Error("Get of a list should fail")
+			}
+			if err := kv.HSet("l", map[string]string{"a": "1"}); err == nil {
+				t.Error("HSet on a list should fail")
+			}
+
+			kv.RPush("short", 0, 50*time.Millisecond, "a")
+			time.Sleep(80 * time.Millisecond)
+			if got, _ := kv.LRange("short", 0, -1); len(got) != 0 {
+				t.Errorf("expired list = %v", got)
+			}
+		})
+	}
+}
+
+func TestKVScan(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"access:g1", "access:g2", "access:*", "avatar:u1"} {
+				kv.Set(key, "1", 0)
+			}
+			tests := []struct {
+				pattern string
+				want    []string
+			}{
+				{"access:*", []string{"access:*", "access:g1", "access:g2"}},
+				{"access:g?", []string{"access:g1", "access:g2"}},
+				{`access:\*`, []string{"access:*"}},
+				{"*:u1", []string{"avatar:u1"}},
+				{"none*", nil},
+			}
+			for _, tt := range tests {
+				keys, err := ScanAll(kv, tt.pattern)
+				slices.Sort(keys)
+				if err != nil || !slices.Equal(keys, tt.want) {
+					t.Errorf("Scan(%q) = %v, %v, want %v", tt.pattern, keys, err, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value     string
+	hash      map[string]string
+	list      []string
+	expiresAt int64
+}
+
+// MemoryKV keeps everything in process memory, nothing survives a restart.
+// Meant for tests and trying the bot out.
+type MemoryKV struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+var _ KV = (*MemoryKV)(nil)
+
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{entries: make(map[string]*memoryEntry)}
+}
+
+// get returns the live entry of a key, must be called with mu held
+func (m *MemoryKV) get(key string) (*memoryEntry, bool) {
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if expired(entry.expiresAt, time.Now()) {
+		delete(m.entries, key)
+		return nil, false
+	}
+	return entry, true
+}
+
+func (m *MemoryKV) Get(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.get(key)
+	if !ok {
+		return "", ErrNotFound
+	}
+	if entry.hash != nil || entry.list != nil {
+		return "", fmt.Errorf("key %s does not hold a string", key)
+	}
+	return entry.value, nil
+}
+
+func (m *MemoryKV) Set(key string, value any, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = &memoryEntry{value: formatValue(value), expiresAt: expiresAt(ttl)}
+	return nil
+}
+
+func (m *MemoryKV) SetNX(key string, value any, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.get(key); ok {
+		return false, nil
+	}
+	m.entries[key] = &memoryEntry{value: formatValue(value), expiresAt: expiresAt(ttl)}
+	return true, nil
+}
+
+func (m *MemoryKV) Del(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *MemoryKV) Exists(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.get(key)
+	return ok, nil
+}
+
+// Scan returns all matching keys at once
+func (m *MemoryKV) Scan(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.entries {
+		if _, ok := m.get(key); ok && matchPattern(match, key) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, 0, nil
+}
+
+func (m *MemoryKV) IncrBy(key string, delta int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.get(key)
+	if !ok {
+		entry = &memoryEntry{value: "0"}
+		m.entries[key] = entry
+	}
+	if entry.hash != nil || entry.list != nil {
+		return 0, fmt.Errorf("key %s does not hold a string", key)
+	}
+	value, err := incr(entry.value, delta)
+	if err != nil {
+		return 0, fmt.Errorf("value of %s: %w", key, err)
+	}
+	entry.value = strconv.FormatInt(value, 10)
+	entry.expiresAt = expiresAt(ttl)
+	return value, nil
+}
+
+func (m *MemoryKV) HSet(key string, values map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.get(key)
+	if !ok {
+		entry = &memoryEntry{hash: make(map[string]string)}
+		m.entries[key] = entry
+	}
+	if entry.hash == nil {
+		return fmt.Errorf("key %s does not hold a hash", key)
+	}
+	maps.Copy(entry.hash, values)
+	return nil
+}
+
+func (m *MemoryKV) HGetAll(key string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.get(key)
+	if !ok || entry.hash == nil {
+		return map[string]string{}, nil
+	}
+	return maps.Clone(entry.hash), nil
+}
+
+func (m *MemoryKV) HIncrBy(key, field string, delta int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.get(key)
+	if !ok {
+		entry = &memoryEntry{hash: make(map[string]string)}
+		m.entries[key] = entry
+	}
+	if entry.hash == nil {
+		return 0, fmt.Errorf("key %s does not hold a hash", key)
+	}
+	value, err := incr(entry.hash[field], delta)
+	if err != nil {
+		return 0, fmt.Errorf("field %s of %s: %w", field, key, err)
+	}
+	entry.hash[field] = strconv.FormatInt(value, 10)
+	entry.expiresAt = expiresAt(ttl)
+	return value, nil
+}
+
+func (m *MemoryKV) RPush(key string, maxLen int64, ttl time.Duration, values ...string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.get(key)
+	if !ok {
+		entry = &memoryEntry{list: []string{}}
+		m.entries[key] = entry
+	}
+	if entry.list == nil {
+		return fmt.Errorf("key %s does not hold a list", key)
+	}
+	entry.list = pushList(entry.list, maxLen, values)
+	entry.expiresAt = expiresAt(ttl)
+	return nil
+}
+
+func (m *MemoryKV) LRange(key string, start, stop int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.get(key)
+	if !ok {
+		return []string{}, nil
+	}
+	if entry.list == nil {
+		return nil, fmt.Errorf("key %s does not hold a list", key)
+	}
+	return listRange(entry.list, start, stop), nil
+}
+
+func (m *MemoryKV) Close() error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	quotaKeyPrefix = "quota:"
+	// keep the counter a bit longer than the day it counts
+	quotaTTL = 48 * time.Hour
+)
+
+// QuotaStore counts the daily usage of a limited feature per target (user/group).
+// Counters reset at local midnight.
+type QuotaStore struct {
+	kv   KV
+	name string
+}
+
+func NewQuotaStore(kv KV, name string) *QuotaStore {
+	return &QuotaStore{kv: kv, name: name}
+}
+
+func (q *QuotaStore) key(target string, now time.Time) string {
+	return fmt.Sprintf("%s%s:%s:%s", quotaKeyPrefix, q.name, target, now.Format("20060102"))
+}
+
+// Take uses one unit of today's quota, returns false if the limit is reached. A limit <= 0 means unlimited.
+func (q *QuotaStore) Take(target string, limit int) (bool, error) {
+	if limit <= 0 {
+		return true, nil
+	}
+	key := q.key(target, time.Now())
+	used, err := q.kv.IncrBy(key, 1, quotaTTL)
+	if err != nil {
+		return false, err
+	}
+	if used > int64(limit) {
+		// over the limit, give the unit back
+		_, err := q.kv.IncrBy(key, -1, quotaTTL)
+		return false, err
+	}
+	return true, nil
+}
+
+// Refund gives back a unit taken today, e.g. when the limited operation failed
+func (q *QuotaStore) Refund(target string) error {
+	key := q.key(target, time.Now())
+	used, err := q.kv.IncrBy(key, -1, quotaTTL)
+	if err == nil && used < 0 {
+		// taken before midnight, nothing to give back on today's counter
+		_, err = q.kv.IncrBy(key, 1, quotaTTL)
+	}
+	return err
+}
+
+// Used returns how many units the target has used today
+func (q *QuotaStore) Used(target string) (int, error) {
+	raw, err := q.kv.Get(q.key(target, time.Now()))
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(raw)
+}
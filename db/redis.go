@@ -2,6 +2,8 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"focalors-go/config"
 	"time"
 
@@ -14,7 +16,9 @@ type Redis struct {
 	cfg         *config.RedisConfig
 }
 
-func NewRedis(ctx context.Context, cfg *config.RedisConfig) *Redis {
+var _ KV = (*Redis)(nil)
+
+func NewRedis(ctx context.Context, cfg *config.RedisConfig) (*Redis, error) {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     cfg.Addr,
 		Password: cfg.Password,
@@ -22,26 +26,37 @@ func NewRedis(ctx context.Context, cfg *config.RedisConfig) *Redis {
 	})
 
 	if err := rdb.Ping(ctx).Err(); err != nil {
-		panic("Failed to connect to Redis: " + err.Error())
+		rdb.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
 	return &Redis{
 		RedisClient: rdb,
 		RedisCtx:    ctx,
 		cfg:         cfg,
-	}
+	}, nil
 }
 
-func (r *Redis) HSet(key string, values ...any) error {
-	return r.RedisClient.HSet(r.RedisCtx, key, values...).Err()
+func (r *Redis) HSet(key string, values map[string]string) error {
+	return r.RedisClient.HSet(r.RedisCtx, key, values).Err()
 }
 
-func (r *Redis) Del(key string) error {
-	return r.RedisClient.Del(r.RedisCtx, key).Err()
+func (r *Redis) HIncrBy(key, field string, delta int64, ttl time.Duration) (int64, error) {
+	pipe := r.RedisClient.TxPipeline()
+	incr := pipe.HIncrBy(r.RedisCtx, key, field, delta)
+	if ttl > 0 {
+		pipe.Expire(r.RedisCtx, key, ttl)
+	} else {
+		pipe.Persist(r.RedisCtx, key)
+	}
+	if _, err := pipe.Exec(r.RedisCtx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
 }
 
-func (r *Redis) Keys(pattern string) ([]string, error) {
-	return r.RedisClient.Keys(r.RedisCtx, pattern).Result()
+func (r *Redis) Del(key string) error {
+	return r.RedisClient.Del(r.RedisCtx, key).Err()
 }
 
 func (r *Redis) HGetAll(key string) (map[string]string, error) {
@@ -53,11 +68,11 @@ func (r *Redis) HGetAll(key string) (map[string]string, error) {
 }
 
 func (r *Redis) Get(key string) (string, error) {
-	cmd := r.RedisClient.Get(r.RedisCtx, key)
-	if err := cmd.Err(); err != nil {
-		return "", err
+	result, err := r.RedisClient.Get(r.RedisCtx, key).Result()
+	// redis.Nil represents a missing key
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
 	}
-	result, err := cmd.Result()
 	if err != nil {
 		return "", err
 	}
@@ -65,19 +80,55 @@ func (r *Redis) Get(key string) (string, error) {
 }
 
 func (r *Redis) Set(key string, value any, expiration time.Duration) error {
-	cmd := r.RedisClient.Set(r.RedisCtx, key, value, expiration)
-	if err := cmd.Err(); err != nil {
-		return err
-	}
-	return nil
+	return r.RedisClient.Set(r.RedisCtx, key, value, expiration).Err()
+}
+
+func (r *Redis) SetNX(key string, value any, expiration time.Duration) (bool, error) {
+	return r.RedisClient.SetNX(r.RedisCtx, key, value, expiration).Result()
 }
 
-func (r *Redis) Exists(key string) (int64, error) {
-	cmd := r.RedisClient.Exists(r.RedisCtx, key)
-	if err := cmd.Err(); err != nil {
+func (r *Redis) IncrBy(key string, delta int64, ttl time.Duration) (int64, error) {
+	pipe := r.RedisClient.TxPipeline()
+	incr := pipe.IncrBy(r.RedisCtx, key, delta)
+	if ttl > 0 {
+		pipe.Expire(r.RedisCtx, key, ttl)
+	} else {
+		pipe.Persist(r.RedisCtx, key)
+	}
+	if _, err := pipe.Exec(r.RedisCtx); err != nil {
 		return 0, err
 	}
-	return cmd.Result()
+	return incr.Val(), nil
+}
+
+func (r *Redis) RPush(key string, maxLen int64, ttl time.Duration, values ...string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	pipe := r.RedisClient.TxPipeline()
+	pipe.RPush(r.RedisCtx, key, values)
+	if maxLen > 0 {
+		pipe.LTrim(r.RedisCtx, key, -maxLen, -1)
+	}
+	if ttl > 0 {
+		pipe.Expire(r.RedisCtx, key, ttl)
+	} else {
+		pipe.Persist(r.RedisCtx, key)
+	}
+	_, err := pipe.Exec(r.RedisCtx)
+	return err
+}
+
+func (r *Redis) LRange(key string, start, stop int64) ([]string, error) {
+	return r.RedisClient.LRange(r.RedisCtx, key, start, stop).Result()
+}
+
+func (r *Redis) Exists(key string) (bool, error) {
+	count, err := r.RedisClient.Exists(r.RedisCtx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
 }
 
 func (r *Redis) Scan(cursor uint64, match string, count int64) ([]string, uint64, error) {
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	usageDayKeyPrefix   = "usage:daily:"
+	usageMonthKeyPrefix = "usage:monthly:"
+	usageDayTTL         = 40 * 24 * time.Hour
+	usageMonthTTL       = 400 * 24 * time.Hour
+
+	// fields of the usage hash, the tokens of each user are kept under usageUserField + user id
+	usagePromptField     = "prompt"
+	usageCompletionField = "completion"
+	usageRequestsField   = "requests"
+	usageUserField       = "user:"
+)
+
+// Usage is the token consumption of a target (user/group) in a day or a month
+type Usage struct {
+	PromptTokens     int64
+	CompletionTokens int64
+	Requests         int64
+	Users            map[string]int64 // total tokens per user
+}
+
+func (u *Usage) Total() int64 {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// UsageStore records the token usage of GPT completions per target, user, day and month.
+// Every period is a hash of counters, so concurrent completions never lose an update.
+type UsageStore struct {
+	kv KV
+}
+
+func NewUsageStore(kv KV) *UsageStore {
+	return &UsageStore{kv: kv}
+}
+
+func usageDayPrefix(now time.Time) string {
+	return usageDayKeyPrefix + now.Format("20060102") + ":"
+}
+
+func usageMonthPrefix(now time.Time) string {
+	return usageMonthKeyPrefix + now.Format("200601") + ":"
+}
+
+func (s *UsageStore) load(key string) (*Usage, error) {
+	fields, err := s.kv.HGetAll(key)
+	if err != nil {
+		return nil, err
+	}
+	usage := &Usage{}
+	for field, raw := range fields {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch field {
+		case usagePromptField:
+			usage.PromptTokens = value
+		case usageCompletionField:
+			usage.CompletionTokens = value
+		case usageRequestsField:
+			usage.Requests = value
+		default:
+			if userId, ok := strings.CutPrefix(field, usageUserField); ok {
+				if usage.Users == nil {
+					usage.Users = make(map[string]int64)
+				}
+				usage.Users[userId] = value
+			}
+		}
+	}
+	return usage, nil
+}
+
+func (s *UsageStore) add(key string, userId string, prompt, completion int64, ttl time.Duration) error {
+	increments := map[string]int64{
+		usagePromptField:     prompt,
+		usageCompletionField: completion,
+		usageRequestsField:   1,
+	}
+	if userId != "" {
+		increments[usageUserField+userId] = prompt + completion
+	}
+	for field, delta := range increments {
+		if _, err := s.kv.HIncrBy(key, field, delta, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record adds the tokens of one completion to today's and this month's usage of the target
+func (s *UsageStore) Record(target, userId string, prompt, completion int64) error {
+	now := time.Now()
+	if err := s.add(usageDayPrefix(now)+target, userId, prompt, completion, usageDayTTL); err != nil {
+		return err
+	}
+	return s.add(usageMonthPrefix(now)+target, userId, prompt, completion, usageMonthTTL)
+}
+
+// Today returns today's usage of the target
+func (s *UsageStore) Today(target string) (*Usage, error) {
+	return s.load(usageDayPrefix(time.Now()) + target)
+}
+
+// ThisMonth returns this month's usage of the target
+func (s *UsageStore) ThisMonth(target string) (*Usage, error) {
+	return s.load(usageMonthPrefix(time.Now()) + target)
+}
+
+// ListToday returns today's usage of all targets
+func (s *UsageStore) ListToday() (map[string]*Usage, error) {
+	return s.list(usageDayPrefix(time.Now()))
+}
+
+// ListThisMonth returns this month's usage of all targets
+func (s *UsageStore) ListThisMonth() (map[string]*Usage, error) {
+	return s.list(usageMonthPrefix(time.Now()))
+}
+
+func (s *UsageStore) list(prefix string) (map[string]*Usage, error) {
+	keys, err := ScanAll(s.kv, prefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*Usage, len(keys))
+	for _, key := range keys {
+		usage, err := s.load(key)
+		if err != nil {
+			return nil, err
+		}
+		result[strings.TrimPrefix(key, prefix)] = usage
+	}
+	return result, nil
+}
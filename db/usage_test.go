@@ -0,0 +1,78 @@
+package db
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestUsageRecord(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			usage := NewUsageStore(kv)
+			var wg sync.WaitGroup
+			for _, user := range []string{"u1", "u1", "u2", ""} {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := usage.Record("g1", user, 10, 5); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+			for _, get := range []func(string) (*Usage, error){usage.Today, usage.ThisMonth} {
+				got, err := get("g1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.PromptTokens != 40 || got.CompletionTokens != 20 || got.Requests != 4 {
+					t.Errorf("usage = %+v, want 40 prompt, 20 completion tokens in 4 requests", got)
+				}
+				if len(got.Users) != 2 || got.Users["u1"] != 30 || got.Users["u2"] != 15 {
+					t.Errorf("users = %v", got.Users)
+				}
+			}
+			list, err := usage.ListToday()
+			if err != nil || len(list) != 1 || list["g1"] == nil {
+				t.Errorf("ListToday = %v, %v", list, err)
+			}
+		})
+	}
+}
+
+func TestQuotaTake(t *testing.T) {
+	for name, kv := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			quota := NewQuotaStore(kv, "image")
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			taken := 0
+			for range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if ok, err := quota.Take("g1", 3); err == nil && ok {
+						mu.Lock()
+						taken++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			if used, _ := quota.Used("g1"); taken != 3 || used != 3 {
+				t.Errorf("taken %d, used %d, want 3", taken, used)
+			}
+			quota.Refund("g1")
+			if ok, _ := quota.Take("g1", 3); !ok {
+				t.Error("Take failed after a refund")
+			}
+			quota.Refund("g2")
+			if used, _ := quota.Used("g2"); used != 0 {
+				t.Errorf("refund without a take left %d used", used)
+			}
+			if ok, _ := quota.Take("g2", 0); !ok {
+				t.Error("a limit of 0 should be unlimited")
+			}
+		})
+	}
+}
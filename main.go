@@ -8,7 +8,11 @@ import (
 	"focalors-go/contract"
 	"focalors-go/db"
 	"focalors-go/middlewares"
+	"focalors-go/provider/console"
 	"focalors-go/provider/lark"
+	"focalors-go/provider/onebot"
+	"focalors-go/provider/router"
+	"focalors-go/provider/telegram"
 	"focalors-go/provider/wechat"
 	"focalors-go/slogger"
 	"log"
@@ -77,11 +81,14 @@ func main() {
 	// Create a cancellable context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Create shared Redis instance
-	redis := db.NewRedis(ctx, &cfg.App.Redis)
-	defer redis.Close()
+	// Create shared storage, selected by app.storage
+	kv, err := db.NewKV(ctx, &cfg.App)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	defer kv.Close()
 
-	c, err := newGenericClient(cfg, redis)
+	c, err := newGenericClient(cfg, kv)
 
 	if err != nil {
 		logger.Error("Failed to create client", slog.Any("error", err))
@@ -90,17 +97,24 @@ func main() {
 
 	go c.Start(ctx)
 
-	mctx := middlewares.NewMiddlewareContext(ctx, c, cfg, redis)
+	mctx := middlewares.NewMiddlewareContext(ctx, c, cfg, kv)
 	defer mctx.Close()
 
 	m := middlewares.NewRootMiddleware(mctx)
 
 	m.AddMiddlewares(
 		middlewares.NewLogMsgMiddleware,
+		// records group messages, so it comes before any middleware taking them
+		middlewares.NewSummaryMiddleware,
 		middlewares.NewAdminMiddleware,
 		middlewares.NewAccessMiddleware,
 		middlewares.NewAvatarMiddleware,
 		middlewares.NewJiadanMiddleware,
+		middlewares.NewReminderMiddleware,
+		middlewares.NewWeatherMiddleware,
+		middlewares.NewPersonaMiddleware,
+		middlewares.NewGptCommandMiddleware,
+		// takes all remaining "#", "*" and "%" commands
 		middlewares.NewYunzaiMiddleware,
 		middlewares.NewOpenAIMiddleware,
 	)
@@ -120,13 +134,45 @@ func main() {
 	cancel()
 }
 
-func newGenericClient(cfg *config.Config, redis *db.Redis) (contract.GenericClient, error) {
-	switch cfg.App.Platform {
+func newGenericClient(cfg *config.Config, kv db.KV) (contract.GenericClient, error) {
+	// single platform setup, ids are passed through unqualified
+	if len(cfg.App.Platforms) == 0 {
+		return newPlatformClient(&config.PlatformConfig{
+			Name:     cfg.App.Platform,
+			Type:     cfg.App.Platform,
+			Wechat:   cfg.Wechat,
+			Lark:     cfg.Lark,
+			Telegram: cfg.Telegram,
+			OneBot:   cfg.OneBot,
+			Console:  cfg.Console,
+		}, kv)
+	}
+
+	r := router.New()
+	for i := range cfg.App.Platforms {
+		p := &cfg.App.Platforms[i]
+		client, err := newPlatformClient(p, kv)
+		if err != nil {
+			return nil, fmt.Errorf("platform %s: %w", p.Name, err)
+		}
+		r.Add(p.Name, client)
+	}
+	return r, nil
+}
+
+func newPlatformClient(p *config.PlatformConfig, kv db.KV) (contract.GenericClient, error) {
+	switch p.Type {
 	case "lark":
-		return lark.NewLarkClient(cfg, redis)
+		return lark.NewLarkClient(&p.Lark, kv)
+	case "telegram":
+		return telegram.NewTelegramClient(&p.Telegram)
+	case "onebot":
+		return onebot.NewOneBotClient(&p.OneBot)
+	case "console":
+		return console.NewConsoleClient(&p.Console)
 	case "wechat", "":
-		return wechat.NewWechat(cfg)
+		return wechat.NewWechat(&p.Wechat)
 	default:
-		return nil, fmt.Errorf("unsupported platform: %s", cfg.App.Platform)
+		return nil, fmt.Errorf("unsupported platform: %s", p.Type)
 	}
 }
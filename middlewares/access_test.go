@@ -0,0 +1,44 @@
+package middlewares_test
+
+import (
+	"testing"
+
+	"focalors-go/middlewares"
+	"focalors-go/middlewares/testkit"
+)
+
+func TestAdminHelp(t *testing.T) {
+	h := testkit.New(t)
+	h.Use(middlewares.NewAdminMiddleware, middlewares.NewAccessMiddleware)
+
+	h.Send(testkit.NewMessage("#admin -h").From(testkit.Admin))
+	h.AssertSentContains("Usage")
+}
+
+func TestAccessIsAdminOnly(t *testing.T) {
+	h := testkit.New(t)
+	h.Use(middlewares.NewAccessMiddleware)
+
+	h.Send(testkit.NewMessage("#access -p gpt add").From("u1").InGroup("g1"))
+	h.AssertNothingSent()
+	if ok, _ := h.KV.Exists("access:g1"); ok {
+		t.Fatal("a user who is not an admin granted access")
+	}
+}
+
+func TestAccessAddAndDel(t *testing.T) {
+	h := testkit.New(t)
+	h.Use(middlewares.NewAccessMiddleware)
+
+	h.Send(testkit.NewMessage("#access -p gpt add").From(testkit.Admin).InGroup("g1"))
+	h.AssertSentContains("添加权限成功")
+	if v, _ := h.KV.Get("access:g1"); v != "1" {
+		t.Fatalf("access of g1 = %q, want 1", v)
+	}
+
+	h.Send(testkit.NewMessage("#access -p gpt -u g1 del").From(testkit.Admin))
+	h.AssertSentContains("删除权限成功")
+	if v, _ := h.KV.Get("access:g1"); v != "0" {
+		t.Fatalf("access of g1 = %q, want 0", v)
+	}
+}
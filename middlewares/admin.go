@@ -1,20 +1,29 @@
 package middlewares
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"focalors-go/contract"
+	"focalors-go/db"
 	"log/slog"
+	"maps"
+	"slices"
 	"strings"
 )
 
+// usageTopUsers is how many users are listed under each target in the usage report
+const usageTopUsers = 3
+
 type adminMiddleware struct {
 	*MiddlewareContext
+	usage *db.UsageStore
 }
 
 func NewAdminMiddleware(base *MiddlewareContext) Middleware {
 	return &adminMiddleware{
 		MiddlewareContext: base,
+		usage:             db.NewUsageStore(base.kv),
 	}
 }
 
@@ -24,7 +33,7 @@ func (a *adminMiddleware) OnMessage(ctx context.Context, msg contract.GenericMes
 	}
 	if fs := contract.ToFlagSet(msg, "admin"); fs != nil {
 		var topic string
-		fs.StringVar(&topic, "s", "", "topic: cron, access")
+		fs.StringVar(&topic, "s", "", "topic: cron, access, usage")
 		if help := fs.Parse(); help != "" {
 			a.SendText(msg, help)
 			return true
@@ -34,6 +43,8 @@ func (a *adminMiddleware) OnMessage(ctx context.Context, msg contract.GenericMes
 			return a.onCronTask(msg)
 		case "access":
 			return a.onAdminMessage(msg)
+		case "usage":
+			return a.onUsage(msg)
 		default:
 			a.SendText(msg, "未知主题")
 			return true
@@ -116,3 +127,92 @@ func (a *adminMiddleware) onCronTask(msg contract.GenericMessage) bool {
 	a.SendText(msg, text.String())
 	return true
 }
+
+func (a *adminMiddleware) onUsage(msg contract.GenericMessage) bool {
+	today, err := a.usage.ListToday()
+	if err != nil {
+		logger.Warn("Failed to list token usage", slog.Any("error", err))
+		a.SendText(msg, "获取用量失败")
+		return true
+	}
+	month, err := a.usage.ListThisMonth()
+	if err != nil {
+		logger.Warn("Failed to list token usage", slog.Any("error", err))
+		a.SendText(msg, "获取用量失败")
+		return true
+	}
+	if len(month) == 0 {
+		a.SendText(msg, "本月还没有 GPT 用量")
+		return true
+	}
+
+	// targets of today are always part of the month
+	ids := make([]string, 0, len(month))
+	for target, usage := range month {
+		ids = append(ids, target)
+		ids = append(ids, slices.Collect(maps.Keys(usage.Users))...)
+	}
+	var nicknameMap = make(map[string]string, len(ids))
+	if contacts, err := a.client.GetContactDetail(ids...); err != nil {
+		logger.Warn("Failed to get contact details", slog.Any("error", err))
+	} else {
+		for _, contact := range contacts {
+			nicknameMap[contact.Username()] = contact.Nickname()
+		}
+	}
+	nickname := func(id string) string {
+		if name := nicknameMap[id]; name != "" && name != id {
+			return fmt.Sprintf("%s(%s)", name, id)
+		}
+		return id
+	}
+
+	var text strings.Builder
+	writeUsage(&text, "📊 今日用量", today, nickname)
+	text.WriteString("\n")
+	writeUsage(&text, "📅 本月用量", month, nickname)
+	a.SendText(msg, strings.TrimSpace(text.String()))
+	return true
+}
+
+// writeUsage writes the total, then every target with its top users, the largest first
+func writeUsage(text *strings.Builder, title string, usages map[string]*db.Usage, nickname func(id string) string) {
+	var total, requests int64
+	for _, usage := range usages {
+		total += usage.Total()
+		requests += usage.Requests
+	}
+	text.WriteString(fmt.Sprintf("%s: %s tokens / %d 次\n", title, formatTokens(total), requests))
+
+	targets := slices.SortedFunc(maps.Keys(usages), func(a, b string) int {
+		return cmp.Compare(usages[b].Total(), usages[a].Total())
+	})
+	for _, target := range targets {
+		usage := usages[target]
+		text.WriteString(fmt.Sprintf("• %s: %s tokens / %d 次\n", nickname(target), formatTokens(usage.Total()), usage.Requests))
+		users := slices.SortedFunc(maps.Keys(usage.Users), func(a, b string) int {
+			return cmp.Compare(usage.Users[b], usage.Users[a])
+		})
+		// a private chat has only the user itself
+		if len(users) <= 1 && (len(users) == 0 || users[0] == target) {
+			continue
+		}
+		var tops []string
+		for _, user := range users[:min(len(users), usageTopUsers)] {
+			tops = append(tops, fmt.Sprintf("%s %s", nickname(user), formatTokens(usage.Users[user])))
+		}
+		text.WriteString(fmt.Sprintf("   👤 %s\n", strings.Join(tops, " · ")))
+	}
+}
+
+// formatTokens shortens token counts, e.g. 12345 -> 12.3k
+func formatTokens(tokens int64) string {
+	switch {
+	case tokens >= 1_000_000:
+		return fmt.Sprintf("%.2fM", float64(tokens)/1_000_000)
+	case tokens >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(tokens)/1_000)
+	default:
+		return fmt.Sprint(tokens)
+	}
+}
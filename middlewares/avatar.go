@@ -48,13 +48,13 @@ func (a *avatarMiddleware) handleAvatarCommand(msg contract.GenericMessage) bool
 	sessionKey := avatarSessionPrefix + userId
 
 	// Don't allow creating another session if one is already active
-	if existing, _ := a.redis.Get(sessionKey); existing != "" {
+	if existing, _ := a.kv.Get(sessionKey); existing != "" {
 		a.SendText(msg, "你已经有一个上传会话进行中，请发送图片或等待超时")
 		return true
 	}
 
 	// Create a session with 1 minute timeout
-	if err := a.redis.Set(sessionKey, "pending", avatarSessionTTL); err != nil {
+	if err := a.kv.Set(sessionKey, "pending", avatarSessionTTL); err != nil {
 		logger.Error("Failed to create avatar session", slog.Any("error", err))
 		a.SendText(msg, "创建上传会话失败，请稍后重试")
 		return true
@@ -66,8 +66,8 @@ func (a *avatarMiddleware) handleAvatarCommand(msg contract.GenericMessage) bool
 	go func() {
 		time.Sleep(avatarSessionTTL)
 		// Check if session is still pending (not consumed by an upload)
-		if val, _ := a.redis.Get(sessionKey); val != "" {
-			a.redis.Del(sessionKey)
+		if val, _ := a.kv.Get(sessionKey); val != "" {
+			a.kv.Del(sessionKey)
 			a.SendText(msg, "上传头像会话已超时，请重新发送 #上传头像")
 		}
 	}()
@@ -85,7 +85,7 @@ func (a *avatarMiddleware) handleAvatarUpload(msg contract.GenericMessage) bool
 	sessionKey := avatarSessionPrefix + userId
 
 	// Check if user has an active session
-	val, err := a.redis.Get(sessionKey)
+	val, err := a.kv.Get(sessionKey)
 	if err != nil || val == "" {
 		return false
 	}
@@ -113,7 +113,7 @@ func (a *avatarMiddleware) handleAvatarUpload(msg contract.GenericMessage) bool
 	}
 
 	// Clear the session
-	if err := a.redis.Del(sessionKey); err != nil {
+	if err := a.kv.Del(sessionKey); err != nil {
 		logger.Warn("Failed to clear avatar session", slog.Any("error", err))
 	}
 
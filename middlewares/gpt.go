@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"focalors-go/contract"
+	"focalors-go/service"
+	"log/slog"
+)
+
+const gptUsage = "用法: #gpt reset  清空与我的对话记忆"
+
+// gptCommandMiddleware handles the "#gpt" and "#tool" commands. It runs before the Yunzai bridge,
+// which takes all other "#" commands, while the OpenAI middleware answering mentions comes last.
+type gptCommandMiddleware struct {
+	*MiddlewareContext
+	toggles *service.ToolToggleService
+}
+
+func NewGptCommandMiddleware(base *MiddlewareContext) Middleware {
+	if !base.cfg.OpenAI.Enabled() {
+		return nil
+	}
+	return &gptCommandMiddleware{
+		MiddlewareContext: base,
+		toggles:           service.NewToolToggleService(base.kv),
+	}
+}
+
+func (g *gptCommandMiddleware) OnMessage(ctx context.Context, msg contract.GenericMessage) bool {
+	if fs := contract.ToFlagSet(msg, "gpt"); fs != nil {
+		return g.onGptCommand(msg, fs)
+	}
+	if fs := contract.ToFlagSet(msg, "tool"); fs != nil {
+		return g.onToolCommand(msg, fs)
+	}
+	return false
+}
+
+// onGptCommand handles "#gpt reset"
+func (g *gptCommandMiddleware) onGptCommand(msg contract.GenericMessage, fs *contract.MessageFlagSet) bool {
+	if ok, _ := g.access.HasAccess(msg.GetTarget(), service.GPTAccess); !ok {
+		return false
+	}
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), gptUsage)
+	}
+	if help := fs.Parse(); help != "" {
+		g.SendText(msg, help)
+		return true
+	}
+	switch fs.Rest() {
+	case "reset":
+		if err := g.conversations.Reset(msg.GetTarget(), conversationUser(msg)); err != nil {
+			logger.Error("Failed to reset conversation", slog.Any("error", err))
+			g.SendText(msg, "清空对话记忆失败，请稍后重试")
+			return true
+		}
+		g.SendText(msg, "对话记忆已清空")
+	default:
+		g.SendText(msg, gptUsage)
+	}
+	return true
+}
@@ -9,6 +9,7 @@ import (
 	"focalors-go/scheduler"
 	"focalors-go/service"
 	"focalors-go/slogger"
+	"focalors-go/tooling"
 	"log/slog"
 )
 
@@ -21,28 +22,36 @@ type Middleware interface {
 }
 
 type MiddlewareContext struct {
-	redis       *db.Redis
+	kv          db.KV
 	cron        *scheduler.CronTask
 	cfg         *config.Config
 	access      *service.AccessService
 	ctx         context.Context
 	client      contract.GenericClient
 	avatarStore *db.AvatarStore
+	// GPT tools, registered by the OpenAI middleware and managed by the #tool command
+	tools *tooling.Registry
+	// GPT conversations, shared so that appends of one conversation are serialized
+	conversations *db.ConversationStore
 }
 
-func NewMiddlewareContext(ctx context.Context, client contract.GenericClient, cfg *config.Config, redis *db.Redis) *MiddlewareContext {
-	cron := scheduler.NewCronTask(redis)
-	access := service.NewAccessService(redis, cfg.App.Admin)
+func NewMiddlewareContext(ctx context.Context, client contract.GenericClient, cfg *config.Config, kv db.KV) *MiddlewareContext {
+	cron := scheduler.NewCronTask(kv)
+	access := service.NewAccessService(kv, cfg.App.Admin)
 	// init
 	cron.Start()
 	return &MiddlewareContext{
-		redis:       redis,
+		kv:          kv,
 		cron:        cron,
 		cfg:         cfg,
 		access:      access,
 		ctx:         ctx,
 		client:      client,
-		avatarStore: db.NewAvatarStore(redis),
+		avatarStore: db.NewAvatarStore(kv),
+		tools:       tooling.NewRegistry(access, service.NewToolToggleService(kv)),
+		conversations: db.NewConversationStore(
+			kv, cfg.OpenAI.MemoryTurns, cfg.OpenAI.MemoryTokens, cfg.OpenAI.MemoryTTL,
+		),
 	}
 }
 
@@ -100,6 +109,15 @@ func (p *PendingSender) SendRichCard(card *contract.CardBuilder) (string, error)
 	return p.sendNewCard(card)
 }
 
+// UpdatePending updates the pending card in place and keeps it pending, e.g. to show progress.
+// Returns an error if there is no pending card or the platform can not update cards.
+func (p *PendingSender) UpdatePending(card *contract.CardBuilder) error {
+	if p.pendingMsgId == "" {
+		return fmt.Errorf("no pending message")
+	}
+	return p.client.UpdateRichCard(p.pendingMsgId, card)
+}
+
 func (p *PendingSender) sendNewCard(card *contract.CardBuilder) (string, error) {
 	if p.replyToMsgId != "" {
 		return p.client.ReplyRichCard(p.replyToMsgId, p.target, card)
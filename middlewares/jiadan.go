@@ -22,7 +22,7 @@ type jiadanMiddleware struct {
 func NewJiadanMiddleware(base *MiddlewareContext) Middleware {
 	return &jiadanMiddleware{
 		MiddlewareContext: base,
-		jiadan:            service.NewJiadanService(db.NewJiandanStore(base.redis)),
+		jiadan:            service.NewJiadanService(db.NewJiandanStore(base.kv)),
 	}
 }
 
@@ -2,54 +2,222 @@ package middlewares
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"focalors-go/config"
 	"focalors-go/contract"
 	"focalors-go/db"
+	"focalors-go/protocol/mcp"
 	"focalors-go/service"
 	"focalors-go/tooling"
 	"log/slog"
 	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/azure"
+	"github.com/openai/openai-go/option"
+)
+
+// streamUpdateInterval throttles the progressive updates of the pending card while streaming
+const streamUpdateInterval = 500 * time.Millisecond
+
+// mcpConnectTimeout bounds the startup and tool discovery of each MCP server
+const mcpConnectTimeout = 30 * time.Second
+
+const (
+	visionSessionPrefix = "gpt:vision:"
+	// how long an image sent after mentioning the bot in a group is still answered
+	visionSessionTTL    = 1 * time.Minute
+	visionMaxImages     = 4
+	visionDefaultPrompt = "请看看这张图片"
 )
 
 type OpenAIMiddleware struct {
 	*MiddlewareContext
-	openai   *openai.Client
-	registry *tooling.Registry
+	openai     *openai.Client
+	registry   *tooling.Registry
+	personas   *service.PersonaService
+	usage      *db.UsageStore
+	mcpClients []*mcp.Client
 }
 
 func NewOpenAIMiddleware(base *MiddlewareContext) Middleware {
-	if base.cfg.OpenAI.APIKey == "" || base.cfg.OpenAI.Endpoint == "" {
+	if !base.cfg.OpenAI.Enabled() {
 		return nil
 	}
 
-	client := openai.NewClient(
-		azure.WithEndpoint(base.cfg.OpenAI.Endpoint, base.cfg.OpenAI.APIVersion),
-		azure.WithAPIKey(base.cfg.OpenAI.APIKey),
-	)
+	client := newOpenAIClient(&base.cfg.OpenAI)
 
-	// Create tool registry and register tools
-	registry := tooling.NewRegistry()
+	// Register tools in the shared registry
+	registry := base.tools
 	registry.Register(tooling.NewWeatherTool(service.NewWeatherService(&base.cfg.Weather)))
-	jiandanStore := db.NewJiandanStore(base.redis)
+	jiandanStore := db.NewJiandanStore(base.kv)
 	registry.Register(tooling.NewJiadanTool(service.NewJiadanService(jiandanStore)))
+	registry.Register(tooling.NewReminderTool(service.NewReminderService(base.cron, base.client)))
+	if base.cfg.OpenAI.ImageModel != "" {
+		registry.Register(tooling.NewImageTool(
+			service.NewImageService(&client, base.cfg.OpenAI.ImageModel),
+			db.NewQuotaStore(base.kv, "image"),
+			base.cfg.OpenAI.ImageDailyQuota,
+		))
+	}
 
 	return &OpenAIMiddleware{
 		MiddlewareContext: base,
 		openai:            &client,
 		registry:          registry,
+		personas:          service.NewPersonaService(base.kv),
+		usage:             db.NewUsageStore(base.kv),
 	}
 }
 
+// Start connects the configured MCP servers and registers their tools. A server failing to start
+// only loses its tools.
+func (o *OpenAIMiddleware) Start() error {
+	for i := range o.cfg.MCP {
+		server := &o.cfg.MCP[i]
+		ctx, cancel := context.WithTimeout(o.ctx, mcpConnectTimeout)
+		tools, err := o.connectMCP(ctx, server)
+		cancel()
+		if err != nil {
+			logger.Error("Failed to load MCP server", slog.String("name", server.Name), slog.Any("error", err))
+			continue
+		}
+		for _, tool := range tools {
+			o.registry.Register(tool)
+		}
+		logger.Info("MCP tools registered", slog.String("name", server.Name), slog.Int("tools", len(tools)))
+	}
+	return nil
+}
+
+func (o *OpenAIMiddleware) connectMCP(ctx context.Context, server *config.MCPServerConfig) ([]*tooling.MCPTool, error) {
+	client, err := mcp.Connect(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	tools, err := tooling.NewMCPTools(ctx, client, service.NewAccess(server.Access))
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	o.mcpClients = append(o.mcpClients, client)
+	return tools, nil
+}
+
+func (o *OpenAIMiddleware) Stop() error {
+	for _, client := range o.mcpClients {
+		if err := client.Close(); err != nil {
+			logger.Warn("Failed to close MCP client", slog.String("name", client.Name()), slog.Any("error", err))
+		}
+	}
+	return nil
+}
+
+// newOpenAIClient creates the client of the configured provider
+func newOpenAIClient(cfg *config.OpenAIConfig) openai.Client {
+	var opts []option.RequestOption
+	switch cfg.Provider {
+	case config.OpenAIProviderOpenAI, config.OpenAIProviderCompatible:
+		if cfg.BaseURL != "" {
+			opts = append(opts, option.WithBaseURL(cfg.BaseURL))
+		}
+		if cfg.APIKey != "" {
+			opts = append(opts, option.WithAPIKey(cfg.APIKey))
+		}
+	default:
+		opts = append(opts,
+			azure.WithEndpoint(cfg.Endpoint, cfg.APIVersion),
+			azure.WithAPIKey(cfg.APIKey),
+		)
+	}
+	for name, value := range cfg.Headers {
+		opts = append(opts, option.WithHeader(name, value))
+	}
+	return openai.NewClient(opts...)
+}
+
+// systemPrompt renders the persona of the target, or the default prompt if none is set
+func (o *OpenAIMiddleware) systemPrompt(msg contract.GenericMessage) string {
+	prompt, err := o.personas.Get(msg.GetTarget())
+	if err != nil {
+		logger.Warn("Failed to get persona", slog.Any("error", err))
+	}
+	if prompt == "" {
+		prompt = o.cfg.OpenAI.SystemPrompt
+	}
+	if prompt == "" {
+		return ""
+	}
+
+	// contact lookups are only worth it if the prompt uses them
+	var groupName, nickname string
+	if msg.IsGroup() && strings.Contains(prompt, ".GroupName") {
+		if contacts, err := o.client.GetContactDetail(msg.GetGroupId()); err == nil && len(contacts) > 0 {
+			groupName = contacts[0].Nickname()
+		}
+	}
+	if strings.Contains(prompt, ".Nickname") {
+		nickname = msg.GetUserId()
+		if contacts, err := o.client.GetContactDetail(msg.GetUserId()); err == nil && len(contacts) > 0 {
+			nickname = contacts[0].Nickname()
+		}
+	}
+	rendered, err := service.RenderPrompt(prompt, service.NewPromptVars(time.Now(), groupName, nickname))
+	if err != nil {
+		logger.Warn("Failed to render system prompt", slog.Any("error", err))
+		return prompt
+	}
+	return rendered
+}
+
+// quotaExceeded returns the message explaining why the target may not ask anymore, empty if it may.
+// Admins are never limited, even in a group that used up its quota.
+func (m *MiddlewareContext) quotaExceeded(store *db.UsageStore, target, userId string) string {
+	if m.access.IsAdmin(userId) {
+		return ""
+	}
+	if limit := m.cfg.OpenAI.DailyTokenLimit; limit > 0 {
+		usage, err := store.Today(target)
+		if err != nil {
+			logger.Warn("Failed to get token usage", slog.Any("error", err))
+		} else if usage.Total() >= limit {
+			return "今天的 GPT 额度已经用完啦，明天再来找我聊天吧~"
+		}
+	}
+	if limit := m.cfg.OpenAI.MonthlyTokenLimit; limit > 0 {
+		usage, err := store.ThisMonth(target)
+		if err != nil {
+			logger.Warn("Failed to get token usage", slog.Any("error", err))
+		} else if usage.Total() >= limit {
+			return "本月的 GPT 额度已经用完啦，下个月再见~"
+		}
+	}
+	return ""
+}
+
+// conversationUser separates the conversations of group members, a private chat is one conversation
+func conversationUser(msg contract.GenericMessage) string {
+	if msg.IsGroup() {
+		return msg.GetUserId()
+	}
+	return ""
+}
+
 func (o *OpenAIMiddleware) OnMessage(ctx context.Context, msg contract.GenericMessage) bool {
-	logger.Info("OAI check", slog.Bool("isText", msg.IsText()), slog.String("text", msg.GetText()), slog.Bool("isMentioned", contract.IsMentioned(msg, o.client.GetSelfUserId())))
+	logger.Info("OAI check", slog.Bool("isText", msg.IsText()), slog.String("text", msg.GetText()), slog.Bool("isMentioned", contract.IsMentioned(msg, contract.GetSelfUserIdFor(o.client, msg.GetTarget()))))
 
-	if !msg.IsText() || msg.GetText() == "" {
+	if msg.IsImage() {
+		return o.onImageMessage(ctx, msg)
+	}
+	if !msg.IsText() {
 		return false
 	}
-	selfId := o.client.GetSelfUserId()
+	selfId := contract.GetSelfUserIdFor(o.client, msg.GetTarget())
 	referMessage, ok := msg.GetReferMessage()
 	// In group chats, only respond if mentioned or if it's a reply to the bot
 	if msg.IsGroup() {
@@ -65,25 +233,78 @@ func (o *OpenAIMiddleware) OnMessage(ctx context.Context, msg contract.GenericMe
 		return false
 	}
 
-	content := msg.GetText()
-	logger.Info("Received message for OpenAI", slog.String("content", content))
+	quotesImage := ok && referMessage.IsImage() && o.cfg.OpenAI.Vision
+	if msg.GetText() == "" && quotesImage {
+		// a bare mention quoting an image asks about it
+		return o.respond(ctx, msg, visionDefaultPrompt, nil)
+	}
+	if msg.IsGroup() && o.cfg.OpenAI.Vision && !quotesImage {
+		// the user may send the image to look at right after the mention
+		if err := o.kv.Set(visionSessionKey(msg), "pending", visionSessionTTL); err != nil {
+			logger.Warn("Failed to create vision session", slog.Any("error", err))
+		}
+	}
+	if msg.GetText() == "" {
+		// a bare mention only waits for an image
+		return msg.IsGroup()
+	}
+	return o.respond(ctx, msg, msg.GetText(), nil)
+}
 
-	sender := o.SendPendingReply(msg)
+func visionSessionKey(msg contract.GenericMessage) string {
+	return fmt.Sprintf("%s%s:%s", visionSessionPrefix, msg.GetTarget(), msg.GetUserId())
+}
 
-	// get thread
-	messages := []openai.ChatCompletionMessageParamUnion{
-		openai.UserMessage(content),
+// onImageMessage answers images sent right after mentioning the bot in groups, and images sent in
+// private chats with visionPrivate on. Other images are only seen when quoted.
+func (o *OpenAIMiddleware) onImageMessage(ctx context.Context, msg contract.GenericMessage) bool {
+	if !o.cfg.OpenAI.Vision {
+		return false
+	}
+	if !msg.IsGroup() && !o.cfg.OpenAI.VisionPrivate {
+		return false
+	}
+	if msg.IsGroup() {
+		key := visionSessionKey(msg)
+		if ok, _ := o.kv.Exists(key); !ok {
+			return false
+		}
+		if err := o.kv.Del(key); err != nil {
+			logger.Warn("Failed to clear vision session", slog.Any("error", err))
+		}
+	}
+	if ok, _ := o.access.HasAccess(msg.GetTarget(), service.GPTAccess); !ok {
+		return false
 	}
+	return o.respond(ctx, msg, visionDefaultPrompt, []string{msg.GetId()})
+}
+
+// respond answers the question content, imageIds are the messages whose images are shown to the model
+// along with the images found in the reply chain
+func (o *OpenAIMiddleware) respond(ctx context.Context, msg contract.GenericMessage, content string, imageIds []string) bool {
+	logger.Info("Received message for OpenAI", slog.String("content", content))
+
+	if reason := o.quotaExceeded(o.usage, msg.GetTarget(), msg.GetUserId()); reason != "" {
+		o.SendText(msg, reason)
+		return true
+	}
+
+	sender := o.SendPendingReply(msg)
+	selfId := contract.GetSelfUserIdFor(o.client, msg.GetTarget())
+	referMessage, ok := msg.GetReferMessage()
 
 	// Walk the reply chain to build conversation thread (up to 10 messages)
+	var thread []db.Turn
 	for i := 0; referMessage != nil && i < 10; i++ {
 		if text := referMessage.GetText(); text != "" {
 			logger.Debug("ReferredText", slog.String("text", text), slog.String("userid", referMessage.GetUserId()))
 			if referMessage.GetUserId() == selfId {
-				messages = append(messages, openai.AssistantMessage(text))
+				thread = append(thread, db.Turn{Role: "assistant", Content: text})
 			} else {
-				messages = append(messages, openai.UserMessage(text))
+				thread = append(thread, db.Turn{Role: "user", Content: text})
 			}
+		} else if referMessage.IsImage() && o.cfg.OpenAI.Vision && len(imageIds) < visionMaxImages {
+			imageIds = append(imageIds, referMessage.GetId())
 		}
 		referMessage, ok = referMessage.GetReferMessage()
 		logger.Debug("Walking reply chain", slog.Int("depth", i), slog.Bool("hasRefer", ok))
@@ -91,15 +312,64 @@ func (o *OpenAIMiddleware) OnMessage(ctx context.Context, msg contract.GenericMe
 			break
 		}
 	}
-	slices.Reverse(messages)
+	slices.Reverse(thread)
+
+	// Remembered turns come first, the reply chain may quote some of them again
+	history, err := o.conversations.Load(msg.GetTarget(), conversationUser(msg))
+	if err != nil {
+		logger.Warn("Failed to load conversation", slog.Any("error", err))
+	}
+	remembered := make(map[string]bool, len(history))
+	var messages []openai.ChatCompletionMessageParamUnion
+	if prompt := o.systemPrompt(msg); prompt != "" {
+		messages = append(messages, openai.SystemMessage(prompt))
+	}
+	for _, turn := range history {
+		remembered[turn.Content] = true
+		messages = append(messages, turnMessage(turn))
+	}
+	for _, turn := range thread {
+		if !remembered[turn.Content] {
+			messages = append(messages, turnMessage(turn))
+		}
+	}
+	images := o.loadImages(imageIds)
+	if len(images) > 0 {
+		parts := append([]openai.ChatCompletionContentPartUnionParam{openai.TextContentPart(content)}, images...)
+		messages = append(messages, openai.UserMessage(parts))
+	} else {
+		messages = append(messages, openai.UserMessage(content))
+	}
 	// Add target to context for tools
-	toolCtx := tooling.WithTarget(ctx, msg.GetTarget())
-	response, contents, err := o.onTextMode(toolCtx, messages)
+	toolCtx := tooling.WithGroup(tooling.WithUser(tooling.WithTarget(ctx, msg.GetTarget()), msg.GetUserId()), msg.IsGroup())
+	response, contents, err := o.onTextMode(toolCtx, messages, newStreamUpdater(sender).OnDelta)
 
 	if err != nil {
-		sender.SendMarkdown(fmt.Sprintf("糟糕，%s", err.Error()))
+		logger.Error("OpenAI request failed", slog.Any("error", err), slog.Int("contents", len(contents)))
+		reason := err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			reason = "回答超时了"
+		}
+		if len(contents) == 0 {
+			sender.SendMarkdown(fmt.Sprintf("糟糕，%s", reason))
+			return true
+		}
+		// show what the tools already fetched rather than dropping it
+		card := contract.NewCardBuilder().AddMarkdown(fmt.Sprintf("糟糕，%s。以下是已获取的内容：", reason))
+		o.addToolContents(card, contents)
+		sender.SendRichCard(card)
 		return true
 	}
+	if len(images) > 0 {
+		// only text is remembered
+		content = "[图片] " + content
+	}
+	if err := o.conversations.Append(msg.GetTarget(), conversationUser(msg),
+		db.Turn{Role: "user", Content: content},
+		db.Turn{Role: "assistant", Content: response},
+	); err != nil {
+		logger.Warn("Failed to save conversation", slog.Any("error", err))
+	}
 
 	// Build card with response and any content from tools
 	card := contract.NewCardBuilder()
@@ -107,6 +377,14 @@ func (o *OpenAIMiddleware) OnMessage(ctx context.Context, msg contract.GenericMe
 	if !slices.ContainsFunc(contents, func(c tooling.Content) bool { return c.ToolName == "jiandan_top" }) {
 		card.AddMarkdown(response)
 	}
+	o.addToolContents(card, contents)
+	logger.Debug("sending response card", slog.Any("card", card))
+	sender.SendRichCard(card)
+	return true
+}
+
+// addToolContents appends the texts and images produced by tools to the card
+func (o *OpenAIMiddleware) addToolContents(card *contract.CardBuilder, contents []tooling.Content) {
 	for _, content := range contents {
 		switch content.Type {
 		case tooling.ContentText:
@@ -136,49 +414,153 @@ func (o *OpenAIMiddleware) OnMessage(ctx context.Context, msg contract.GenericMe
 			logger.Warn("unimplemented content type", slog.Any("type", content.Type), slog.String("tool", content.ToolName))
 		}
 	}
-	logger.Debug("sending response card", slog.Any("card", card))
-	sender.SendRichCard(card)
-	return true
 }
 
-func (o *OpenAIMiddleware) onTextMode(ctx context.Context, messages []openai.ChatCompletionMessageParamUnion) (string, []tooling.Content, error) {
-	logger.Info("Sending message to OpenAI", slog.Any("messages", messages))
-	params := openai.ChatCompletionNewParams{
-		Model:     openai.ChatModel(o.cfg.OpenAI.Deployment),
-		Messages:  messages,
-		MaxTokens: openai.Int(2048),
-		Tools:     o.registry.Definitions(),
+// loadImages downloads the images of the messages as content parts, skipping the ones that fail or exceed
+// the size limit, and downscales them to save tokens
+func (o *OpenAIMiddleware) loadImages(msgIds []string) []openai.ChatCompletionContentPartUnionParam {
+	var parts []openai.ChatCompletionContentPartUnionParam
+	for _, msgId := range msgIds {
+		content, err := o.client.DownloadMessageImage(msgId)
+		if err != nil {
+			logger.Warn("Failed to download image for OpenAI", slog.String("msgId", msgId), slog.Any("error", err))
+			continue
+		}
+		if size := base64.StdEncoding.DecodedLen(len(content)); o.cfg.OpenAI.VisionMaxSize > 0 && size > o.cfg.OpenAI.VisionMaxSize {
+			logger.Warn("Image too large for OpenAI", slog.String("msgId", msgId), slog.Int("size", size))
+			continue
+		}
+		content, mime, err := db.DownscaleImage(content, o.cfg.OpenAI.VisionMaxSide)
+		if err != nil {
+			logger.Warn("Failed to downscale image for OpenAI", slog.String("msgId", msgId), slog.Any("error", err))
+			continue
+		}
+		parts = append(parts, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+			URL: fmt.Sprintf("data:%s;base64,%s", mime, content),
+		}))
 	}
+	return parts
+}
 
-	completion, err := o.openai.Chat.Completions.New(ctx, params)
-	if err != nil {
-		return "", nil, err
+func turnMessage(turn db.Turn) openai.ChatCompletionMessageParamUnion {
+	if turn.Role == "assistant" {
+		return openai.AssistantMessage(turn.Content)
+	}
+	return openai.UserMessage(turn.Content)
+}
+
+// streamUpdater shows the partial answer in the pending card while the completion streams in
+type streamUpdater struct {
+	sender     *PendingSender
+	lastUpdate time.Time
+	disabled   bool
+}
+
+func newStreamUpdater(sender *PendingSender) *streamUpdater {
+	return &streamUpdater{sender: sender, lastUpdate: time.Now()}
+}
+
+// OnDelta receives the text streamed so far and updates the pending card at most every streamUpdateInterval
+func (s *streamUpdater) OnDelta(text string) {
+	if s.disabled || strings.TrimSpace(text) == "" || time.Since(s.lastUpdate) < streamUpdateInterval {
+		return
+	}
+	s.lastUpdate = time.Now()
+	if err := s.sender.UpdatePending(contract.NewCardBuilder().AddMarkdown(text + " ▍")); err != nil {
+		// platforms without card updates (e.g. WeChat) get the final answer in one message
+		logger.Debug("progressive update unavailable, waiting for the full answer", slog.Any("error", err))
+		s.disabled = true
+	}
+}
+
+// streamCompletion runs a streaming chat completion, calling onDelta with the content received so far
+func (o *OpenAIMiddleware) streamCompletion(ctx context.Context, params openai.ChatCompletionNewParams, onDelta func(text string)) (*openai.ChatCompletionMessage, error) {
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+	stream := o.openai.Chat.Completions.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	acc := openai.ChatCompletionAccumulator{}
+	for stream.Next() {
+		chunk := stream.Current()
+		acc.AddChunk(chunk)
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" && len(acc.Choices) > 0 {
+			onDelta(acc.Choices[0].Message.Content)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+	if err := o.usage.Record(tooling.GetTarget(ctx), tooling.GetUser(ctx), acc.Usage.PromptTokens, acc.Usage.CompletionTokens); err != nil {
+		logger.Warn("Failed to record token usage", slog.Any("error", err))
+	}
+	if len(acc.Choices) == 0 {
+		return nil, fmt.Errorf("empty completion")
+	}
+	return &acc.Choices[0].Message, nil
+}
+
+// onTextMode runs the tool calling loop: every round executes the requested tools in parallel and feeds
+// the results back, until the model answers without tools. After MaxToolRounds rounds the tools are
+// withdrawn to force an answer. On failure the contents of the tools already executed are returned too.
+func (o *OpenAIMiddleware) onTextMode(ctx context.Context, messages []openai.ChatCompletionMessageParamUnion, onDelta func(text string)) (string, []tooling.Content, error) {
+	if o.cfg.OpenAI.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.cfg.OpenAI.RequestTimeout)
+		defer cancel()
 	}
-	toolCalls := completion.Choices[0].Message.ToolCalls
 
-	// Return early if there are no tool calls
-	if len(toolCalls) == 0 {
-		return completion.Choices[0].Message.Content, nil, nil
+	logger.Info("Sending message to OpenAI", slog.Any("messages", messages))
+	params := openai.ChatCompletionNewParams{
+		Model:     openai.ChatModel(o.cfg.OpenAI.ModelName()),
+		Messages:  messages,
+		MaxTokens: openai.Int(2048),
 	}
 
 	// Collect contents from tool results
 	var allContents []tooling.Content
+	for round := 0; ; round++ {
+		if round < o.cfg.OpenAI.MaxToolRounds {
+			params.Tools = o.registry.Definitions(ctx)
+		} else {
+			params.Tools = nil
+		}
 
-	// If there were tool calls, execute them and continue the conversation
-	params.Messages = append(params.Messages, completion.Choices[0].Message.ToParam())
-	for _, toolCall := range toolCalls {
-		result, err := o.registry.Execute(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
+		message, err := o.streamCompletion(ctx, params, onDelta)
 		if err != nil {
-			logger.Error("Tool execution failed", slog.String("tool", toolCall.Function.Name), slog.Any("error", err))
-			result = &tooling.ToolResult{Text: fmt.Sprintf("Tool error: %s", err.Error())}
+			return "", allContents, err
+		}
+		if len(message.ToolCalls) == 0 {
+			return message.Content, allContents, nil
+		}
+
+		logger.Info("Executing tool calls", slog.Int("round", round+1), slog.Int("calls", len(message.ToolCalls)))
+		params.Messages = append(params.Messages, message.ToParam())
+		for i, result := range o.executeToolCalls(ctx, message.ToolCalls) {
+			params.Messages = append(params.Messages, openai.ToolMessage(result.Text, message.ToolCalls[i].ID))
+			allContents = append(allContents, result.Contents...)
+		}
+		if err := ctx.Err(); err != nil {
+			return "", allContents, err
 		}
-		params.Messages = append(params.Messages, openai.ToolMessage(result.Text, toolCall.ID))
-		allContents = append(allContents, result.Contents...)
 	}
+}
 
-	completion, err = o.openai.Chat.Completions.New(ctx, params)
-	if err != nil {
-		return "", nil, err
+// executeToolCalls runs the tool calls of one round concurrently, results keep the order of the calls
+func (o *OpenAIMiddleware) executeToolCalls(ctx context.Context, toolCalls []openai.ChatCompletionMessageToolCall) []*tooling.ToolResult {
+	results := make([]*tooling.ToolResult, len(toolCalls))
+	var wg sync.WaitGroup
+	for i, toolCall := range toolCalls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := o.registry.Execute(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
+			if err != nil {
+				logger.Error("Tool execution failed", slog.String("tool", toolCall.Function.Name), slog.Any("error", err))
+				result = &tooling.ToolResult{Text: fmt.Sprintf("Tool error: %s", err.Error())}
+			}
+			results[i] = result
+		}()
 	}
-	return completion.Choices[0].Message.Content, allContents, nil
+	wg.Wait()
+	return results
 }
@@ -0,0 +1,356 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"focalors-go/config"
+	"focalors-go/db"
+	"focalors-go/middlewares"
+	"focalors-go/middlewares/testkit"
+	"focalors-go/protocol/mcp/mcptest"
+)
+
+// completionServer is a stub chat completions endpoint, reply decides the answer of every request,
+// streamed unless the request asks for a plain completion
+type completionServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []map[string]any
+}
+
+// chunk is the delta of a streamed answer, either content or a tool call
+type chunk struct {
+	content  string
+	toolName string
+	toolArgs string
+}
+
+// generatedImage is the image drawn by the images endpoint of the completion server
+const generatedImage = "aW1n"
+
+func newCompletionServer(t *testing.T, reply func(n int, request map[string]any) []chunk) *completionServer {
+	s := &completionServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/images/generations") {
+			// the drawing tool gets a fixed image
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"created": 1, "data": []map[string]any{{"b64_json": generatedImage}}})
+			return
+		}
+		raw, _ := io.ReadAll(r.Body)
+		var request map[string]any
+		if err := json.Unmarshal(raw, &request); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, request)
+		n := len(s.requests)
+		s.mu.Unlock()
+
+		if stream, _ := request["stream"].(bool); !stream {
+			// plain completions answer with the content of all chunks at once
+			var content strings.Builder
+			for _, c := range reply(n, request) {
+				content.WriteString(c.content)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"id": "c", "object": "chat.completion", "model": "m",
+				"choices": []map[string]any{{"index": 0, "finish_reason": "stop",
+					"message": map[string]any{"role": "assistant", "content": content.String()}}},
+				"usage": map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		write := func(v any) {
+			data, _ := json.Marshal(v)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		finish := "stop"
+		for i, c := range reply(n, request) {
+			delta := map[string]any{"role": "assistant"}
+			if c.toolName != "" {
+				finish = "tool_calls"
+				delta["tool_calls"] = []map[string]any{{
+					"index": i, "id": fmt.Sprintf("call_%d", i), "type": "function",
+					"function": map[string]any{"name": c.toolName, "arguments": c.toolArgs},
+				}}
+			} else {
+				delta["content"] = c.content
+			}
+			write(map[string]any{"id": "c", "object": "chat.completion.chunk", "model": "m",
+				"choices": []map[string]any{{"index": 0, "delta": delta}}})
+		}
+		write(map[string]any{"id": "c", "object": "chat.completion.chunk", "model": "m",
+			"choices": []map[string]any{{"index": 0, "delta": map[string]any{}, "finish_reason": finish}}})
+		write(map[string]any{"id": "c", "object": "chat.completion.chunk", "model": "m", "choices": []any{},
+			"usage": map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}})
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *completionServer) request(i int) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[i]
+}
+
+func (s *completionServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func newOpenAIHarness(t *testing.T, server *completionServer, options ...func(cfg *config.Config)) *testkit.Harness {
+	h := testkit.New(t, append([]func(cfg *config.Config){func(cfg *config.Config) {
+		cfg.OpenAI.Provider = config.OpenAIProviderCompatible
+		cfg.OpenAI.BaseURL = server.URL
+		cfg.OpenAI.Model = "m"
+	}}, options...)...)
+	h.KV.Set("access:u1", "1", 0)
+	h.Use(middlewares.NewGptCommandMiddleware, middlewares.NewOpenAIMiddleware)
+	return h
+}
+
+func TestOpenAIStreamsAnswer(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		return []chunk{{content: "Hello"}, {content: ", world"}}
+	})
+	h := newOpenAIHarness(t, server)
+
+	h.Send(testkit.NewMessage("hi").From("u1"))
+	h.AssertUpdatedContains(h.LastSent().Id, "Hello, world")
+
+	// the answer is remembered for the next question
+	h.Send(testkit.NewMessage("again").From("u1"))
+	h.WaitSent(2)
+	h.AssertUpdatedContains(h.LastSent().Id, "Hello, world")
+	messages := server.request(1)["messages"].([]any)
+	if len(messages) < 3 || !strings.Contains(fmt.Sprint(messages), "Hello, world") {
+		t.Errorf("the second request does not carry the conversation: %v", messages)
+	}
+	if v, _ := h.KV.Exists("gpt:conv:u1"); !v {
+		t.Error("conversation not stored")
+	}
+}
+
+func TestOpenAIToolLoop(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		if n == 1 {
+			return []chunk{{toolName: "reminder", toolArgs: `{"action":"list"}`}}
+		}
+		return []chunk{{content: "你没有提醒"}}
+	})
+	h := newOpenAIHarness(t, server)
+
+	h.Send(testkit.NewMessage("我有什么提醒").From("u1"))
+	h.AssertUpdatedContains(h.LastSent().Id, "你没有提醒")
+	if server.count() != 2 {
+		t.Fatalf("%d completions requested, want 2", server.count())
+	}
+	messages := server.request(1)["messages"].([]any)
+	last := messages[len(messages)-1].(map[string]any)
+	if last["role"] != "tool" || !strings.Contains(fmt.Sprint(last["content"]), "no reminders") {
+		t.Errorf("the tool result is not fed back: %v", last)
+	}
+}
+
+// newMCPHarness offers the tools of mcptest as "t_echo", "t_image" and "t_fail"
+func newMCPHarness(t *testing.T, server *completionServer, options ...func(cfg *config.Config)) *testkit.Harness {
+	mcpServer := mcptest.NewHTTPServer(t)
+	return newOpenAIHarness(t, server, append([]func(cfg *config.Config){func(cfg *config.Config) {
+		cfg.MCP = []config.MCPServerConfig{{Name: "t", URL: mcpServer.URL}}
+	}}, options...)...)
+}
+
+func TestOpenAIParallelToolCalls(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		if n == 1 {
+			return []chunk{
+				{toolName: "t_echo", toolArgs: `{"text":"first"}`},
+				{toolName: "t_image", toolArgs: `{}`},
+				{toolName: "t_fail", toolArgs: `{}`},
+			}
+		}
+		return []chunk{{content: "画好了"}}
+	})
+	h := newMCPHarness(t, server)
+
+	h.Send(testkit.NewMessage("画一只猫").From("u1"))
+	updated := h.AssertUpdatedContains(h.LastSent().Id, "画好了")
+	if images := testkit.CardImages(updated.Card); len(images) != 1 {
+		t.Errorf("card images = %v, want the image of the tool", images)
+	}
+	// every call is answered, in the order of the calls
+	messages := server.request(1)["messages"].([]any)
+	results := messages[len(messages)-3:]
+	want := []string{"first", "[an image shown to the user]", "Tool error: boom"}
+	for i, result := range results {
+		result := result.(map[string]any)
+		if result["role"] != "tool" || result["tool_call_id"] != fmt.Sprintf("call_%d", i) || result["content"] != want[i] {
+			t.Errorf("result %d = %v, want %q", i, result, want[i])
+		}
+	}
+}
+
+func TestOpenAITimeoutKeepsToolContents(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		if n == 1 {
+			return []chunk{{toolName: "t_image", toolArgs: `{}`}}
+		}
+		time.Sleep(time.Second)
+		return []chunk{{content: "too late"}}
+	})
+	h := newMCPHarness(t, server, func(cfg *config.Config) { cfg.OpenAI.RequestTimeout = 300 * time.Millisecond })
+
+	h.Send(testkit.NewMessage("画一只猫").From("u1"))
+	updated := h.AssertUpdatedContains(h.LastSent().Id, "回答超时了")
+	if !strings.Contains(testkit.CardText(updated.Card), "以下是已获取的内容") || len(testkit.CardImages(updated.Card)) != 1 {
+		t.Errorf("card = %q with %d images, want the image fetched before the timeout",
+			testkit.CardText(updated.Card), len(testkit.CardImages(updated.Card)))
+	}
+	if v, _ := h.KV.Exists("gpt:conv:u1"); v {
+		t.Error("the failed question is remembered")
+	}
+}
+
+func TestOpenAIImageToolCard(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		if n == 1 {
+			return []chunk{{toolName: "generate_image", toolArgs: `{"prompt":"a cat"}`}}
+		}
+		return []chunk{{content: "画好了"}}
+	})
+	h := newOpenAIHarness(t, server, func(cfg *config.Config) { cfg.OpenAI.ImageModel = "dall-e-3" })
+	h.KV.Set("access:u1", "3", 0) // gpt and draw
+
+	h.Send(testkit.NewMessage("画一只猫").From("u1"))
+	updated := h.AssertUpdatedContains(h.LastSent().Id, "画好了")
+	images := testkit.CardImages(updated.Card)
+	if len(images) != 1 || !strings.HasPrefix(images[0], "image_") {
+		t.Fatalf("card images = %v, want the uploaded image", images)
+	}
+	if uploaded := h.Client.Uploaded(); len(uploaded) != 1 || uploaded[0] != generatedImage {
+		t.Errorf("uploaded = %v, want the generated image", uploaded)
+	}
+}
+
+func TestOpenAIToolRoundsAreBounded(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		if _, ok := request["tools"]; ok {
+			return []chunk{{toolName: "reminder", toolArgs: `{"action":"list"}`}}
+		}
+		return []chunk{{content: "forced answer"}}
+	})
+	h := newOpenAIHarness(t, server, func(cfg *config.Config) { cfg.OpenAI.MaxToolRounds = 2 })
+
+	h.Send(testkit.NewMessage("loop").From("u1"))
+	h.AssertUpdatedContains(h.LastSent().Id, "forced answer")
+	if server.count() != 3 {
+		t.Errorf("%d completions requested, want 2 rounds with tools and a final one without", server.count())
+	}
+}
+
+// pngImage returns a small base64 encoded png
+func pngImage(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// sentImages counts the images of the last question sent to the model
+func sentImages(request map[string]any) int {
+	messages := request["messages"].([]any)
+	return strings.Count(fmt.Sprint(messages[len(messages)-1]), "data:image/")
+}
+
+func TestOpenAIAnswersQuotedImage(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		return []chunk{{content: "一只猫"}}
+	})
+	h := newOpenAIHarness(t, server)
+	h.KV.Set("access:g1", "1", 0)
+	h.Client.Images["img"] = pngImage(t)
+
+	quoted := testkit.NewImageMessage().From("u2").InGroup("g1").WithId("img")
+	h.Send(testkit.NewMessage("").From("u1").InGroup("g1").MentionBot().ReplyTo(quoted))
+	h.AssertUpdatedContains(h.LastSent().Id, "一只猫")
+	if n := sentImages(server.request(0)); n != 1 {
+		t.Errorf("%d images sent to the model, want the quoted one", n)
+	}
+	if ok, _ := h.KV.Exists("gpt:vision:g1:u1"); ok {
+		t.Error("a vision session waits for another image")
+	}
+}
+
+func TestOpenAIPrivateImages(t *testing.T) {
+	for _, visionPrivate := range []bool{false, true} {
+		t.Run(fmt.Sprint(visionPrivate), func(t *testing.T) {
+			server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+				return []chunk{{content: "一只猫"}}
+			})
+			h := newOpenAIHarness(t, server, func(cfg *config.Config) { cfg.OpenAI.VisionPrivate = visionPrivate })
+			msg := testkit.NewImageMessage().From("u1")
+			h.Client.Images[msg.Id] = pngImage(t)
+
+			if taken := h.Send(msg); taken != visionPrivate {
+				t.Fatalf("taken = %v", taken)
+			}
+			if !visionPrivate {
+				h.AssertNothingSent()
+				// asking about the image still works
+				h.Send(testkit.NewMessage("这是什么").From("u1").ReplyTo(msg))
+			}
+			h.AssertUpdatedContains(h.LastSent().Id, "一只猫")
+			if n := sentImages(server.request(0)); n != 1 {
+				t.Errorf("%d images sent to the model", n)
+			}
+		})
+	}
+}
+
+func TestGptReset(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		return []chunk{{content: "ok"}}
+	})
+	h := newOpenAIHarness(t, server)
+	h.KV.Set("gpt:conv:u1", `[{"role":"user","content":"hi"}]`, 0)
+
+	h.Send(testkit.NewMessage("#gpt reset").From("u1"))
+	h.AssertSentContains("对话记忆已清空")
+	if v, _ := h.KV.Exists("gpt:conv:u1"); v {
+		t.Error("conversation not reset")
+	}
+}
+
+func TestOpenAIQuotaSparesAdmins(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		return []chunk{{content: "answer"}}
+	})
+	h := newOpenAIHarness(t, server, func(cfg *config.Config) { cfg.OpenAI.DailyTokenLimit = 10 })
+	h.KV.Set("access:g1", "1", 0)
+	db.NewUsageStore(h.KV).Record("g1", "u1", 10, 5)
+
+	h.Send(testkit.NewMessage("hi").From("u1").InGroup("g1").MentionBot())
+	h.AssertSentContains("额度已经用完")
+
+	h.Client.Reset()
+	h.Send(testkit.NewMessage("hi").From(testkit.Admin).InGroup("g1").MentionBot())
+	h.AssertUpdatedContains(h.LastSent().Id, "answer")
+}
@@ -0,0 +1,96 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"focalors-go/contract"
+	"focalors-go/service"
+	"log/slog"
+)
+
+const personaUsage = `用法: #persona <set|show|clear> [-u 目标] [人设]
+  set <人设>  设置当前会话的系统提示词, 含换行的人设用引号包裹
+  show       查看当前生效的系统提示词
+  clear      清除人设，恢复默认提示词
+  -u 目标     管理其他用户或群, 默认当前会话
+人设支持变量: {{.Date}} {{.Time}} {{.Weekday}} {{.GroupName}} {{.Nickname}}`
+
+type personaMiddleware struct {
+	*MiddlewareContext
+	personas *service.PersonaService
+}
+
+func NewPersonaMiddleware(base *MiddlewareContext) Middleware {
+	if !base.cfg.OpenAI.Enabled() {
+		return nil
+	}
+	return &personaMiddleware{
+		MiddlewareContext: base,
+		personas:          service.NewPersonaService(base.kv),
+	}
+}
+
+func (p *personaMiddleware) OnMessage(ctx context.Context, msg contract.GenericMessage) bool {
+	if !p.access.IsAdmin(msg.GetUserId()) {
+		return false
+	}
+	fs := contract.ToFlagSet(msg, "persona")
+	if fs == nil {
+		return false
+	}
+	var target string
+	fs.StringVar(&target, "u", "", "管理其他用户或群, 默认当前会话")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), personaUsage)
+	}
+	if help := fs.Parse(); help != "" {
+		p.SendText(msg, help)
+		return true
+	}
+	verb := fs.Arg(0)
+	// the flag set stops at the verb, -u may follow it, e.g. "#persona set -u 目标 人设"
+	if fs.NArg() > 0 {
+		if err := fs.FlagSet.Parse(fs.Args()[1:]); err != nil {
+			p.SendText(msg, personaUsage)
+			return true
+		}
+	}
+	rest := fs.Rest()
+	if target == "" {
+		target = msg.GetTarget()
+	}
+
+	switch verb {
+	case "set":
+		if rest == "" {
+			p.SendText(msg, "请提供人设内容")
+			return true
+		}
+		if err := p.personas.Set(target, rest); err != nil {
+			logger.Warn("Failed to set persona", slog.String("target", target), slog.Any("error", err))
+			p.SendText(msg, fmt.Sprintf("设置人设失败: %s", err.Error()))
+			return true
+		}
+		p.SendText(msg, "人设已更新")
+	case "show":
+		persona, err := p.personas.Get(target)
+		if err != nil {
+			p.SendText(msg, fmt.Sprintf("获取人设失败: %s", err.Error()))
+			return true
+		}
+		if persona == "" {
+			p.SendText(msg, fmt.Sprintf("未设置人设, 使用默认提示词:\n%s", p.cfg.OpenAI.SystemPrompt))
+			return true
+		}
+		p.SendText(msg, persona)
+	case "clear":
+		if err := p.personas.Clear(target); err != nil {
+			p.SendText(msg, fmt.Sprintf("清除人设失败: %s", err.Error()))
+			return true
+		}
+		p.SendText(msg, "人设已清除")
+	default:
+		p.SendText(msg, personaUsage)
+	}
+	return true
+}
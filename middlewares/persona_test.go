@@ -0,0 +1,86 @@
+package middlewares_test
+
+import (
+	"strings"
+	"testing"
+
+	"focalors-go/middlewares"
+	"focalors-go/middlewares/testkit"
+)
+
+func TestPersonaIsAdminOnly(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk { return nil })
+	h := newOpenAIHarness(t, server)
+	h.Use(middlewares.NewPersonaMiddleware)
+
+	if h.Send(testkit.NewMessage("#persona set 猫娘").From("u2").InGroup("g1")) {
+		t.Error("a user who is not an admin set a persona")
+	}
+	if ok, _ := h.KV.Exists("persona:g1"); ok {
+		t.Fatal("persona of g1 stored")
+	}
+}
+
+func TestPersonaTargets(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk { return nil })
+	h := newOpenAIHarness(t, server)
+	h.Use(middlewares.NewPersonaMiddleware)
+
+	h.Send(testkit.NewMessage("#persona set 你是 猫娘").From(testkit.Admin).InGroup("g1"))
+	h.AssertSentContains("人设已更新")
+	if v, _ := h.KV.Get("persona:g1"); v != "你是 猫娘" {
+		t.Errorf("persona of the current chat = %q", v)
+	}
+
+	// -u before and after the verb
+	for _, text := range []string{"#persona -u u1 set 你好", "#persona set -u u2 你好"} {
+		h.Client.Reset()
+		h.Send(testkit.NewMessage(text).From(testkit.Admin).InGroup("g1"))
+		h.AssertSentContains("人设已更新")
+	}
+	for _, target := range []string{"u1", "u2"} {
+		if v, _ := h.KV.Get("persona:" + target); v != "你好" {
+			t.Errorf("persona of %s = %q", target, v)
+		}
+	}
+
+	h.Client.Reset()
+	h.Send(testkit.NewMessage("#persona show -u u1").From(testkit.Admin).InGroup("g1"))
+	if text := testkit.CardText(h.LastSent().Card); text != "你好" {
+		t.Errorf("show = %q", text)
+	}
+	h.Send(testkit.NewMessage("#persona clear -u u1").From(testkit.Admin).InGroup("g1"))
+	h.AssertSentContains("人设已清除")
+	if ok, _ := h.KV.Exists("persona:u1"); ok {
+		t.Error("persona of u1 not cleared")
+	}
+
+	h.Client.Reset()
+	h.Send(testkit.NewMessage("#persona set {{.Date").From(testkit.Admin).InGroup("g1"))
+	h.AssertSentContains("设置人设失败")
+	h.Send(testkit.NewMessage("#persona -h").From(testkit.Admin).InGroup("g1"))
+	h.AssertSentContains("用法")
+}
+
+func TestPersonaRendersSystemPrompt(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		return []chunk{{content: "喵"}}
+	})
+	h := newOpenAIHarness(t, server)
+	h.Use(middlewares.NewPersonaMiddleware)
+	h.Client.Contacts["u1"] = "Alice"
+
+	h.Send(testkit.NewMessage("#persona set -u u1 你是猫娘{{.GroupName}}, 称呼对方为{{.Nickname}}{{.Unknown}}").From(testkit.Admin).InGroup("g1"))
+	h.AssertSentContains("人设已更新")
+
+	h.Send(testkit.NewMessage("hi").From("u1"))
+	h.AssertUpdatedContains(h.LastSent().Id, "喵")
+	messages := server.request(0)["messages"].([]any)
+	system := messages[0].(map[string]any)
+	if system["role"] != "system" || system["content"] != "你是猫娘, 称呼对方为Alice" {
+		t.Errorf("system message = %v", system)
+	}
+	if strings.Contains(system["content"].(string), "{{") {
+		t.Error("the prompt is not rendered")
+	}
+}
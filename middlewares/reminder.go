@@ -0,0 +1,125 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"focalors-go/contract"
+	"focalors-go/service"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const reminderUsage = `用法: #提醒 [-c cron表达式] <时间> <内容>
+  时间: 30m | 2h | 20:00 | 明天 8:30 | 10-17 20:00 | 2026-10-17 20:00
+  -c cron表达式  周期提醒, 不需要时间, 如 #提醒 -c "0 8 * * 1-5" 起床
+  -l            查看我的提醒
+  -d ID         取消提醒`
+
+type reminderMiddleware struct {
+	*MiddlewareContext
+	reminders *service.ReminderService
+}
+
+func NewReminderMiddleware(base *MiddlewareContext) Middleware {
+	return &reminderMiddleware{
+		MiddlewareContext: base,
+		reminders:         service.NewReminderService(base.cron, base.client),
+	}
+}
+
+func (r *reminderMiddleware) Start() error {
+	// reminders are persisted by the cron task, schedule them again like the jiadan sync
+	r.reminders.Restore()
+	return nil
+}
+
+func (r *reminderMiddleware) OnMessage(ctx context.Context, msg contract.GenericMessage) bool {
+	fs := contract.ToFlagSet(msg, "提醒")
+	if fs == nil {
+		return false
+	}
+	var spec, cancel string
+	var list bool
+	fs.StringVar(&spec, "c", "", "周期提醒的cron表达式")
+	fs.BoolVar(&list, "l", false, "查看我的提醒")
+	fs.StringVar(&cancel, "d", "", "取消提醒的ID")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), reminderUsage)
+	}
+	if help := fs.Parse(); help != "" {
+		r.SendText(msg, help)
+		return true
+	}
+
+	switch {
+	case list:
+		r.SendText(msg, formatReminders(r.reminders.List(msg.GetTarget(), msg.GetUserId())))
+		return true
+	case cancel != "":
+		if !r.reminders.Cancel(msg.GetTarget(), msg.GetUserId(), cancel) {
+			r.SendText(msg, fmt.Sprintf("没有找到提醒 %s", cancel))
+			return true
+		}
+		r.SendText(msg, fmt.Sprintf("提醒 %s 已取消", cancel))
+		return true
+	}
+
+	var reminder *service.Reminder
+	var err error
+	args := fs.Args()
+	if spec != "" {
+		reminder, err = service.NewRecurring(spec, strings.Join(args, " "))
+	} else {
+		if len(args) < 2 {
+			r.SendText(msg, reminderUsage)
+			return true
+		}
+		var at time.Time
+		if at, args, err = parseReminderArgs(args, time.Now()); err == nil {
+			reminder, err = service.NewOnce(at, strings.Join(args, " "))
+		}
+	}
+	if err == nil {
+		err = r.reminders.Add(reminder, msg.GetTarget(), msg.GetUserId(), msg.IsGroup())
+	}
+	if err != nil {
+		logger.Info("Failed to add reminder", slog.String("target", msg.GetTarget()), slog.Any("error", err))
+		r.SendText(msg, fmt.Sprintf("设置提醒失败: %s", err.Error()))
+		return true
+	}
+	r.SendText(msg, fmt.Sprintf("好的, %s 提醒你: %s\n取消请发送 #提醒 -d %s", describeSchedule(reminder), reminder.Text, reminder.Id))
+	return true
+}
+
+// parseReminderArgs parses the time at the start of args and returns the remaining words.
+// Times written with a space, e.g. "明天 8:30" or "10-17 20:00", arrive as two args unless quoted.
+func parseReminderArgs(args []string, now time.Time) (time.Time, []string, error) {
+	if len(args) > 2 {
+		if at, err := service.ParseReminderTime(args[0]+" "+args[1], now); err == nil {
+			return at, args[2:], nil
+		}
+	}
+	at, err := service.ParseReminderTime(args[0], now)
+	return at, args[1:], err
+}
+
+// formatReminders lists reminders with their ids and next fire time
+func formatReminders(reminders []*service.Reminder) string {
+	if len(reminders) == 0 {
+		return "你还没有设置提醒"
+	}
+	var text strings.Builder
+	text.WriteString("你的提醒:")
+	for _, reminder := range reminders {
+		fmt.Fprintf(&text, "\n🔔 [%s] %s: %s", reminder.Id, describeSchedule(reminder), reminder.Text)
+	}
+	return text.String()
+}
+
+func describeSchedule(reminder *service.Reminder) string {
+	if reminder.Recurring() {
+		return fmt.Sprintf("按 %s (下次 %s)", reminder.Spec, reminder.Next(time.Now()).Format("01-02 15:04"))
+	}
+	return fmt.Sprintf("将在 %s", reminder.At.Format("2006-01-02 15:04"))
+}
@@ -0,0 +1,52 @@
+package middlewares_test
+
+import (
+	"focalors-go/middlewares"
+	"focalors-go/middlewares/testkit"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReminderTimes(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"#提醒 明天 8:30 起床", "将在 " + tomorrow + " 08:30 提醒你: 起床\n"},
+		{"#提醒 明天8:30 起床", "将在 " + tomorrow + " 08:30 提醒你: 起床\n"},
+		{`#提醒 "明天 8:30" 起床`, "将在 " + tomorrow + " 08:30 提醒你: 起床\n"},
+		{"#提醒 10s 喝水", "提醒你: 喝水\n"},
+		{"#提醒 20:00 吃饭 吃饭", "提醒你: 吃饭 吃饭\n"},
+		{"#提醒 明天 25:00 起床", "设置提醒失败: 无法识别的时间: 明天"},
+		{"#提醒 明天", "用法"},
+		{"#提醒 -c \"0 8 * * 1-5\" 起床", "按 0 8 * * 1-5"},
+		{"#提醒 -c \"* * * * *\" 起床", "设置提醒失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			h := testkit.New(t)
+			h.Use(middlewares.NewReminderMiddleware)
+			h.Send(testkit.NewMessage(tt.command).From("u1"))
+			h.AssertSentContains(tt.want)
+		})
+	}
+}
+
+func TestReminderListAndCancel(t *testing.T) {
+	h := testkit.New(t)
+	h.Use(middlewares.NewReminderMiddleware)
+	h.Send(testkit.NewMessage("#提醒 -l").From("u1"))
+	h.AssertSentContains("你还没有设置提醒")
+
+	h.Send(testkit.NewMessage("#提醒 2h 喝水").From("u1"))
+	h.WaitSent(2)
+	h.Send(testkit.NewMessage("#提醒 -l").From("u1"))
+	if list := testkit.CardText(h.WaitSent(3)[2].Card); !strings.Contains(list, "你的提醒") || !strings.Contains(list, "喝水") {
+		t.Errorf("list = %q", list)
+	}
+
+	h.Send(testkit.NewMessage("#提醒 -d nope").From("u1"))
+	h.AssertSentContains("没有找到提醒 nope")
+}
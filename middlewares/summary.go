@@ -0,0 +1,219 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"focalors-go/contract"
+	"focalors-go/db"
+	"focalors-go/service"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	summaryDefaultCount = 100
+	// minimum messages worth summarizing
+	summaryMinMessages = 5
+	// estimated token budget of the transcript, older messages are dropped beyond it
+	summaryMaxTokens = 12000
+)
+
+const summaryPrompt = `你是群聊记录的总结助手。请根据用户提供的聊天记录, 用简体中文输出结构化的总结, 使用以下 Markdown 格式:
+
+**📌 话题**
+- 按时间顺序列出讨论的主要话题, 每个话题一句话概括, 注明主要参与者
+
+**✅ 结论与决定**
+- 达成的共识、决定或待办, 没有则写"无"
+
+**❓ 提问**
+- 谁问了什么, 是否得到回答, 没有则写"无"
+
+只根据记录总结, 不要编造内容, 保持简洁。`
+
+// commands of the bot and of Yunzai are not worth summarizing
+var commandPattern = regexp.MustCompile(`^[#*%]`)
+
+// summaryMiddleware records the text messages of groups with GPT access and summarizes them on "#总结"
+type summaryMiddleware struct {
+	*MiddlewareContext
+	history *db.HistoryStore
+	openai  *openai.Client
+	usage   *db.UsageStore
+}
+
+func NewSummaryMiddleware(base *MiddlewareContext) Middleware {
+	if !base.cfg.OpenAI.Enabled() || base.cfg.OpenAI.HistorySize <= 0 {
+		return nil
+	}
+	client := newOpenAIClient(&base.cfg.OpenAI)
+	return &summaryMiddleware{
+		MiddlewareContext: base,
+		history:           db.NewHistoryStore(base.kv, base.cfg.OpenAI.HistorySize, base.cfg.OpenAI.HistoryTTL),
+		openai:            &client,
+		usage:             db.NewUsageStore(base.kv),
+	}
+}
+
+func (s *summaryMiddleware) OnMessage(ctx context.Context, msg contract.GenericMessage) bool {
+	if !msg.IsGroup() || !msg.IsText() {
+		return false
+	}
+	if fs := contract.ToFlagSet(msg, "总结"); fs != nil {
+		return s.onSummary(ctx, msg, fs)
+	}
+	s.record(msg)
+	return false
+}
+
+func (s *summaryMiddleware) record(msg contract.GenericMessage) {
+	text := strings.TrimSpace(msg.GetText())
+	if text == "" || commandPattern.MatchString(text) {
+		return
+	}
+	if ok, _ := s.access.HasAccess(msg.GetTarget(), service.GPTAccess); !ok {
+		return
+	}
+	if err := s.history.Append(msg.GetGroupId(), db.HistoryMessage{
+		Time:   time.Now(),
+		UserId: msg.GetUserId(),
+		Text:   text,
+	}); err != nil {
+		logger.Warn("Failed to record group message", slog.String("group", msg.GetGroupId()), slog.Any("error", err))
+	}
+}
+
+// onSummary handles "#总结 [-n 200 | -h 2h]"
+func (s *summaryMiddleware) onSummary(ctx context.Context, msg contract.GenericMessage, fs *contract.MessageFlagSet) bool {
+	if ok, _ := s.access.HasAccess(msg.GetTarget(), service.GPTAccess); !ok {
+		return false
+	}
+	var count int
+	var hours string
+	fs.IntVar(&count, "n", 0, fmt.Sprintf("总结最近N条消息, 默认%d, 最多%d", summaryDefaultCount, s.cfg.OpenAI.HistorySize))
+	fs.StringVar(&hours, "h", "", "总结最近一段时间的消息, 如 30m, 2h")
+	if help := fs.Parse(); help != "" {
+		s.SendText(msg, help)
+		return true
+	}
+	var since time.Time
+	if hours != "" {
+		d, err := time.ParseDuration(hours)
+		if err != nil || d <= 0 {
+			s.SendText(msg, fmt.Sprintf("无法识别的时长: %s", hours))
+			return true
+		}
+		since = time.Now().Add(-d)
+	} else if count <= 0 {
+		count = summaryDefaultCount
+	}
+	if reason := s.quotaExceeded(s.usage, msg.GetTarget(), msg.GetUserId()); reason != "" {
+		s.SendText(msg, reason)
+		return true
+	}
+
+	messages, err := s.history.Recent(msg.GetGroupId(), count, since)
+	if err != nil {
+		logger.Error("Failed to load group history", slog.Any("error", err))
+		s.SendText(msg, "读取聊天记录失败")
+		return true
+	}
+	if len(messages) < summaryMinMessages {
+		s.SendText(msg, "最近的消息太少, 没什么可总结的")
+		return true
+	}
+
+	sender := s.SendPendingReply(msg)
+	transcript, used := s.transcript(messages)
+	summary, err := s.summarize(ctx, msg, transcript)
+	if err != nil {
+		logger.Error("Failed to summarize group chat", slog.String("group", msg.GetGroupId()), slog.Any("error", err))
+		text := "总结失败了，请稍后重试"
+		if errors.Is(err, context.DeadlineExceeded) {
+			text = "总结超时了，请稍后重试"
+		}
+		sender.SendMarkdown(text)
+		return true
+	}
+	first := messages[len(messages)-used].Time
+	last := messages[len(messages)-1].Time
+	card := contract.NewCardBuilder().
+		AddHeader("群聊总结").
+		AddMarkdown(summary).
+		AddDivider().
+		AddMarkdown(fmt.Sprintf("共 %d 条消息, %s - %s", used, first.Format("01-02 15:04"), last.Format("01-02 15:04")))
+	sender.SendRichCard(card)
+	return true
+}
+
+// transcript renders the newest messages fitting the token budget as "[15:04] 昵称: text" lines,
+// returns the transcript and how many messages it contains
+func (s *summaryMiddleware) transcript(messages []db.HistoryMessage) (string, int) {
+	var userIds []string
+	seen := map[string]bool{}
+	for _, m := range messages {
+		if !seen[m.UserId] {
+			seen[m.UserId] = true
+			userIds = append(userIds, m.UserId)
+		}
+	}
+	nicknames := make(map[string]string, len(userIds))
+	if contacts, err := s.client.GetContactDetail(userIds...); err != nil {
+		logger.Warn("Failed to get contact details", slog.Any("error", err))
+	} else {
+		for _, contact := range contacts {
+			nicknames[contact.Username()] = contact.Nickname()
+		}
+	}
+
+	lines := make([]string, 0, len(messages))
+	tokens := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		name := nicknames[m.UserId]
+		if name == "" {
+			name = m.UserId
+		}
+		line := fmt.Sprintf("[%s] %s: %s", m.Time.Format("15:04"), name, m.Text)
+		tokens += db.EstimateTokens(line)
+		if tokens > summaryMaxTokens && len(lines) > 0 {
+			break
+		}
+		lines = append(lines, line)
+	}
+	// collected newest first
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return strings.Join(lines, "\n"), len(lines)
+}
+
+func (s *summaryMiddleware) summarize(ctx context.Context, msg contract.GenericMessage, transcript string) (string, error) {
+	if s.cfg.OpenAI.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.OpenAI.RequestTimeout)
+		defer cancel()
+	}
+	completion, err := s.openai.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: openai.ChatModel(s.cfg.OpenAI.ModelName()),
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(summaryPrompt),
+			openai.UserMessage("聊天记录:\n" + transcript),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.usage.Record(msg.GetTarget(), msg.GetUserId(), completion.Usage.PromptTokens, completion.Usage.CompletionTokens); err != nil {
+		logger.Warn("Failed to record token usage", slog.Any("error", err))
+	}
+	if len(completion.Choices) == 0 || strings.TrimSpace(completion.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("empty completion")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
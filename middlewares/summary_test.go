@@ -0,0 +1,86 @@
+package middlewares_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"focalors-go/config"
+	"focalors-go/middlewares"
+	"focalors-go/middlewares/testkit"
+)
+
+func newSummaryHarness(t *testing.T, server *completionServer) *testkit.Harness {
+	h := testkit.New(t, func(cfg *config.Config) {
+		cfg.OpenAI.Provider = config.OpenAIProviderCompatible
+		cfg.OpenAI.BaseURL = server.URL
+		cfg.OpenAI.Model = "m"
+		cfg.OpenAI.HistorySize = 50
+		cfg.OpenAI.HistoryTTL = time.Hour
+	})
+	h.KV.Set("access:g1", "1", 0)
+	h.Use(middlewares.NewSummaryMiddleware)
+	return h
+}
+
+func TestSummarySendsTranscript(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		return []chunk{{content: "**📌 话题**\n- 周末出游"}}
+	})
+	h := newSummaryHarness(t, server)
+	h.Client.Contacts["u1"] = "Alice"
+
+	for i := range 6 {
+		user := []string{"u1", "u2"}[i%2]
+		if h.Send(testkit.NewMessage(fmt.Sprintf("周末去哪 %d", i)).From(user).InGroup("g1")) {
+			t.Fatal("recording takes the message")
+		}
+	}
+	// commands, other groups and images are not recorded
+	h.Send(testkit.NewMessage("#面板").From("u1").InGroup("g1"))
+	h.Send(testkit.NewMessage("*抽卡").From("u1").InGroup("g1"))
+	h.Send(testkit.NewMessage("别的群").From("u1").InGroup("g2"))
+	h.Send(testkit.NewImageMessage().From("u1").InGroup("g1"))
+
+	if !h.Send(testkit.NewMessage("#总结").From("u2").InGroup("g1")) {
+		t.Fatal("#总结 not taken")
+	}
+	h.AssertUpdatedContains(h.LastSent().Id, "周末出游")
+	h.AssertUpdatedContains(h.LastSent().Id, "共 6 条消息")
+
+	if server.count() != 1 {
+		t.Fatalf("%d completions requested, want 1", server.count())
+	}
+	messages := server.request(0)["messages"].([]any)
+	transcript := fmt.Sprint(messages[len(messages)-1].(map[string]any)["content"])
+	lines := strings.Split(strings.TrimPrefix(transcript, "聊天记录:\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("transcript = %q, want the 6 recorded messages", transcript)
+	}
+	if !strings.HasSuffix(lines[0], "] Alice: 周末去哪 0") || !strings.HasSuffix(lines[5], "] u2: 周末去哪 5") {
+		t.Errorf("transcript = %q, want the messages in order with nicknames", transcript)
+	}
+	for _, skipped := range []string{"#面板", "*抽卡", "别的群", "#总结"} {
+		if strings.Contains(transcript, skipped) {
+			t.Errorf("transcript contains %q", skipped)
+		}
+	}
+}
+
+func TestSummaryNeedsMessages(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk { return nil })
+	h := newSummaryHarness(t, server)
+
+	h.Send(testkit.NewMessage("hi").From("u1").InGroup("g1"))
+	h.Send(testkit.NewMessage("#总结").From("u1").InGroup("g1"))
+	h.AssertSentContains("最近的消息太少")
+
+	// no access, no summary
+	if h.Send(testkit.NewMessage("#总结").From("u1").InGroup("g2")) {
+		t.Error("#总结 taken without access")
+	}
+	if server.count() != 0 {
+		t.Errorf("%d completions requested", server.count())
+	}
+}
@@ -0,0 +1,261 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"focalors-go/contract"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SelfId is the user id of the bot in the fake client
+const SelfId = "bot"
+
+// SentCard is a card sent or replied by a middleware
+type SentCard struct {
+	Id      string
+	Target  string
+	ReplyTo string // empty unless sent with ReplyRichCard
+	Card    *contract.CardBuilder
+}
+
+// UpdatedCard is an in-place update of a previously sent card
+type UpdatedCard struct {
+	Id   string
+	Card *contract.CardBuilder
+}
+
+// Client is a contract.GenericClient recording everything middlewares do with it.
+// Messages are fed with Deliver, which runs the registered handlers like a platform would.
+type Client struct {
+	// SelfId is returned by GetSelfUserId, defaults to SelfId
+	SelfId string
+	// UpdateErr is returned by UpdateRichCard when set, to simulate platforms without card updates
+	UpdateErr error
+	// Images maps message ids to the base64 content returned by DownloadMessageImage
+	Images map[string]string
+	// Contacts maps ids to the nickname returned by GetContactDetail, unknown ids use the id
+	Contacts map[string]string
+
+	mu       sync.Mutex
+	nextId   int
+	handlers []func(ctx context.Context, msg contract.GenericMessage) bool
+	sent     []SentCard
+	updated  []UpdatedCard
+	recalled []string
+	uploaded []string
+	changed  chan struct{}
+}
+
+var _ contract.GenericClient = (*Client)(nil)
+
+func NewClient() *Client {
+	return &Client{
+		SelfId:   SelfId,
+		Images:   make(map[string]string),
+		Contacts: make(map[string]string),
+		changed:  make(chan struct{}),
+	}
+}
+
+// Deliver passes the message through the registered handlers, returns true if one handled it
+func (c *Client) Deliver(ctx context.Context, msg contract.GenericMessage) bool {
+	c.mu.Lock()
+	handlers := append([]func(ctx context.Context, msg contract.GenericMessage) bool{}, c.handlers...)
+	c.mu.Unlock()
+	for _, handler := range handlers {
+		if handler(ctx, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// notify wakes up everyone waiting for a change, must be called with mu held
+func (c *Client) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *Client) changedCh() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
+
+func (c *Client) allocId() string {
+	c.nextId++
+	return "sent_" + strconv.Itoa(c.nextId)
+}
+
+func (c *Client) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (c *Client) AddMessageHandler(handler func(ctx context.Context, msg contract.GenericMessage) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers = append(c.handlers, handler)
+}
+
+func (c *Client) SendRichCard(target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	return c.ReplyRichCard("", target, card)
+}
+
+func (c *Client) ReplyRichCard(replyToMsgId string, target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.allocId()
+	c.sent = append(c.sent, SentCard{Id: id, Target: target.GetTarget(), ReplyTo: replyToMsgId, Card: cloneCard(card)})
+	c.notify()
+	return id, nil
+}
+
+func (c *Client) UpdateRichCard(messageId string, card *contract.CardBuilder) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.UpdateErr != nil {
+		return c.UpdateErr
+	}
+	c.updated = append(c.updated, UpdatedCard{Id: messageId, Card: cloneCard(card)})
+	c.notify()
+	return nil
+}
+
+func (c *Client) RecallMessage(messageId string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recalled = append(c.recalled, messageId)
+	c.notify()
+	return nil
+}
+
+// UploadImage records the content and returns a key like "image_1"
+func (c *Client) UploadImage(base64Content string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.uploaded = append(c.uploaded, base64Content)
+	return fmt.Sprintf("image_%d", len(c.uploaded)), nil
+}
+
+func (c *Client) GetContactDetail(userId ...string) ([]contract.Contact, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	contacts := make([]contract.Contact, 0, len(userId))
+	for _, id := range userId {
+		name, ok := c.Contacts[id]
+		if !ok {
+			name = id
+		}
+		contacts = append(contacts, &Contact{Id: id, Name: name})
+	}
+	return contacts, nil
+}
+
+func (c *Client) GetSelfUserId() string {
+	return c.SelfId
+}
+
+func (c *Client) DownloadMessageImage(msgId string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	content, ok := c.Images[msgId]
+	if !ok {
+		return "", fmt.Errorf("no image found for message %s", msgId)
+	}
+	return content, nil
+}
+
+// Sent returns the cards sent so far, in order
+func (c *Client) Sent() []SentCard {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]SentCard{}, c.sent...)
+}
+
+// Updated returns the card updates so far, in order
+func (c *Client) Updated() []UpdatedCard {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]UpdatedCard{}, c.updated...)
+}
+
+// Recalled returns the ids of recalled messages, in order
+func (c *Client) Recalled() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.recalled...)
+}
+
+// Uploaded returns the base64 content of uploaded images, in order
+func (c *Client) Uploaded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.uploaded...)
+}
+
+// Reset forgets all recorded calls, handlers are kept
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = nil
+	c.updated = nil
+	c.recalled = nil
+	c.uploaded = nil
+}
+
+// Contact implements contract.Contact
+type Contact struct {
+	Id     string
+	Name   string
+	Avatar string
+}
+
+func (c *Contact) Username() string  { return c.Id }
+func (c *Contact) Nickname() string  { return c.Name }
+func (c *Contact) AvatarUrl() string { return c.Avatar }
+
+func cloneCard(card *contract.CardBuilder) *contract.CardBuilder {
+	if card == nil {
+		return nil
+	}
+	clone := &contract.CardBuilder{Header: card.Header, Elements: make([]contract.CardElement, len(card.Elements))}
+	copy(clone.Elements, card.Elements)
+	return clone
+}
+
+// CardText joins the header, markdown and mention elements of a card, handy for substring assertions
+func CardText(card *contract.CardBuilder) string {
+	if card == nil {
+		return ""
+	}
+	var texts []string
+	if card.Header != "" {
+		texts = append(texts, card.Header)
+	}
+	for _, elem := range card.Elements {
+		switch elem.Type {
+		case contract.CardElementMarkdown:
+			texts = append(texts, elem.Content)
+		case contract.CardElementMention:
+			texts = append(texts, elem.MentionName())
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// CardImages returns the image keys of a card
+func CardImages(card *contract.CardBuilder) []string {
+	if card == nil {
+		return nil
+	}
+	var images []string
+	for _, elem := range card.Elements {
+		if elem.Type == contract.CardElementImage {
+			images = append(images, elem.Content)
+		}
+	}
+	return images
+}
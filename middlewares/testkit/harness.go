@@ -0,0 +1,222 @@
+// Package testkit runs middlewares against a recording fake client and an in-memory KV store,
+// so that they can be unit tested without any platform account or Redis server.
+//
+//	h := testkit.New(t)
+//	h.Use(middlewares.NewAdminMiddleware)
+//	h.Send(testkit.NewMessage("#admin -h").From(testkit.Admin))
+//	h.AssertSentContains("Usage")
+package testkit
+
+import (
+	"context"
+	"focalors-go/config"
+	"focalors-go/contract"
+	"focalors-go/db"
+	"focalors-go/middlewares"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Admin is the admin user id of the default config
+const Admin = "admin"
+
+// WaitTimeout bounds how long Wait* helpers wait for middlewares working in goroutines
+var WaitTimeout = 5 * time.Second
+
+type Harness struct {
+	T       testing.TB
+	Ctx     context.Context
+	Client  *Client
+	Config  *config.Config
+	KV      *db.MemoryKV
+	Context *middlewares.MiddlewareContext
+	roots   []*middlewares.RootMiddleware
+}
+
+// NewConfig returns a config with the defaults the middlewares rely on
+func NewConfig() *config.Config {
+	return &config.Config{
+		App: config.AppConfig{
+			Admin:    []string{Admin},
+			SyncCron: "*/60 8-23 * * *",
+			Platform: "testkit",
+			Storage:  config.StorageMemory,
+		},
+		Jiadan: config.JiadanConfig{MaxSyncCount: 4},
+		OpenAI: config.OpenAIConfig{
+			MemoryTurns:    10,
+			MemoryTokens:   2000,
+			MemoryTTL:      time.Hour,
+			Vision:         true,
+			VisionMaxSize:  10 << 20,
+			VisionMaxSide:  1024,
+			MaxToolRounds:  5,
+			RequestTimeout: time.Minute,
+		},
+	}
+}
+
+// New creates a harness, options can adjust the config before the middleware context is created.
+// Everything is torn down by t.Cleanup.
+func New(t testing.TB, options ...func(cfg *config.Config)) *Harness {
+	t.Helper()
+	cfg := NewConfig()
+	for _, option := range options {
+		option(cfg)
+	}
+
+	kv := db.NewMemoryKV()
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewClient()
+	mctx := middlewares.NewMiddlewareContext(ctx, client, cfg, kv)
+
+	h := &Harness{
+		T:       t,
+		Ctx:     ctx,
+		Client:  client,
+		Config:  cfg,
+		KV:      kv,
+		Context: mctx,
+	}
+	t.Cleanup(func() {
+		for _, root := range h.roots {
+			if err := root.Stop(); err != nil {
+				t.Errorf("failed to stop middlewares: %v", err)
+			}
+		}
+		mctx.Close()
+		cancel()
+		kv.Close()
+	})
+	return h
+}
+
+// Use adds and starts middlewares in the given order, like main.go does.
+// Middlewares added by later calls see messages after the earlier ones.
+func (h *Harness) Use(constructors ...func(m *middlewares.MiddlewareContext) middlewares.Middleware) {
+	h.T.Helper()
+	root := middlewares.NewRootMiddleware(h.Context)
+	root.AddMiddlewares(constructors...)
+	h.roots = append(h.roots, root)
+	if err := root.Start(); err != nil {
+		h.T.Fatalf("failed to start middlewares: %v", err)
+	}
+}
+
+// Send delivers the message to the middlewares, returns true if one of them handled it
+func (h *Harness) Send(msg contract.GenericMessage) bool {
+	return h.Client.Deliver(h.Ctx, msg)
+}
+
+// WaitSent waits until at least n cards were sent and returns all of them
+func (h *Harness) WaitSent(n int) []SentCard {
+	h.T.Helper()
+	var sent []SentCard
+	if !h.wait(func() bool { sent = h.Client.Sent(); return len(sent) >= n }) {
+		h.T.Fatalf("expected %d sent cards, got %d: %s", n, len(sent), describeSent(sent))
+	}
+	return sent
+}
+
+// LastSent returns the last sent card, failing the test if nothing was sent
+func (h *Harness) LastSent() SentCard {
+	h.T.Helper()
+	sent := h.WaitSent(1)
+	return sent[len(sent)-1]
+}
+
+// AssertSentContains waits for a sent card whose text contains substr and returns it
+func (h *Harness) AssertSentContains(substr string) SentCard {
+	h.T.Helper()
+	var found SentCard
+	ok := h.wait(func() bool {
+		for _, s := range h.Client.Sent() {
+			if strings.Contains(CardText(s.Card), substr) {
+				found = s
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		h.T.Fatalf("no sent card contains %q, sent: %s", substr, describeSent(h.Client.Sent()))
+	}
+	return found
+}
+
+// AssertNothingSent fails if any card was sent, updated or recalled
+func (h *Harness) AssertNothingSent() {
+	h.T.Helper()
+	if sent := h.Client.Sent(); len(sent) > 0 {
+		h.T.Fatalf("expected no sent cards, got %s", describeSent(sent))
+	}
+	if updated := h.Client.Updated(); len(updated) > 0 {
+		h.T.Fatalf("expected no updated cards, got %d", len(updated))
+	}
+	if recalled := h.Client.Recalled(); len(recalled) > 0 {
+		h.T.Fatalf("expected no recalled messages, got %v", recalled)
+	}
+}
+
+// AssertUpdatedContains waits for an update of the given message whose text contains substr
+func (h *Harness) AssertUpdatedContains(messageId string, substr string) UpdatedCard {
+	h.T.Helper()
+	var found UpdatedCard
+	ok := h.wait(func() bool {
+		for _, u := range h.Client.Updated() {
+			if u.Id == messageId && strings.Contains(CardText(u.Card), substr) {
+				found = u
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		h.T.Fatalf("message %s was not updated with %q", messageId, substr)
+	}
+	return found
+}
+
+// AssertRecalled waits until the given message was recalled
+func (h *Harness) AssertRecalled(messageId string) {
+	h.T.Helper()
+	ok := h.wait(func() bool {
+		for _, id := range h.Client.Recalled() {
+			if id == messageId {
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		h.T.Fatalf("message %s was not recalled, recalled: %v", messageId, h.Client.Recalled())
+	}
+}
+
+// wait polls cond on every recorded call until it holds or WaitTimeout passes
+func (h *Harness) wait(cond func() bool) bool {
+	deadline := time.After(WaitTimeout)
+	for {
+		changed := h.Client.changedCh()
+		if cond() {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return cond()
+		}
+	}
+}
+
+func describeSent(sent []SentCard) string {
+	var parts []string
+	for _, s := range sent {
+		parts = append(parts, s.Id+"→"+s.Target+": "+strings.ReplaceAll(CardText(s.Card), "\n", " | "))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return "[" + strings.Join(parts, "; ") + "]"
+}
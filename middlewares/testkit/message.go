@@ -0,0 +1,131 @@
+package testkit
+
+import (
+	"focalors-go/contract"
+	"strconv"
+	"sync/atomic"
+)
+
+var messageSeq atomic.Int64
+
+// Message is a contract.GenericMessage built with NewMessage
+type Message struct {
+	Id             string
+	Text           string
+	Content        string
+	UserId         string
+	GroupId        string
+	Image          bool
+	Refer          contract.GenericMessage
+	MentionedUsers []contract.UserInfo
+}
+
+var _ contract.GenericMessage = (*Message)(nil)
+
+// NewMessage returns a private text message from "user" with a unique id.
+// Chain the builder methods to change it, e.g.
+//
+//	testkit.NewMessage("#gpt hi").From("u1").InGroup("g1").MentionBot()
+func NewMessage(text string) *Message {
+	return &Message{
+		Id:      "msg_" + strconv.FormatInt(messageSeq.Add(1), 10),
+		Text:    text,
+		Content: text,
+		UserId:  "user",
+	}
+}
+
+// NewImageMessage returns a private image message, register its content in Client.Images
+// to make it downloadable
+func NewImageMessage() *Message {
+	msg := NewMessage("")
+	msg.Image = true
+	return msg
+}
+
+func (m *Message) WithId(id string) *Message {
+	m.Id = id
+	return m
+}
+
+func (m *Message) From(userId string) *Message {
+	m.UserId = userId
+	return m
+}
+
+func (m *Message) InGroup(groupId string) *Message {
+	m.GroupId = groupId
+	return m
+}
+
+func (m *Message) Mention(userId string) *Message {
+	m.MentionedUsers = append(m.MentionedUsers, contract.UserInfo{UserId: userId, Username: userId})
+	return m
+}
+
+// MentionBot mentions SelfId, the default bot id of the fake client
+func (m *Message) MentionBot() *Message {
+	return m.Mention(SelfId)
+}
+
+// ReplyTo makes the message quote another one, chain it to build a refer chain
+func (m *Message) ReplyTo(refer contract.GenericMessage) *Message {
+	m.Refer = refer
+	return m
+}
+
+func (m *Message) GetId() string {
+	return m.Id
+}
+
+func (m *Message) GetText() string {
+	return m.Text
+}
+
+func (m *Message) GetContent() string {
+	return m.Content
+}
+
+func (m *Message) GetUserId() string {
+	return m.UserId
+}
+
+func (m *Message) GetGroupId() string {
+	return m.GroupId
+}
+
+func (m *Message) GetTarget() string {
+	if m.GroupId != "" {
+		return m.GroupId
+	}
+	return m.UserId
+}
+
+func (m *Message) IsGroup() bool {
+	return m.GroupId != ""
+}
+
+// IsText is true for every message but images, a bare mention is a text message with empty text
+func (m *Message) IsText() bool {
+	return !m.Image
+}
+
+func (m *Message) IsImage() bool {
+	return m.Image
+}
+
+func (m *Message) GetReferMessage() (contract.GenericMessage, bool) {
+	if m.Refer == nil {
+		return nil, false
+	}
+	return m.Refer, true
+}
+
+func (m *Message) GetMentionedUsers() []contract.UserInfo {
+	if len(m.MentionedUsers) == 0 {
+		return nil
+	}
+	mentionedUsers := make([]contract.UserInfo, len(m.MentionedUsers))
+	copy(mentionedUsers, m.MentionedUsers)
+	return mentionedUsers
+}
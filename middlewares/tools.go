@@ -0,0 +1,122 @@
+package middlewares
+
+import (
+	"fmt"
+	"focalors-go/contract"
+	"focalors-go/service"
+	"focalors-go/tooling"
+	"log/slog"
+	"strings"
+)
+
+const toolUsage = `用法: #tool [-u 目标 | -s group|private] <list|enable|disable|reset> [工具名]
+  list            查看工具及其开关
+  enable <工具>    启用工具
+  disable <工具>   禁用工具
+  reset <工具>     清除开关, 恢复默认
+  -u 目标          管理其他用户或群, 默认当前会话
+  -s group|private 管理所有群聊或所有私聊的默认开关
+例: #tool -s group disable jiandan_top  煎蛋只在私聊中可用`
+
+// onToolCommand handles "#tool", admins switch GPT tools on or off per chat or for all groups/private chats
+func (g *gptCommandMiddleware) onToolCommand(msg contract.GenericMessage, fs *contract.MessageFlagSet) bool {
+	if !g.access.IsAdmin(msg.GetUserId()) {
+		return false
+	}
+	var target, scope string
+	fs.StringVar(&target, "u", "", "目标用户或群, 默认当前会话")
+	fs.StringVar(&scope, "s", "", "group 或 private, 管理默认开关")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), toolUsage)
+	}
+	if help := fs.Parse(); help != "" {
+		g.SendText(msg, help)
+		return true
+	}
+
+	key, name := target, target
+	switch scope {
+	case "":
+		if key == "" {
+			key, name = msg.GetTarget(), "当前会话"
+		}
+	case "group":
+		key, name = service.ToolScopeGroups, "所有群聊"
+	case "private":
+		key, name = service.ToolScopePrivate, "所有私聊"
+	default:
+		g.SendText(msg, "未知范围, 请使用 group 或 private")
+		return true
+	}
+
+	verb, tool, _ := strings.Cut(fs.Rest(), " ")
+	tool = strings.TrimSpace(tool)
+	if verb == "list" {
+		return g.onToolList(msg, key, name)
+	}
+	if verb != "enable" && verb != "disable" && verb != "reset" {
+		g.SendText(msg, toolUsage)
+		return true
+	}
+	if _, ok := g.tools.Get(tool); !ok {
+		g.SendText(msg, fmt.Sprintf("未知工具: %s", tool))
+		return true
+	}
+
+	var err error
+	switch verb {
+	case "enable":
+		err = g.toggles.Set(key, tool, true)
+	case "disable":
+		err = g.toggles.Set(key, tool, false)
+	case "reset":
+		err = g.toggles.Reset(key, tool)
+	}
+	if err != nil {
+		logger.Error("Failed to switch tool", slog.String("tool", tool), slog.String("scope", key), slog.Any("error", err))
+		g.SendText(msg, fmt.Sprintf("%s: 设置工具开关失败: %s", name, err.Error()))
+		return true
+	}
+	g.SendText(msg, fmt.Sprintf("%s: %s 已%s", name, tool, map[string]string{
+		"enable":  "启用",
+		"disable": "禁用",
+		"reset":   "恢复默认",
+	}[verb]))
+	return true
+}
+
+func (g *gptCommandMiddleware) onToolList(msg contract.GenericMessage, key, name string) bool {
+	switches, err := g.toggles.List(key)
+	if err != nil {
+		logger.Error("Failed to list tool switches", slog.String("scope", key), slog.Any("error", err))
+		g.SendText(msg, "获取工具开关失败")
+		return true
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s的工具:\n", name)
+	for _, tool := range g.tools.Tools() {
+		enabled, ok := switches[tool.Name()]
+		if !ok && key == msg.GetTarget() {
+			// the current chat falls back to the default of its scope
+			enabled, _ = g.toggles.Enabled(key, msg.IsGroup(), tool.Name())
+		}
+		switch {
+		case !ok && key != msg.GetTarget():
+			text.WriteString("➖ ")
+		case enabled:
+			text.WriteString("✅ ")
+		default:
+			text.WriteString("🚫 ")
+		}
+		text.WriteString(tool.Name())
+		if access := tooling.RequiredAccess(tool); access != 0 {
+			fmt.Fprintf(&text, " (需要 %s 权限)", access)
+		}
+		text.WriteString("\n")
+	}
+	if key != msg.GetTarget() {
+		text.WriteString("➖ 表示跟随默认开关")
+	}
+	g.SendText(msg, strings.TrimSpace(text.String()))
+	return true
+}
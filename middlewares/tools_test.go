@@ -0,0 +1,110 @@
+package middlewares_test
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"focalors-go/middlewares/testkit"
+)
+
+// offeredTools returns the names of the tools offered to the model in a request
+func offeredTools(request map[string]any) []string {
+	var names []string
+	tools, _ := request["tools"].([]any)
+	for _, tool := range tools {
+		function := tool.(map[string]any)["function"].(map[string]any)
+		names = append(names, function["name"].(string))
+	}
+	return names
+}
+
+func TestToolCommandIsAdminOnly(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk { return nil })
+	h := newOpenAIHarness(t, server)
+
+	h.Send(testkit.NewMessage("#tool -s group disable reminder").From("u1"))
+	if switches, _ := h.KV.HGetAll("tools:@group"); len(switches) > 0 {
+		t.Errorf("a user who is not an admin switched tools: %v", switches)
+	}
+}
+
+func TestToolCommandScopes(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		return []chunk{{content: "ok"}}
+	})
+	h := newOpenAIHarness(t, server)
+	h.KV.Set("access:g1", "1", 0)
+	h.KV.Set("access:g2", "1", 0)
+	// offered reports whether the reminder tool is offered for the next question in the chat
+	offered := func(groupId string) bool {
+		t.Helper()
+		h.Client.Reset()
+		msg := testkit.NewMessage("hi").From("u1")
+		if groupId != "" {
+			msg = msg.InGroup(groupId).MentionBot()
+		}
+		n := server.count()
+		h.Send(msg)
+		h.AssertUpdatedContains(h.LastSent().Id, "ok")
+		return slices.Contains(offeredTools(server.request(n)), "reminder")
+	}
+	admin := func(text string, want string) {
+		t.Helper()
+		h.Client.Reset()
+		h.Send(testkit.NewMessage(text).From(testkit.Admin))
+		h.AssertSentContains(want)
+	}
+
+	admin("#tool -s group disable reminder", "所有群聊: reminder 已禁用")
+	if offered("g1") || offered("g2") {
+		t.Error("reminder offered in groups")
+	}
+	if !offered("") {
+		t.Error("reminder not offered in private chats")
+	}
+
+	// the switch of a chat wins over its scope
+	admin("#tool -u g1 enable reminder", "g1: reminder 已启用")
+	if !offered("g1") || offered("g2") {
+		t.Error("reminder is not enabled for g1 only")
+	}
+	admin("#tool -s private disable reminder", "所有私聊: reminder 已禁用")
+	if offered("") {
+		t.Error("reminder offered in private chats")
+	}
+	admin("#tool -s private reset reminder", "所有私聊: reminder 已恢复默认")
+	if !offered("") {
+		t.Error("reminder not offered after the reset")
+	}
+
+	admin("#tool -s group list", "🚫 reminder")
+	admin("#tool -s group disable nope", "未知工具: nope")
+	admin("#tool -s all list", "未知范围")
+}
+
+func TestToolDisabledToolIsRefused(t *testing.T) {
+	server := newCompletionServer(t, func(n int, request map[string]any) []chunk {
+		if n == 1 {
+			// the model calls the tool although it is not offered
+			return []chunk{{toolName: "reminder", toolArgs: `{"action":"list"}`}}
+		}
+		return []chunk{{content: "done"}}
+	})
+	h := newOpenAIHarness(t, server)
+	h.Send(testkit.NewMessage("#tool -s private disable reminder").From(testkit.Admin))
+	h.AssertSentContains("已禁用")
+
+	h.Client.Reset()
+	h.Send(testkit.NewMessage("我有什么提醒").From("u1"))
+	h.AssertUpdatedContains(h.LastSent().Id, "done")
+	if slices.Contains(offeredTools(server.request(0)), "reminder") {
+		t.Error("the disabled tool is offered")
+	}
+	messages := server.request(1)["messages"].([]any)
+	last := messages[len(messages)-1].(map[string]any)
+	if last["role"] != "tool" || !strings.Contains(fmt.Sprint(last["content"]), "not available") {
+		t.Errorf("the call is not refused: %v", last)
+	}
+}
@@ -0,0 +1,121 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"focalors-go/contract"
+	"focalors-go/service"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// the forecast covers today and the next three days
+const weatherMaxDays = 4
+
+const weatherUsage = "用法: #天气 <城市> [-d 天数]\n  -d 天数  预报天数, 1-4, 默认只看实况和今天"
+
+type weatherMiddleware struct {
+	*MiddlewareContext
+	weather *service.WeatherService
+}
+
+func NewWeatherMiddleware(base *MiddlewareContext) Middleware {
+	if base.cfg.Weather.Key == "" {
+		return nil
+	}
+	return &weatherMiddleware{
+		MiddlewareContext: base,
+		weather:           service.NewWeatherService(&base.cfg.Weather),
+	}
+}
+
+func (w *weatherMiddleware) OnMessage(ctx context.Context, msg contract.GenericMessage) bool {
+	fs := contract.ToFlagSet(msg, "天气")
+	if fs == nil {
+		return false
+	}
+	var days int
+	fs.IntVar(&days, "d", 1, "预报天数, 1-4")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), weatherUsage)
+	}
+	if help := fs.Parse(); help != "" {
+		w.SendText(msg, help)
+		return true
+	}
+	// the flag set stops at the city, e.g. "#天气 深圳 -d 3": take the words up to the next flag and parse the rest again
+	var city []string
+	for args := fs.Args(); len(args) > 0; args = fs.Args() {
+		i := slices.IndexFunc(args, func(arg string) bool { return len(arg) > 1 && arg[0] == '-' })
+		if i < 0 {
+			city = append(city, args...)
+			break
+		}
+		city = append(city, args[:i]...)
+		if err := fs.FlagSet.Parse(args[i:]); err != nil {
+			w.SendText(msg, weatherUsage)
+			return true
+		}
+	}
+	location := strings.Join(city, "")
+	if location == "" {
+		w.SendText(msg, weatherUsage)
+		return true
+	}
+	if days < 1 || days > weatherMaxDays {
+		w.SendText(msg, fmt.Sprintf("预报天数必须在1-%d之间", weatherMaxDays))
+		return true
+	}
+
+	sender := w.SendPendingReply(msg)
+	forecasts, err := w.weather.GetForecast(ctx, location)
+	if err != nil || len(forecasts) == 0 {
+		logger.Error("Failed to get weather forecast", slog.String("location", location), slog.Any("error", err))
+		sender.SendMarkdown(fmt.Sprintf("获取%s的天气失败", location))
+		return true
+	}
+	// the live weather only adds to the card, the forecast is enough without it
+	var live *service.WeatherLive
+	if lives, err := w.weather.GetWeather(ctx, location); err != nil {
+		logger.Warn("Failed to get live weather", slog.String("location", location), slog.Any("error", err))
+	} else if len(lives) > 0 {
+		live = &lives[0]
+	}
+	sender.SendRichCard(buildWeatherCard(live, &forecasts[0], days))
+	return true
+}
+
+// buildWeatherCard shows the live weather followed by one row per forecast day
+func buildWeatherCard(live *service.WeatherLive, forecast *service.WeatherForecast, days int) *contract.CardBuilder {
+	card := contract.NewCardBuilder().AddHeader(fmt.Sprintf("%s %s 天气", forecast.Province, forecast.City))
+	if live != nil {
+		card.AddMarkdown(fmt.Sprintf("**实况** %s %s %s°C\n%s风 %s级 · 湿度 %s%%",
+			service.WeatherIcon(live.Weather), live.Weather, live.Temperature,
+			live.WindDirection, live.WindPower, live.Humidity,
+		))
+	}
+	for i, cast := range forecast.Casts {
+		if i >= days {
+			break
+		}
+		if live != nil || i > 0 {
+			card.AddDivider()
+		}
+		weather := cast.DayWeather
+		if cast.NightWeather != cast.DayWeather {
+			weather += " 转 " + cast.NightWeather
+		}
+		day := cast.Weekday()
+		if i == 0 {
+			day = "今天"
+		}
+		card.AddMarkdown(fmt.Sprintf("**%s %s** %s %s\n🌡 %s~%s°C · %s风 %s级",
+			cast.Date[strings.Index(cast.Date, "-")+1:], day,
+			service.WeatherIcon(cast.DayWeather), weather,
+			cast.NightTemp, cast.DayTemp, cast.DayWind, cast.DayPower,
+		))
+	}
+	card.AddMarkdown(fmt.Sprintf("发布于 %s", forecast.ReportTime))
+	return card
+}
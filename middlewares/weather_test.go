@@ -0,0 +1,34 @@
+package middlewares_test
+
+import (
+	"focalors-go/config"
+	"focalors-go/middlewares"
+	"focalors-go/middlewares/testkit"
+	"testing"
+)
+
+// the flags are checked before any request, so these run without a weather API
+func TestWeatherFlags(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"#天气 深圳 -d 9", "预报天数必须在1-4之间"},
+		{"#天气 -d 9 深圳", "预报天数必须在1-4之间"},
+		{"#天气 深圳 -d 2 -d 0", "预报天数必须在1-4之间"},
+		{"#天气 广东 深圳 -d 5", "预报天数必须在1-4之间"},
+		{"#天气 深圳 -d", "用法"},
+		{"#天气 深圳 -x", "用法"},
+		{"#天气 深圳 -h", "用法"},
+		{"#天气 -d 3", "用法"},
+		{"#天气", "用法"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			h := testkit.New(t, func(cfg *config.Config) { cfg.Weather.Key = "key" })
+			h.Use(middlewares.NewWeatherMiddleware)
+			h.Send(testkit.NewMessage(tt.command).From("u1"))
+			h.AssertSentContains(tt.want)
+		})
+	}
+}
@@ -2,86 +2,325 @@ package middlewares
 
 import (
 	"context"
+	"fmt"
 	"focalors-go/contract"
+	"focalors-go/service"
 	"focalors-go/service/yunzai"
 	"log/slog"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
+// how long the replies of Yunzai are threaded to the command, the pending card of
+// a command without reply is recalled afterwards
+const yunzaiPendingTTL = 2 * time.Minute
+
+// how long Yunzai may take before the pending card is shown, most commands are answered sooner
+const yunzaiPendingDelay = 1500 * time.Millisecond
+
+// how long images a user sends are forwarded to the backend that took their last command in the chat,
+// for plugins asking for an image after the command, e.g. "#上传面板图" then the picture
+const yunzaiImageTTL = 2 * time.Minute
+
+// yunzaiRecent is the backend that took the last command of a user in a chat
+type yunzaiRecent struct {
+	backend *yunzaiBackend
+	at      time.Time
+}
+
+// yunzaiPending is a command waiting for the replies of Yunzai
+type yunzaiPending struct {
+	mu       sync.Mutex
+	sender   *PendingSender
+	answered bool // a reply came or the command was forgotten, the pending card is not needed anymore
+}
+
+// yunzaiBackend is a gsuid backend and the commands it takes
+type yunzaiBackend struct {
+	name    string
+	y       *yunzai.YunzaiClient
+	pattern *regexp.Regexp
+	groups  []string
+	private bool // with groups, also take private chats
+}
+
+// accepts reports whether the backend takes the command in the chat of msg. A backend restricted
+// to groups takes private chats only with private set.
+func (yb *yunzaiBackend) accepts(msg contract.GenericMessage) bool {
+	if !yb.pattern.MatchString(msg.GetText()) {
+		return false
+	}
+	if len(yb.groups) == 0 {
+		return true
+	}
+	if !msg.IsGroup() {
+		return yb.private
+	}
+	return slices.Contains(yb.groups, msg.GetGroupId())
+}
+
 type yunzaiMiddleware struct {
 	*MiddlewareContext
-	y *yunzai.YunzaiClient
+	backends  []*yunzaiBackend
+	pendingMu sync.Mutex                // guards pending and recent
+	pending   map[string]*yunzaiPending // by the id of the command message
+	recent    map[string]yunzaiRecent   // by recentKey
 }
 
 func NewYunzaiMiddleware(base *MiddlewareContext) Middleware {
-	// create new yunzai client
-	y := yunzai.NewYunzai(base.cfg)
+	var backends []*yunzaiBackend
+	for _, cfg := range base.cfg.Yunzai.BackendList() {
+		pattern, err := regexp.Compile(cfg.Pattern())
+		if err != nil {
+			logger.Error("Invalid yunzai backend regex", slog.String("backend", cfg.Name), slog.Any("error", err))
+			continue
+		}
+		backends = append(backends, &yunzaiBackend{
+			name:    cfg.Name,
+			y:       yunzai.NewYunzai(cfg.Server),
+			pattern: pattern,
+			groups:  cfg.Groups,
+			private: cfg.Private,
+		})
+	}
+	if len(backends) == 0 {
+		return nil
+	}
 	return &yunzaiMiddleware{
 		MiddlewareContext: base,
-		y:                 y,
+		backends:          backends,
+		pending:           make(map[string]*yunzaiPending),
+		recent:            make(map[string]yunzaiRecent),
 	}
 }
 
-func (b *yunzaiMiddleware) syncAvatars() {
+// syncAvatars uploads the stored avatars to a backend, every backend renders its own panels
+func (b *yunzaiMiddleware) syncAvatars(backend *yunzaiBackend) {
 	storedAvatars, err := b.avatarStore.List()
 	if err != nil {
 		logger.Warn("Failed to load avatars from store", slog.Any("error", err))
 		return
 	}
 	for key, image := range storedAvatars {
-		logger.Info("Loaded avatar from store", slog.String("userId", key), slog.Int("imageSize", len(image)))
-		b.y.RefreshAvatar(key, image)
+		logger.Info("Loaded avatar from store", slog.String("backend", backend.name), slog.String("userId", key), slog.Int("imageSize", len(image)))
+		backend.y.RefreshAvatar(key, image)
 	}
 }
 
 func (b *yunzaiMiddleware) Start() error {
-	b.y.AddMessageHandler(b.onYunzaiMessage)
-	b.y.OnConnect(b.syncAvatars)
-	go b.y.Start(b.ctx)
+	for _, backend := range b.backends {
+		backend.y.AddMessageHandler(func(ctx context.Context, msg *yunzai.Response) bool {
+			return b.onYunzaiMessage(ctx, backend, msg)
+		})
+		backend.y.OnConnect(func() { b.syncAvatars(backend) })
+		go backend.y.Start(b.ctx)
+	}
 	b.avatarStore.Watch(func(userId string, content string) {
 		logger.Info("Avatar updated, refreshing in Yunzai", slog.String("userId", userId), slog.Int("contentSize", len(content)))
-		b.y.RefreshAvatar(userId, content)
+		for _, backend := range b.backends {
+			backend.y.RefreshAvatar(userId, content)
+		}
 	})
 	return nil
 }
 
 func (b *yunzaiMiddleware) OnMessage(ctx context.Context, msg contract.GenericMessage) bool {
-	if !msg.IsText() || !regexp.MustCompile(`^[#*%]`).MatchString(msg.GetText()) {
+	if msg.IsImage() {
+		// other middlewares still see the image, e.g. for GPT vision
+		b.forwardImage(msg)
 		return false
 	}
-
-	userType := "direct"
-	if msg.IsGroup() {
-		userType = "group"
+	if !msg.IsText() {
+		return false
+	}
+	i := slices.IndexFunc(b.backends, func(backend *yunzaiBackend) bool { return backend.accepts(msg) })
+	if i < 0 {
+		return false
 	}
+	backend := b.backends[i]
 
 	text := strings.TrimPrefix(msg.GetText(), "#!")
 	if strings.Contains(text, "排名") && !b.avatarStore.Has(msg.GetUserId()) {
 		b.SendText(msg, "你还没有上传头像，请私聊发送 #上传头像")
 	}
 
+	b.rememberBackend(msg, backend)
+	// remembered before sending, the reply may arrive before Send returns
+	b.remember(msg)
+	if err := b.send(backend, msg, b.requestContent(msg, text)); err != nil {
+		b.forget(msg.GetId())
+	}
+	return true
+}
+
+// rememberBackend records the backend taking a command, images of the user follow it for yunzaiImageTTL
+func (b *yunzaiMiddleware) rememberBackend(msg contract.GenericMessage, backend *yunzaiBackend) {
+	key := recentKey(msg)
+	recent := yunzaiRecent{backend: backend, at: time.Now()}
+	b.pendingMu.Lock()
+	b.recent[key] = recent
+	b.pendingMu.Unlock()
+	time.AfterFunc(yunzaiImageTTL, func() {
+		b.pendingMu.Lock()
+		defer b.pendingMu.Unlock()
+		// unless a later command renewed it
+		if b.recent[key] == recent {
+			delete(b.recent, key)
+		}
+	})
+}
+
+// forwardImage sends an image to the backend that took the last command of the user in the chat
+// within yunzaiImageTTL. Images sent without a command before are not forwarded.
+func (b *yunzaiMiddleware) forwardImage(msg contract.GenericMessage) {
+	b.pendingMu.Lock()
+	recent, ok := b.recent[recentKey(msg)]
+	b.pendingMu.Unlock()
+	if !ok {
+		return
+	}
+	image, err := b.client.DownloadMessageImage(msg.GetId())
+	if err != nil {
+		logger.Warn("Failed to download image for yunzai", slog.String("msgId", msg.GetId()), slog.Any("error", err))
+		return
+	}
+	b.send(recent.backend, msg, []yunzai.MessageContent{{Type: "image", Data: "base64://" + image}})
+}
+
+// recentKey identifies a user in a chat
+func recentKey(msg contract.GenericMessage) string {
+	return msg.GetTarget() + ":" + msg.GetUserId()
+}
+
+// send forwards the content of a message to a backend
+func (b *yunzaiMiddleware) send(backend *yunzaiBackend, msg contract.GenericMessage, content []yunzai.MessageContent) error {
+	userType := "direct"
+	if msg.IsGroup() {
+		userType = "group"
+	}
 	sent := yunzai.Request{
 		BotSelfId: "focalors",
 		MsgId:     msg.GetId(),
 		UserId:    msg.GetUserId(),
 		GroupId:   msg.GetGroupId(),
-		UserPM:    0,
+		UserPM:    b.userPM(msg.GetUserId()),
 		UserType:  userType,
-		Content: []yunzai.MessageContent{
-			{
-				Type: "text",
-				Data: text,
-			},
-		},
-	}
-	logger.Debug("Sending message to yunzai", slog.Any("request", sent))
-	b.y.Send(sent)
-	return true
+		Content:   content,
+		Sender:    b.sender(msg.GetUserId()),
+	}
+	logger.Debug("Sending message to yunzai", slog.String("backend", backend.name), slog.Any("request", sent))
+	err := backend.y.Send(sent)
+	if err != nil {
+		logger.Error("Failed to send message to yunzai", slog.String("backend", backend.name), slog.Any("error", err))
+	}
+	return err
+}
+
+// remember threads the replies of Yunzai with the MsgId of the command to it until yunzaiPendingTTL
+// passes. A pending card is shown only if Yunzai did not answer within yunzaiPendingDelay, then the
+// first reply takes its place.
+func (b *yunzaiMiddleware) remember(msg contract.GenericMessage) {
+	msgId := msg.GetId()
+	if msgId == "" {
+		return
+	}
+	pending := &yunzaiPending{sender: NewReplySender(b.client, msg, "", msgId)}
+	b.pendingMu.Lock()
+	b.pending[msgId] = pending
+	b.pendingMu.Unlock()
+	time.AfterFunc(yunzaiPendingDelay, func() { b.showPending(pending, msg) })
+	time.AfterFunc(yunzaiPendingTTL, func() { b.forget(msgId) })
+}
+
+// showPending sends the pending card of a command Yunzai has not answered yet
+func (b *yunzaiMiddleware) showPending(pending *yunzaiPending, msg contract.GenericMessage) {
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+	if !pending.answered {
+		pending.sender = b.SendPendingReply(msg)
+	}
+}
+
+// forget stops threading the replies of a command, the pending card is recalled if Yunzai did not answer
+func (b *yunzaiMiddleware) forget(msgId string) {
+	b.pendingMu.Lock()
+	pending, ok := b.pending[msgId]
+	delete(b.pending, msgId)
+	b.pendingMu.Unlock()
+	if !ok {
+		return
+	}
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+	pending.answered = true
+	pending.sender.recallPending()
+}
+
+func (b *yunzaiMiddleware) pendingOf(msgId string) *yunzaiPending {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	return b.pending[msgId]
 }
 
-func (b *yunzaiMiddleware) logYunzaiMessage(msg *yunzai.Response) bool {
+// userPM maps the admins of the bot to the master of Yunzai and the "yunzai-admin" access to its admins
+func (b *yunzaiMiddleware) userPM(userId string) int {
+	if b.access.IsAdmin(userId) {
+		return yunzai.UserPMMaster
+	}
+	if ok, err := b.access.HasAccess(userId, service.YunzaiAdminAccess); err != nil {
+		logger.Warn("Failed to check yunzai admin access", slog.String("userId", userId), slog.Any("error", err))
+	} else if ok {
+		return yunzai.UserPMAdmin
+	}
+	return yunzai.UserPMUser
+}
+
+// requestContent builds the segments of a command: the text, the users mentioned, and the quoted
+// message along with its image, so plugins can work on an image the command replies to
+func (b *yunzaiMiddleware) requestContent(msg contract.GenericMessage, text string) []yunzai.MessageContent {
+	content := []yunzai.MessageContent{{Type: "text", Data: text}}
+	selfId := contract.GetSelfUserIdFor(b.client, msg.GetTarget())
+	for _, user := range msg.GetMentionedUsers() {
+		if user.UserId == selfId {
+			continue
+		}
+		content = append(content, yunzai.MessageContent{Type: "at", Data: user.UserId})
+	}
+	refer, ok := msg.GetReferMessage()
+	if !ok {
+		return content
+	}
+	if refer.GetId() != "" {
+		content = append(content, yunzai.MessageContent{Type: "reply", Data: refer.GetId()})
+	}
+	if refer.IsImage() {
+		image, err := b.client.DownloadMessageImage(refer.GetId())
+		if err != nil {
+			logger.Warn("Failed to download image for yunzai", slog.String("msgId", refer.GetId()), slog.Any("error", err))
+		} else {
+			content = append(content, yunzai.MessageContent{Type: "image", Data: "base64://" + image})
+		}
+	}
+	return content
+}
+
+// sender describes the user to Yunzai by nickname, avatars reach the backends through RefreshAvatar
+func (b *yunzaiMiddleware) sender(userId string) map[string]any {
+	var nickname string
+	if contacts, err := b.client.GetContactDetail(userId); err != nil {
+		logger.Warn("Failed to get contact details", slog.String("userId", userId), slog.Any("error", err))
+	} else if len(contacts) > 0 {
+		nickname = contacts[0].Nickname()
+	}
+	return yunzai.NewSender(nickname)
+}
+
+func (b *yunzaiMiddleware) logYunzaiMessage(backend *yunzaiBackend, msg *yunzai.Response) bool {
 	logger.Info("Received Yunzai message",
+		slog.String("Backend", backend.name),
 		slog.String("BotId", msg.BotSelfId),
 		slog.String("TargetId", msg.TargetId),
 	)
@@ -100,41 +339,24 @@ func (b *yunzaiMiddleware) logYunzaiMessage(msg *yunzai.Response) bool {
 	return false
 }
 
-func (b *yunzaiMiddleware) onYunzaiMessage(ctx context.Context, msg *yunzai.Response) bool {
-	b.logYunzaiMessage(msg)
+// onYunzaiMessage sends a reply of the backend to the chat it is meant for, the target
+// of the reply is the group or user id of the request
+func (b *yunzaiMiddleware) onYunzaiMessage(ctx context.Context, backend *yunzaiBackend, msg *yunzai.Response) bool {
+	b.logYunzaiMessage(backend, msg)
 	// its rare to has extra message push from yunzai
 	queue := make([]yunzai.MessageContent, len(msg.Content))
 	copy(queue, msg.Content)
 	front := 0
 	card := contract.NewCardBuilder()
+	var target contract.SendTarget = msg
+	redirected := false
+	var replyTo string
+	// set by image_size, applies to the next image
+	var size yunzai.ImageSize
 	for front < len(queue) {
 		content := queue[front]
 		front++
-		switch content.Type {
-		case "text":
-			textContent, ok := content.Data.(string)
-			if !ok {
-				logger.Error("Failed to convert content to string", slog.Any("content", content))
-				continue
-			}
-			textContent = strings.Trim(textContent, " \n")
-			if textContent != "" {
-				card.AddMarkdown(textContent)
-			}
-		case "image":
-			imageContent, ok := content.Data.(string)
-			if !ok {
-				logger.Error("Failed to convert content to string", slog.Any("content", content))
-				continue
-			}
-			// b.SendImage(msg, imageContent)
-			if key, err := b.client.UploadImage(imageContent); err != nil {
-				logger.Error("Failed to upload image", slog.Any("error", err))
-				card.AddMarkdown("*上传图片失败*")
-			} else {
-				card.AddImage(key, "")
-			}
-		case "node":
+		if content.Type == "node" {
 			nodeContent, ok := content.Data.([]any)
 			if !ok {
 				logger.Error("Failed to convert content to []any", slog.Any("content", content))
@@ -153,16 +375,113 @@ func (b *yunzaiMiddleware) onYunzaiMessage(ctx context.Context, msg *yunzai.Resp
 					}
 				}
 			}
+			continue
+		}
+
+		switch content.Type {
+		case "image_size":
+			var err error
+			if size, err = content.ImageSize(); err != nil {
+				logger.Warn("Invalid image size", slog.Any("content", content), slog.Any("error", err))
+			}
+			continue
+		case "buttons":
+			rows, err := content.Buttons()
+			if err != nil {
+				logger.Error("Failed to decode buttons", slog.Any("content", content), slog.Any("error", err))
+				continue
+			}
+			card.AddButtons(toCardButtons(rows))
+			continue
+		case "template_buttons":
+			// templates are registered on the QQ open platform, there is nothing to render
+			logger.Debug("Ignoring template buttons", slog.Any("content", content))
+			continue
+		}
+
+		data, ok := content.Text()
+		if !ok {
+			logger.Error("Failed to convert content to string", slog.Any("content", content))
+			continue
+		}
+		switch content.Type {
+		case "text", "markdown":
+			data = strings.Trim(data, " \n")
+			if data != "" {
+				card.AddMarkdown(data)
+			}
+		case "image":
+			image, err := backend.y.LoadImage(ctx, data)
+			if err != nil {
+				logger.Error("Failed to load image", slog.Any("error", err))
+				card.AddMarkdown("*下载图片失败*")
+				continue
+			}
+			if key, err := b.client.UploadImage(image); err != nil {
+				logger.Error("Failed to upload image", slog.Any("error", err))
+				card.AddMarkdown("*上传图片失败*")
+			} else {
+				card.AddSizedImage(key, "", size.Width, size.Height)
+			}
+			size = yunzai.ImageSize{}
+		case "reply":
+			replyTo = data
+		case "at":
+			name := data
+			if contacts, err := b.client.GetContactDetail(data); err == nil && len(contacts) > 0 {
+				name = contacts[0].Nickname()
+			}
+			card.AddMention(data, name)
+		case "file":
+			// "<name>|<base64>", cards can not carry files
+			name, _, _ := strings.Cut(data, "|")
+			card.AddMarkdown(fmt.Sprintf("📎 %s (暂不支持发送文件)", name))
+		case "group":
+			// the message is meant for another group
+			target = contract.NewTarget(data)
+			redirected = true
 		default:
 			logger.Warn("Unsupported message type", slog.Any("content", content))
 		}
 	}
-	if len(card.Elements) > 0 {
-		b.client.SendRichCard(msg, card)
+	if len(card.Elements) == 0 {
+		return false
+	}
+	if pending := b.pendingOf(msg.MsgId); pending != nil && !redirected {
+		// the first reply takes the place of the pending card if it is shown, the others reply to the command
+		pending.mu.Lock()
+		defer pending.mu.Unlock()
+		pending.answered = true
+		if _, err := pending.sender.SendRichCard(card); err != nil {
+			logger.Error("Failed to reply yunzai message", slog.Any("error", err))
+		}
+		return false
+	}
+	if replyTo != "" {
+		if _, err := b.client.ReplyRichCard(replyTo, target, card); err != nil {
+			logger.Error("Failed to reply yunzai message", slog.Any("error", err))
+		}
+		return false
+	}
+	if _, err := b.client.SendRichCard(target, card); err != nil {
+		logger.Error("Failed to send yunzai message", slog.Any("error", err))
 	}
 	return false
 }
 
+// toCardButtons maps gsuid buttons to card buttons, clicking a command button sends its data
+func toCardButtons(rows [][]yunzai.Button) [][]contract.Button {
+	buttons := make([][]contract.Button, 0, len(rows))
+	for _, row := range rows {
+		cardRow := make([]contract.Button, 0, len(row))
+		for _, button := range row {
+			cardRow = append(cardRow, contract.Button{Text: button.Text, Data: button.Data})
+		}
+		buttons = append(buttons, cardRow)
+	}
+	return buttons
+}
+
 // func (b *yunzaiMiddleware) updateAvatarCache(msg contract.GenericMessage) {
 // 	var triggers = regexp.MustCompile(`^[#*%]更新(面板|头像)`)
 // 	if msg.IsText() && triggers.MatchString(msg.GetText()) {
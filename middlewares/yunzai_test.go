@@ -0,0 +1,337 @@
+package middlewares_test
+
+import (
+	"fmt"
+	"focalors-go/config"
+	"focalors-go/middlewares"
+	"focalors-go/middlewares/testkit"
+	"focalors-go/service/yunzai"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeYunzai is a gsuid backend recording the requests it receives
+type fakeYunzai struct {
+	*httptest.Server
+	requests chan yunzai.Request
+	mu       sync.Mutex
+	conn     *websocket.Conn
+}
+
+func newFakeYunzai(t *testing.T) *fakeYunzai {
+	f := &fakeYunzai{requests: make(chan yunzai.Request, 64)}
+	upgrader := websocket.Upgrader{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conn = conn
+		f.mu.Unlock()
+		for {
+			var req yunzai.Request
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			f.requests <- req
+		}
+	}))
+	t.Cleanup(func() {
+		f.mu.Lock()
+		if f.conn != nil {
+			f.conn.Close()
+		}
+		f.mu.Unlock()
+		f.Close()
+	})
+	return f
+}
+
+func (f *fakeYunzai) url() string {
+	return "ws" + strings.TrimPrefix(f.URL, "http")
+}
+
+// next returns the next command, skipping the avatar refreshes
+func (f *fakeYunzai) next(t *testing.T) yunzai.Request {
+	t.Helper()
+	for {
+		select {
+		case req := <-f.requests:
+			if strings.HasPrefix(req.MsgId, "meta_") {
+				continue
+			}
+			return req
+		case <-time.After(testkit.WaitTimeout):
+			t.Fatal("no request received")
+		}
+	}
+}
+
+// assertIdle fails if a command arrives within a short while
+func (f *fakeYunzai) assertIdle(t *testing.T) {
+	t.Helper()
+	for {
+		select {
+		case req := <-f.requests:
+			if !strings.HasPrefix(req.MsgId, "meta_") {
+				t.Fatalf("unexpected request: %+v", req)
+			}
+		case <-time.After(100 * time.Millisecond):
+			return
+		}
+	}
+}
+
+// collect returns the next n requests, avatar refreshes included
+func (f *fakeYunzai) collect(t *testing.T, n int) []yunzai.Request {
+	t.Helper()
+	var requests []yunzai.Request
+	for len(requests) < n {
+		select {
+		case req := <-f.requests:
+			requests = append(requests, req)
+		case <-time.After(testkit.WaitTimeout):
+			t.Fatalf("%d of %d requests received", len(requests), n)
+		}
+	}
+	return requests
+}
+
+func (f *fakeYunzai) reply(t *testing.T, resp yunzai.Response) {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.conn.WriteJSON(resp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newYunzaiHarness connects the middleware to the backends in the given order and waits until all of them
+// are connected, the server of each config is set to its fake
+func newYunzaiHarness(t *testing.T, fakes []*fakeYunzai, backends ...config.YunzaiBackendConfig) *testkit.Harness {
+	h := testkit.New(t, func(cfg *config.Config) {
+		for i, backend := range backends {
+			backend.Server = fakes[i].url()
+			cfg.Yunzai.Backends = append(cfg.Yunzai.Backends, backend)
+		}
+	})
+	// every backend gets the stored avatars once connected, the first request tells it is ready
+	h.KV.Set("avatar:u:ready", "aGk=", 0)
+	h.Use(middlewares.NewYunzaiMiddleware)
+	for _, fake := range fakes {
+		select {
+		case req := <-fake.requests:
+			if req.MsgId != "meta_ready" {
+				t.Fatalf("unexpected first request: %+v", req)
+			}
+		case <-time.After(testkit.WaitTimeout):
+			t.Fatal("yunzai backend not connected")
+		}
+	}
+	return h
+}
+
+func TestYunzaiForwardsCommand(t *testing.T) {
+	fake := newFakeYunzai(t)
+	h := newYunzaiHarness(t, []*fakeYunzai{fake}, config.YunzaiBackendConfig{Name: "gs"})
+	h.Client.Contacts["u1"] = "Alice"
+	h.Client.Images["quoted"] = "aW1n"
+
+	quoted := testkit.NewImageMessage().WithId("quoted")
+	h.Send(testkit.NewMessage("#面板").From("u1").InGroup("g1").Mention("u2").ReplyTo(quoted))
+	req := fake.next(t)
+	if req.UserId != "u1" || req.GroupId != "g1" || req.UserType != "group" || req.UserPM != yunzai.UserPMUser {
+		t.Errorf("request = %+v", req)
+	}
+	want := []yunzai.MessageContent{
+		{Type: "text", Data: "#面板"},
+		{Type: "at", Data: "u2"},
+		{Type: "reply", Data: "quoted"},
+		{Type: "image", Data: "base64://aW1n"},
+	}
+	if len(req.Content) != len(want) {
+		t.Fatalf("content = %+v, want %+v", req.Content, want)
+	}
+	for i := range want {
+		if req.Content[i] != want[i] {
+			t.Errorf("content[%d] = %+v, want %+v", i, req.Content[i], want[i])
+		}
+	}
+	if len(req.Sender) != 1 || req.Sender["nickname"] != "Alice" {
+		t.Errorf("sender = %v, want the nickname only", req.Sender)
+	}
+}
+
+func TestYunzaiForwardsImagesAfterCommand(t *testing.T) {
+	fake := newFakeYunzai(t)
+	h := newYunzaiHarness(t, []*fakeYunzai{fake}, config.YunzaiBackendConfig{Name: "gs"})
+
+	image := func(userId, groupId string) *testkit.Message {
+		msg := testkit.NewImageMessage().From(userId).InGroup(groupId)
+		h.Client.Images[msg.Id] = "aW1n"
+		return msg
+	}
+	// no command before
+	if h.Send(image("u1", "g1")) {
+		t.Error("images are left to the next middlewares")
+	}
+	fake.assertIdle(t)
+
+	h.Send(testkit.NewMessage("#上传面板图").From("u1").InGroup("g1"))
+	fake.next(t)
+	h.Send(image("u2", "g1"))
+	h.Send(image("u1", "g2"))
+	fake.assertIdle(t)
+
+	msg := image("u1", "g1")
+	h.Send(msg)
+	req := fake.next(t)
+	if req.MsgId != msg.Id || len(req.Content) != 1 || req.Content[0] != (yunzai.MessageContent{Type: "image", Data: "base64://aW1n"}) {
+		t.Errorf("request = %+v, want the image", req)
+	}
+}
+
+func TestYunzaiBackendRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		private bool
+		msg     *testkit.Message
+		want    string // name of the backend taking the command, empty for none
+	}{
+		{"restricted group", false, testkit.NewMessage("*面板").InGroup("g1"), "sr"},
+		{"other group", false, testkit.NewMessage("*面板").InGroup("g2"), "gs"},
+		{"private chat", false, testkit.NewMessage("*面板"), "gs"},
+		{"private chat allowed", true, testkit.NewMessage("*面板"), "sr"},
+		{"private chat allowed, other group", true, testkit.NewMessage("*面板").InGroup("g2"), "gs"},
+		{"no prefix", false, testkit.NewMessage("面板").InGroup("g1"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr, gs := newFakeYunzai(t), newFakeYunzai(t)
+			h := newYunzaiHarness(t, []*fakeYunzai{sr, gs},
+				config.YunzaiBackendConfig{Name: "sr", Prefixes: []string{"*"}, Groups: []string{"g1"}, Private: tt.private},
+				config.YunzaiBackendConfig{Name: "gs"},
+			)
+			if taken := h.Send(tt.msg); taken != (tt.want != "") {
+				t.Errorf("taken = %v", taken)
+			}
+			backends := map[string]*fakeYunzai{"sr": sr, "gs": gs}
+			for name, fake := range backends {
+				if name == tt.want {
+					fake.next(t)
+				} else {
+					fake.assertIdle(t)
+				}
+			}
+		})
+	}
+}
+
+func TestYunzaiQuickReplyWithoutPendingCard(t *testing.T) {
+	fake := newFakeYunzai(t)
+	h := newYunzaiHarness(t, []*fakeYunzai{fake}, config.YunzaiBackendConfig{Name: "gs"})
+
+	cmd := testkit.NewMessage("#帮助").InGroup("g1")
+	h.Send(cmd)
+	req := fake.next(t)
+	for _, text := range []string{"first", "second"} {
+		fake.reply(t, yunzai.Response{TargetId: "g1", MsgId: req.MsgId, Content: []yunzai.MessageContent{{Type: "text", Data: text}}})
+	}
+	sent := h.WaitSent(2)
+	for i, text := range []string{"first", "second"} {
+		if sent[i].ReplyTo != cmd.Id || testkit.CardText(sent[i].Card) != text {
+			t.Errorf("sent[%d] = %q replying to %q, want %q replying to the command", i, testkit.CardText(sent[i].Card), sent[i].ReplyTo, text)
+		}
+	}
+	// the delay passes without a pending card
+	time.Sleep(2 * time.Second)
+	if sent := h.Client.Sent(); len(sent) != 2 {
+		t.Errorf("%d cards sent, want only the replies", len(sent))
+	}
+}
+
+func TestYunzaiSlowReplyReplacesPendingCard(t *testing.T) {
+	fake := newFakeYunzai(t)
+	h := newYunzaiHarness(t, []*fakeYunzai{fake}, config.YunzaiBackendConfig{Name: "gs"})
+
+	cmd := testkit.NewMessage("#帮助").InGroup("g1")
+	h.Send(cmd)
+	req := fake.next(t)
+	card := h.AssertSentContains("少女祈祷中")
+	if card.ReplyTo != cmd.Id {
+		t.Errorf("pending card replies to %q, want the command", card.ReplyTo)
+	}
+	fake.reply(t, yunzai.Response{TargetId: "g1", MsgId: req.MsgId, Content: []yunzai.MessageContent{{Type: "text", Data: "done"}}})
+	h.AssertUpdatedContains(card.Id, "done")
+}
+
+// TestYunzaiConcurrentWritesToBackends writes to both sockets from the message handlers, the avatar watcher
+// and the pending timers at once, run with -race
+func TestYunzaiConcurrentWritesToBackends(t *testing.T) {
+	sr, gs := newFakeYunzai(t), newFakeYunzai(t)
+	h := newYunzaiHarness(t, []*fakeYunzai{sr, gs},
+		config.YunzaiBackendConfig{Name: "sr", Prefixes: []string{"*"}},
+		config.YunzaiBackendConfig{Name: "gs", Prefixes: []string{"%"}},
+	)
+	// after yunzai, #上传头像 matches no backend prefix
+	h.Use(middlewares.NewAvatarMiddleware)
+
+	avatar := pngImage(t)
+
+	const n = 8
+	avatars := make([]*testkit.Message, n)
+	images := make([]*testkit.Message, n)
+	for i := range n {
+		avatars[i] = testkit.NewImageMessage().From(fmt.Sprintf("a%d", i))
+		h.Client.Images[avatars[i].Id] = avatar
+		images[i] = testkit.NewImageMessage().From(fmt.Sprintf("c%d", i)).InGroup("g1")
+		h.Client.Images[images[i].Id] = "aW1n"
+	}
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			h.Send(testkit.NewMessage("#上传头像").From(fmt.Sprintf("a%d", i)))
+			h.Send(avatars[i])
+		}()
+		go func() {
+			defer wg.Done()
+			h.Send(testkit.NewMessage("*面板").From(fmt.Sprintf("c%d", i)).InGroup("g1"))
+			h.Send(images[i])
+		}()
+		go func() {
+			defer wg.Done()
+			h.Send(testkit.NewMessage("%面板").From(fmt.Sprintf("c%d", i)).InGroup("g2"))
+		}()
+	}
+	wg.Wait()
+
+	count := func(requests []yunzai.Request) (refreshes, commands int) {
+		for _, req := range requests {
+			if strings.HasPrefix(req.MsgId, "meta_a") {
+				refreshes++
+			} else {
+				commands++
+			}
+		}
+		return
+	}
+	// every avatar reaches both backends, sr also gets the images after the commands
+	if refreshes, commands := count(sr.collect(t, 3*n)); refreshes != n || commands != 2*n {
+		t.Errorf("sr got %d refreshes and %d commands", refreshes, commands)
+	}
+	if refreshes, commands := count(gs.collect(t, 2*n)); refreshes != n || commands != n {
+		t.Errorf("gs got %d refreshes and %d commands", refreshes, commands)
+	}
+	// the pending cards show up while nothing replies
+	h.WaitSent(3 * n)
+}
@@ -0,0 +1,192 @@
+// Package mcp is a minimal Model Context Protocol client, enough to list and call the tools of a server
+// over stdio or streamable HTTP. See https://modelcontextprotocol.io/specification
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"focalors-go/config"
+	"focalors-go/slogger"
+	"log/slog"
+	"sync/atomic"
+)
+
+var logger = slogger.New("protocol.mcp")
+
+const protocolVersion = "2025-03-26"
+
+// transport exchanges JSON-RPC messages with a server
+type transport interface {
+	// call sends a request and waits for the response with the same id
+	call(ctx context.Context, req *request) (*response, error)
+	notify(ctx context.Context, n *request) error
+	close() error
+}
+
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	Id      *int64 `json:"id,omitempty"` // nil for notifications
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// message is any JSON-RPC message received from the server: a response, a request or a notification
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type response = message
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+// Tool is a tool offered by a server, InputSchema is a JSON schema object
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// Content is one item of a tool result
+type Content struct {
+	Type     string            `json:"type"` // "text", "image", "audio", "resource" or "resource_link"
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"` // base64 for images and audio
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+}
+
+// ResourceContents is an embedded resource, with either text or a base64 blob
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError"`
+}
+
+// Client is a session with one MCP server
+type Client struct {
+	name      string
+	transport transport
+	lastId    atomic.Int64
+}
+
+// Connect starts or connects to the server and initializes the session
+func Connect(ctx context.Context, cfg *config.MCPServerConfig) (*Client, error) {
+	var t transport
+	var err error
+	if cfg.Command != "" {
+		t, err = newStdioTransport(cfg)
+	} else {
+		t = newHTTPTransport(cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{name: cfg.Name, transport: t}
+	if err := c.initialize(ctx); err != nil {
+		t.close()
+		return nil, fmt.Errorf("initialize mcp server %s: %w", cfg.Name, err)
+	}
+	return c, nil
+}
+
+func (c *Client) Name() string {
+	return c.name
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "focalors-go", "version": "1.0.0"},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	logger.Info("MCP server initialized", slog.String("name", c.name),
+		slog.String("server", result.ServerInfo.Name), slog.String("version", result.ServerInfo.Version),
+		slog.String("protocol", result.ProtocolVersion))
+	return c.transport.notify(ctx, &request{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	id := c.lastId.Add(1)
+	resp, err := c.transport.call(ctx, &request{JSONRPC: "2.0", Id: &id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+// ListTools returns all tools of the server, following pagination
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var result struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool calls a tool with arguments given as a JSON object
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": arguments}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) Close() error {
+	return c.transport.close()
+}
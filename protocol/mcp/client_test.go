@@ -0,0 +1,125 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"focalors-go/config"
+	"focalors-go/protocol/mcp"
+	"focalors-go/protocol/mcp/mcptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(mcptest.StdioEnv) != "" {
+		mcptest.ServeStdio()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// servers returns a config for every transport, all served by mcptest
+func servers(t *testing.T) map[string]*config.MCPServerConfig {
+	http := mcptest.NewHTTPServer(t)
+	http.Header = [2]string{"Authorization", "Bearer token"}
+	return map[string]*config.MCPServerConfig{
+		"stdio": {Name: "stdio", Command: os.Args[0], Env: []string{mcptest.StdioEnv + "=1"}},
+		"http":  {Name: "http", URL: http.URL, Headers: map[string]string{"authorization": "Bearer token"}},
+	}
+}
+
+func connect(t *testing.T, cfg *config.MCPServerConfig) *mcp.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mcp.Connect(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestListTools(t *testing.T) {
+	for name, cfg := range servers(t) {
+		t.Run(name, func(t *testing.T) {
+			tools, err := connect(t, cfg).ListTools(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, tool := range tools {
+				names = append(names, tool.Name)
+			}
+			if !slices.Equal(names, []string{"echo", "image", "fail"}) {
+				t.Errorf("tools = %v, want both pages", names)
+			}
+			if tools[0].InputSchema["type"] != "object" || tools[0].InputSchema["properties"] == nil {
+				t.Errorf("schema = %v", tools[0].InputSchema)
+			}
+		})
+	}
+}
+
+func TestCallTool(t *testing.T) {
+	for name, cfg := range servers(t) {
+		t.Run(name, func(t *testing.T) {
+			client := connect(t, cfg)
+			tests := []struct {
+				tool    string
+				args    string
+				want    mcp.Content
+				isError bool
+			}{
+				{"echo", `{"text":"hello"}`, mcp.Content{Type: "text", Text: "hello"}, false},
+				{"image", "", mcp.Content{Type: "image", Data: mcptest.Image, MimeType: "image/png"}, false},
+				{"fail", "{}", mcp.Content{Type: "text", Text: "boom"}, true},
+			}
+			for _, tt := range tests {
+				result, err := client.CallTool(context.Background(), tt.tool, json.RawMessage(tt.args))
+				if err != nil {
+					t.Errorf("%s: %v", tt.tool, err)
+					continue
+				}
+				if len(result.Content) != 1 || result.Content[0].Type != tt.want.Type || result.Content[0].Text != tt.want.Text ||
+					result.Content[0].Data != tt.want.Data || result.IsError != tt.isError {
+					t.Errorf("%s = %+v, want %+v (error %v)", tt.tool, result, tt.want, tt.isError)
+				}
+			}
+			if _, err := client.CallTool(context.Background(), "missing", nil); err == nil {
+				t.Error("calling an unknown tool should fail")
+			}
+		})
+	}
+}
+
+func TestHTTPSession(t *testing.T) {
+	server := mcptest.NewHTTPServer(t)
+	client, err := mcp.Connect(context.Background(), &config.MCPServerConfig{Name: "http", URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !server.SessionOpen() {
+		t.Fatal("no session after initialize")
+	}
+	client.Close()
+	if server.SessionOpen() {
+		t.Error("session not deleted on close")
+	}
+
+	server.Header = [2]string{"Authorization", "Bearer token"}
+	if _, err := mcp.Connect(context.Background(), &config.MCPServerConfig{Name: "http", URL: server.URL}); err == nil {
+		t.Error("connect without the required header should fail")
+	}
+}
+
+func TestStdioServerExit(t *testing.T) {
+	// "true" exits at once without answering initialize
+	client, err := mcp.Connect(context.Background(), &config.MCPServerConfig{Name: "exit", Command: "true"})
+	if err == nil {
+		client.Close()
+		t.Fatal("connect to an exited server should fail")
+	}
+}
@@ -0,0 +1,156 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"focalors-go/config"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// httpTransport speaks the streamable HTTP transport: every message is POSTed, responses come back
+// as JSON or as a server-sent event stream
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu        sync.Mutex
+	sessionId string // assigned by the server on initialize
+}
+
+func newHTTPTransport(cfg *config.MCPServerConfig) *httpTransport {
+	return &httpTransport{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{},
+	}
+}
+
+func (t *httpTransport) post(ctx context.Context, msg *request) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	t.setHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("mcp %s: unexpected status %s: %s", msg.Method, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if sessionId := resp.Header.Get("Mcp-Session-Id"); sessionId != "" {
+		t.mu.Lock()
+		t.sessionId = sessionId
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("MCP-Protocol-Version", protocolVersion)
+	t.mu.Lock()
+	if t.sessionId != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionId)
+	}
+	t.mu.Unlock()
+}
+
+func (t *httpTransport) call(ctx context.Context, req *request) (*response, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		var msg response
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			return nil, fmt.Errorf("decode mcp %s response: %w", req.Method, err)
+		}
+		return &msg, nil
+	}
+
+	// the stream may carry requests and notifications of the server before the response
+	id := strconv.FormatInt(*req.Id, 10)
+	var data strings.Builder
+	// event returns the response carried by the buffered event, if it is the one waited for
+	event := func() *response {
+		defer data.Reset()
+		var msg message
+		if err := json.Unmarshal([]byte(data.String()), &msg); err != nil || msg.Method != "" || string(msg.Id) != id {
+			return nil
+		}
+		return &msg
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if after, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(after, " "))
+			continue
+		}
+		// an empty line ends the event
+		if line == "" && data.Len() > 0 {
+			if msg := event(); msg != nil {
+				return msg, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if msg := event(); msg != nil {
+		return msg, nil
+	}
+	return nil, fmt.Errorf("mcp %s: stream ended without a response", req.Method)
+}
+
+func (t *httpTransport) notify(ctx context.Context, n *request) error {
+	resp, err := t.post(ctx, n)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// close ends the session on the server
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	sessionId := t.sessionId
+	t.mu.Unlock()
+	if sessionId == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,210 @@
+// Package mcptest is a tiny MCP server for tests, served over stdio or streamable HTTP.
+// It offers three tools:
+//
+//	echo  {"text": string} returns the text
+//	image returns a png image
+//	fail  returns a tool error
+//
+// tools/list is split into two pages to exercise pagination.
+//
+// The stdio server runs in a child process, usually the test binary itself:
+//
+//	func TestMain(m *testing.M) {
+//		if os.Getenv(mcptest.StdioEnv) != "" {
+//			mcptest.ServeStdio()
+//			return
+//		}
+//		os.Exit(m.Run())
+//	}
+package mcptest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+// StdioEnv is the environment variable telling the test binary to serve MCP over stdio
+const StdioEnv = "MCPTEST_STDIO"
+
+// Image is the base64 content returned by the image tool
+const Image = "iVBORw0KGgo="
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+var pages = [][]map[string]any{
+	{
+		{
+			"name":        "echo",
+			"description": "Echo the text",
+			"inputSchema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"text": map[string]any{"type": "string"}},
+				"required":   []string{"text"},
+			},
+		},
+		{"name": "image", "description": "Draw an image", "inputSchema": map[string]any{"type": "object"}},
+	},
+	{
+		{"name": "fail", "description": "Always fail", "inputSchema": map[string]any{"type": "object"}},
+	},
+}
+
+// handle answers a request, returns nil for notifications
+func handle(req *message) *message {
+	if len(req.Id) == 0 {
+		return nil
+	}
+	resp := &message{JSONRPC: "2.0", Id: req.Id}
+	switch req.Method {
+	case "initialize":
+		resp.Result = map[string]any{
+			"protocolVersion": "2025-03-26",
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "mcptest", "version": "1.0.0"},
+		}
+	case "tools/list":
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(req.Params, &params)
+		if params.Cursor == "" {
+			resp.Result = map[string]any{"tools": pages[0], "nextCursor": "2"}
+		} else {
+			resp.Result = map[string]any{"tools": pages[1]}
+		}
+	case "tools/call":
+		var params struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				Text string `json:"text"`
+			} `json:"arguments"`
+		}
+		json.Unmarshal(req.Params, &params)
+		switch params.Name {
+		case "echo":
+			resp.Result = map[string]any{"content": []map[string]any{{"type": "text", "text": params.Arguments.Text}}}
+		case "image":
+			resp.Result = map[string]any{"content": []map[string]any{{"type": "image", "data": Image, "mimeType": "image/png"}}}
+		case "fail":
+			resp.Result = map[string]any{"content": []map[string]any{{"type": "text", "text": "boom"}}, "isError": true}
+		default:
+			resp.Error = &rpcError{Code: -32602, Message: "unknown tool " + params.Name}
+		}
+	default:
+		resp.Error = &rpcError{Code: -32601, Message: "method not found"}
+	}
+	return resp
+}
+
+// ServeStdio serves newline delimited JSON-RPC on stdin/stdout until stdin is closed.
+// Every tool call is preceded by a ping to the client.
+func ServeStdio() {
+	out := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	pings := 0
+	for scanner.Scan() {
+		var req message
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid message:", err)
+			continue
+		}
+		if req.Method == "" {
+			// the answer of a ping
+			continue
+		}
+		if req.Method == "tools/call" {
+			pings++
+			out.Encode(&message{JSONRPC: "2.0", Id: json.RawMessage(fmt.Sprintf(`"ping-%d"`, pings)), Method: "ping"})
+		}
+		if resp := handle(&req); resp != nil {
+			out.Encode(resp)
+		}
+	}
+}
+
+// HTTPServer serves the streamable HTTP transport. Tool calls are answered with an event stream
+// carrying a notification before the response, everything else with plain JSON.
+type HTTPServer struct {
+	*httptest.Server
+	// Header, if set, must be sent with every request, e.g. "Authorization: Bearer x"
+	Header [2]string
+
+	mu       sync.Mutex
+	sessions map[string]bool // id -> open
+}
+
+const sessionId = "session-1"
+
+func NewHTTPServer(t testing.TB) *HTTPServer {
+	s := &HTTPServer{sessions: make(map[string]bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// SessionOpen reports whether the session created on initialize has not been deleted
+func (s *HTTPServer) SessionOpen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[sessionId]
+}
+
+func (s *HTTPServer) serve(w http.ResponseWriter, r *http.Request) {
+	if s.Header[0] != "" && r.Header.Get(s.Header[0]) != s.Header[1] {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		s.mu.Lock()
+		s.sessions[r.Header.Get("Mcp-Session-Id")] = false
+		s.mu.Unlock()
+		return
+	}
+	var req message
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Method == "initialize" {
+		s.mu.Lock()
+		s.sessions[sessionId] = true
+		s.mu.Unlock()
+		w.Header().Set("Mcp-Session-Id", sessionId)
+	} else if r.Header.Get("Mcp-Session-Id") != sessionId {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	resp := handle(&req)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if req.Method != "tools/call" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	progress, _ := json.Marshal(&message{JSONRPC: "2.0", Method: "notifications/progress"})
+	result, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "event: message\ndata: %s\n\nevent: message\ndata: %s\n\n", progress, result)
+}
@@ -0,0 +1,190 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"focalors-go/config"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// how long a server may take to exit after its stdin is closed
+const stdioCloseTimeout = 3 * time.Second
+
+// stdioTransport runs the server as a child process exchanging newline delimited JSON over stdin/stdout
+type stdioTransport struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[int64]chan *response
+	done    chan struct{} // closed when stdout ends
+	err     error         // why stdout ended
+}
+
+func newStdioTransport(cfg *config.MCPServerConfig) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start mcp server %s: %w", cfg.Name, err)
+	}
+
+	t := &stdioTransport{
+		name:    cfg.Name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int64]chan *response),
+		done:    make(chan struct{}),
+	}
+	go t.readLoop(stdout)
+	go t.logStderr(stderr)
+	return t, nil
+}
+
+func (t *stdioTransport) readLoop(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	var err error
+	for {
+		var line []byte
+		line, err = reader.ReadBytes('\n')
+		if len(line) > 0 {
+			t.dispatch(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		err = fmt.Errorf("mcp server %s exited", t.name)
+	}
+	t.mu.Lock()
+	t.err = err
+	t.mu.Unlock()
+	close(t.done)
+}
+
+// dispatch hands responses to their callers and answers the requests of the server
+func (t *stdioTransport) dispatch(line []byte) {
+	var msg message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		logger.Debug("Ignoring non JSON-RPC output", slog.String("name", t.name), slog.String("line", string(line)))
+		return
+	}
+	if msg.Method != "" {
+		if len(msg.Id) > 0 {
+			go t.reply(msg)
+		}
+		return
+	}
+	id, err := strconv.ParseInt(string(msg.Id), 10, 64)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	ch, ok := t.pending[id]
+	delete(t.pending, id)
+	t.mu.Unlock()
+	if ok {
+		ch <- &msg
+	}
+}
+
+// reply answers a request of the server, only ping is supported
+func (t *stdioTransport) reply(req message) {
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.Id}
+	if req.Method == "ping" {
+		resp["result"] = map[string]any{}
+	} else {
+		resp["error"] = rpcError{Code: -32601, Message: "method not found"}
+	}
+	if err := t.write(resp); err != nil {
+		logger.Warn("Failed to answer mcp server request", slog.String("name", t.name), slog.Any("error", err))
+	}
+}
+
+func (t *stdioTransport) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		logger.Debug("MCP server stderr", slog.String("name", t.name), slog.String("line", scanner.Text()))
+	}
+}
+
+func (t *stdioTransport) write(v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(raw, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, req *request) (*response, error) {
+	ch := make(chan *response, 1)
+	t.mu.Lock()
+	t.pending[*req.Id] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, *req.Id)
+		t.mu.Unlock()
+	}()
+
+	if err := t.write(req); err != nil {
+		return nil, err
+	}
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.done:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return nil, t.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, n *request) error {
+	return t.write(n)
+}
+
+// close ends stdin, which tells the server to exit, and kills it if it does not
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+	exited := make(chan struct{})
+	go func() {
+		t.cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(stdioCloseTimeout):
+		t.cmd.Process.Kill()
+		<-exited
+	}
+	return nil
+}
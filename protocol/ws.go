@@ -17,11 +17,14 @@ var wsLogger = slogger.New("protocol.websocket")
 
 // A websocket client
 type WebSocketClient[Message any] struct {
-	Conn          *websocket.Conn
+	Conn          *websocket.Conn // guarded by connMu, replaced on reconnect
 	Url           string
 	messageBuffer chan Message
 	wg            sync.WaitGroup
 	onConnect     func()
+	connMu        sync.Mutex
+	// gorilla/websocket supports one concurrent writer only
+	writeMu sync.Mutex
 }
 
 // New creates a new WebSocket client
@@ -41,12 +44,12 @@ func (c *WebSocketClient[Message]) OnConnect(fn func()) {
 func (c *WebSocketClient[Message]) Connect() error {
 	conn, _, err := websocket.DefaultDialer.Dial(c.Url, nil)
 	if err != nil {
-		c.Conn = nil // Ensure Conn is nil on failure
+		c.setConn(nil) // Ensure Conn is nil on failure
 		wsLogger.Error("[WebSocket] Failed to dial", slog.String("url", c.Url), slog.Any("error", err))
 		return err
 	}
 
-	c.Conn = conn
+	c.setConn(conn)
 	wsLogger.Info("[WebSocket] Successfully connected.", slog.String("url", c.Url))
 	if c.onConnect != nil {
 		go c.onConnect()
@@ -54,12 +57,29 @@ func (c *WebSocketClient[Message]) Connect() error {
 	return nil
 }
 
+// conn returns the current connection, nil while disconnected
+func (c *WebSocketClient[Message]) conn() *websocket.Conn {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.Conn
+}
+
+func (c *WebSocketClient[Message]) setConn(conn *websocket.Conn) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.Conn = conn
+}
+
+// Send writes a message as JSON, it is safe to call from several goroutines
 func (c *WebSocketClient[Message]) Send(message any) error {
-	if c.Conn == nil {
+	conn := c.conn()
+	if conn == nil {
 		wsLogger.Error("[WebSocket] Connection is nil, cannot send message.", slog.String("url", c.Url))
 		return errors.New("connection is nil")
 	}
-	err := c.Conn.WriteJSON(message)
+	c.writeMu.Lock()
+	err := conn.WriteJSON(message)
+	c.writeMu.Unlock()
 	if err != nil {
 		wsLogger.Error("[WebSocket] Failed to write JSON", slog.String("url", c.Url), slog.Any("error", err))
 		return err
@@ -77,16 +97,18 @@ func (c *WebSocketClient[Message]) Listen(ctx context.Context) error {
 			return ctx.Err()
 		default:
 			var message Message
-			if c.Conn == nil {
+			conn := c.conn()
+			if conn == nil {
 				wsLogger.Warn("[WebSocket] Connection is nil, attempting to reconnect.", slog.String("url", c.Url))
 				if err := c.Connect(); err != nil {
 					wsLogger.Error("[WebSocket] Failed to reconnect", slog.String("url", c.Url), slog.Any("error", err))
 					time.Sleep(2 * time.Second) // Sleep before reconnecting
 					continue
 				}
+				conn = c.conn()
 			}
 
-			err := c.Conn.ReadJSON(&message)
+			err := conn.ReadJSON(&message)
 
 			if err == nil {
 				// Step 3: Process the successfully read message.
@@ -104,7 +126,7 @@ func (c *WebSocketClient[Message]) Listen(ctx context.Context) error {
 
 			if isTerminalError(err) {
 				wsLogger.Warn("[WebSocket] Terminal error occurred", slog.String("url", c.Url), slog.Any("error", err))
-				c.Conn = nil // Reset connection
+				c.setConn(nil) // Reset connection
 				continue
 			}
 			time.Sleep(2 * time.Second) // Sleep before reconnecting
@@ -113,10 +135,10 @@ func (c *WebSocketClient[Message]) Listen(ctx context.Context) error {
 }
 
 func (c *WebSocketClient[Message]) close() {
-	if c.Conn != nil {
+	if conn := c.conn(); conn != nil {
 		wsLogger.Info("[WebSocket] Closing connection.", slog.String("url", c.Url))
-		c.Conn.Close() // Attempt to close
-		c.Conn = nil
+		conn.Close() // Attempt to close
+		c.setConn(nil)
 	}
 	c.wg.Wait() // Wait for message processing to finish
 	wsLogger.Info("[WebSocket] Connection closed.", slog.String("url", c.Url))
@@ -0,0 +1,424 @@
+package console
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"focalors-go/config"
+	"focalors-go/contract"
+	"focalors-go/slogger"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var logger = slogger.New("console")
+
+// selfId is the user id of the bot, mention it with "@bot"
+const selfId = "bot"
+
+const helpText = `Directives:
+  :user <id>              impersonate another user
+  :group [id]             talk in a group, or in private without id
+  :reply <msgId> <text>   reply to a message
+  :image <path>           send an image file
+  :whoami                 show the impersonated user and group
+  :help                   show this help
+Mention the bot with @bot, other users with @<id>.`
+
+// ConsoleClient is a GenericClient reading messages from stdin and printing cards to stdout,
+// meant for exercising middlewares without a real platform account.
+type ConsoleClient struct {
+	cfg      *config.ConsoleConfig
+	in       io.Reader
+	out      io.Writer
+	imageDir string
+	handlers []func(ctx context.Context, msg contract.GenericMessage) bool
+
+	mu       sync.Mutex
+	userId   string
+	groupId  string
+	nextId   int
+	messages map[string]*ConsoleMessage
+	// image files of sent and received messages, keyed by message id
+	images map[string]string
+}
+
+var _ contract.GenericClient = (*ConsoleClient)(nil)
+
+func NewConsoleClient(cfg *config.ConsoleConfig) (*ConsoleClient, error) {
+	imageDir := cfg.ImageDir
+	if imageDir == "" {
+		dir, err := os.MkdirTemp("", "focalors-console-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create image dir: %w", err)
+		}
+		imageDir = dir
+	} else if err := os.MkdirAll(imageDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create image dir: %w", err)
+	}
+	userId := cfg.UserId
+	if userId == "" {
+		userId = "console_user"
+	}
+	return &ConsoleClient{
+		cfg:      cfg,
+		in:       os.Stdin,
+		out:      os.Stdout,
+		imageDir: imageDir,
+		userId:   userId,
+		groupId:  cfg.GroupId,
+		messages: make(map[string]*ConsoleMessage),
+		images:   make(map[string]string),
+	}, nil
+}
+
+func (c *ConsoleClient) Start(ctx context.Context) error {
+	c.printf("Console ready, images are written to %s. Type :help for directives.\n", c.imageDir)
+	c.prompt()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(c.in)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			logger.Error("failed to read stdin", slog.Any("error", err))
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				logger.Info("stdin closed, console stops reading")
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			c.handleLine(ctx, strings.TrimSpace(line))
+		}
+	}
+}
+
+func (c *ConsoleClient) handleLine(ctx context.Context, line string) {
+	if line == "" {
+		c.prompt()
+		return
+	}
+	if !strings.HasPrefix(line, ":") {
+		c.dispatch(ctx, c.newMessage(line, "", ""))
+		return
+	}
+
+	directive, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch directive {
+	case ":user":
+		if arg == "" {
+			c.printf("usage: :user <id>\n")
+			break
+		}
+		c.mu.Lock()
+		c.userId = arg
+		c.mu.Unlock()
+	case ":group":
+		c.mu.Lock()
+		c.groupId = arg
+		c.mu.Unlock()
+	case ":reply":
+		msgId, text, _ := strings.Cut(arg, " ")
+		if msgId == "" || strings.TrimSpace(text) == "" {
+			c.printf("usage: :reply <msgId> <text>\n")
+			break
+		}
+		if _, ok := c.getMessage(msgId); !ok {
+			c.printf("unknown message #%s\n", msgId)
+			break
+		}
+		c.dispatch(ctx, c.newMessage(strings.TrimSpace(text), msgId, ""))
+		return
+	case ":image":
+		if arg == "" {
+			c.printf("usage: :image <path>\n")
+			break
+		}
+		if _, err := os.Stat(arg); err != nil {
+			c.printf("can not read image: %v\n", err)
+			break
+		}
+		c.dispatch(ctx, c.newMessage("", "", arg))
+		return
+	case ":whoami":
+	case ":help":
+		c.printf("%s\n", helpText)
+	default:
+		c.printf("unknown directive %s, type :help for directives\n", directive)
+	}
+	c.printf("you are %s\n", c.identity())
+	c.prompt()
+}
+
+func (c *ConsoleClient) dispatch(ctx context.Context, msg *ConsoleMessage) {
+	c.printf("[#%s] %s: %s\n", msg.id, c.identity(), msg.describe())
+	// handlers may take a while (e.g. LLM calls), keep the prompt responsive
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Panic in message handler", slog.Any("panic", r))
+			}
+		}()
+		for _, handler := range c.handlers {
+			if handler(ctx, msg) {
+				break
+			}
+		}
+	}()
+	c.prompt()
+}
+
+func (c *ConsoleClient) identity() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.groupId != "" {
+		return c.userId + "@" + c.groupId
+	}
+	return c.userId
+}
+
+func (c *ConsoleClient) prompt() {
+	c.printf("%s> ", c.identity())
+}
+
+func (c *ConsoleClient) printf(format string, args ...any) {
+	fmt.Fprintf(c.out, format, args...)
+}
+
+// allocId returns the next message id, shared by received and sent messages so that any of them
+// can be referenced with :reply
+func (c *ConsoleClient) allocId() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextId++
+	return strconv.Itoa(c.nextId)
+}
+
+func (c *ConsoleClient) getMessage(id string) (*ConsoleMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msg, ok := c.messages[id]
+	return msg, ok
+}
+
+func (c *ConsoleClient) storeMessage(msg *ConsoleMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages[msg.id] = msg
+	if msg.imagePath != "" {
+		c.images[msg.id] = msg.imagePath
+	}
+}
+
+func (c *ConsoleClient) AddMessageHandler(handler func(ctx context.Context, msg contract.GenericMessage) bool) {
+	c.handlers = append(c.handlers, handler)
+}
+
+func (c *ConsoleClient) GetSelfUserId() string {
+	return selfId
+}
+
+func (c *ConsoleClient) RecallMessage(messageId string) error {
+	if messageId == "" {
+		return nil
+	}
+	c.mu.Lock()
+	_, ok := c.messages[messageId]
+	delete(c.messages, messageId)
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("message %s not found", messageId)
+	}
+	c.printf("\n[#%s] recalled\n", messageId)
+	c.prompt()
+	return nil
+}
+
+// UploadImage writes the image to the image dir, the file path is used as image key
+func (c *ConsoleClient) UploadImage(base64Content string) (string, error) {
+	content := strings.TrimSpace(strings.TrimPrefix(base64Content, "base64://"))
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64 image: %w", err)
+	}
+	file, err := os.CreateTemp(c.imageDir, "image-*.png")
+	if err != nil {
+		return "", fmt.Errorf("failed to create image file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return "", fmt.Errorf("failed to write image file: %w", err)
+	}
+	return file.Name(), nil
+}
+
+func (c *ConsoleClient) SendRichCard(target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	return c.ReplyRichCard("", target, card)
+}
+
+func (c *ConsoleClient) ReplyRichCard(replyToMsgId string, target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	msg := &ConsoleMessage{
+		id:        c.allocId(),
+		text:      cardText(card),
+		userId:    selfId,
+		replyToId: replyToMsgId,
+		client:    c,
+	}
+	// the chat is a group if the target is one we have talked in as a group
+	if t := target.GetTarget(); c.isGroup(t) {
+		msg.groupId = t
+	}
+	msg.imagePath = firstImage(card)
+	c.storeMessage(msg)
+
+	header := fmt.Sprintf("[#%s] %s → %s", msg.id, selfId, target.GetTarget())
+	if replyToMsgId != "" {
+		header += fmt.Sprintf(" (reply to #%s)", replyToMsgId)
+	}
+	c.printf("\n%s\n%s\n", header, renderCard(card))
+	c.prompt()
+	return msg.id, nil
+}
+
+func (c *ConsoleClient) UpdateRichCard(messageId string, card *contract.CardBuilder) error {
+	msg, ok := c.getMessage(messageId)
+	if !ok {
+		return fmt.Errorf("message %s not found", messageId)
+	}
+	c.mu.Lock()
+	msg.text = cardText(card)
+	if image := firstImage(card); image != "" {
+		msg.imagePath = image
+		c.images[msg.id] = image
+	}
+	c.mu.Unlock()
+	c.printf("\n[#%s] updated\n%s\n", messageId, renderCard(card))
+	c.prompt()
+	return nil
+}
+
+func (c *ConsoleClient) isGroup(target string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if target == c.groupId {
+		return true
+	}
+	for _, msg := range c.messages {
+		if msg.groupId == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ConsoleClient) GetContactDetail(userId ...string) ([]contract.Contact, error) {
+	contacts := make([]contract.Contact, 0, len(userId))
+	for _, id := range userId {
+		contacts = append(contacts, &ConsoleContact{id: id})
+	}
+	return contacts, nil
+}
+
+func (c *ConsoleClient) DownloadMessageImage(msgId string) (string, error) {
+	c.mu.Lock()
+	path, ok := c.images[msgId]
+	c.mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("no image found for message %s", msgId)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// ConsoleContact implements contract.Contact, the id doubles as nickname
+type ConsoleContact struct {
+	id string
+}
+
+func (c *ConsoleContact) Username() string  { return c.id }
+func (c *ConsoleContact) Nickname() string  { return c.id }
+func (c *ConsoleContact) AvatarUrl() string { return "" }
+
+// renderCard prints a card as indented plain text, images as the path of their file
+func renderCard(card *contract.CardBuilder) string {
+	var lines []string
+	if card.Header != "" {
+		lines = append(lines, "【"+card.Header+"】")
+	}
+	for _, elem := range card.Elements {
+		switch elem.Type {
+		case contract.CardElementMarkdown:
+			lines = append(lines, strings.Split(strings.TrimRight(elem.Content, "\n"), "\n")...)
+		case contract.CardElementImage:
+			if elem.Width > 0 && elem.Height > 0 {
+				lines = append(lines, fmt.Sprintf("🖼 %s (%s, %dx%d)", imagePath(elem.Content), elem.AltText, elem.Width, elem.Height))
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("🖼 %s (%s)", imagePath(elem.Content), elem.AltText))
+		case contract.CardElementDivider:
+			lines = append(lines, "──────────")
+		case contract.CardElementMention:
+			lines = append(lines, elem.MentionName())
+		case contract.CardElementButtons:
+			for _, row := range elem.Buttons {
+				var buttons []string
+				for _, btn := range row {
+					buttons = append(buttons, fmt.Sprintf("[%s → %s]", btn.Text, btn.Data))
+				}
+				lines = append(lines, strings.Join(buttons, " "))
+			}
+		}
+	}
+	return "  " + strings.Join(lines, "\n  ")
+}
+
+// imagePath hides raw base64 content that was not uploaded first
+func imagePath(key string) string {
+	if strings.HasPrefix(key, "base64://") || len(key) > 512 {
+		return "<inline image>"
+	}
+	return filepath.Clean(key)
+}
+
+func cardText(card *contract.CardBuilder) string {
+	var texts []string
+	if card.Header != "" {
+		texts = append(texts, card.Header)
+	}
+	for _, elem := range card.Elements {
+		if elem.Type == contract.CardElementMarkdown {
+			texts = append(texts, elem.Content)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func firstImage(card *contract.CardBuilder) string {
+	for _, elem := range card.Elements {
+		if elem.Type == contract.CardElementImage && imagePath(elem.Content) != "<inline image>" {
+			return elem.Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+package console
+
+import (
+	"focalors-go/contract"
+	"strings"
+)
+
+// ConsoleMessage implements contract.GenericMessage
+type ConsoleMessage struct {
+	id             string
+	text           string
+	userId         string
+	groupId        string
+	imagePath      string
+	replyToId      string
+	mentionedUsers []contract.UserInfo
+	client         *ConsoleClient
+}
+
+var _ contract.GenericMessage = (*ConsoleMessage)(nil)
+
+// newMessage builds a message sent by the impersonated user. Words starting with "@" mention users,
+// "@bot" mentions the bot and is dropped from the text so commands parse as usual.
+func (c *ConsoleClient) newMessage(text string, replyToId string, imagePath string) *ConsoleMessage {
+	c.mu.Lock()
+	userId, groupId := c.userId, c.groupId
+	c.mu.Unlock()
+
+	msg := &ConsoleMessage{
+		id:        c.allocId(),
+		userId:    userId,
+		groupId:   groupId,
+		imagePath: imagePath,
+		replyToId: replyToId,
+		client:    c,
+	}
+	var words []string
+	for _, word := range strings.Fields(text) {
+		if mention, ok := strings.CutPrefix(word, "@"); ok && mention != "" {
+			msg.mentionedUsers = append(msg.mentionedUsers, contract.UserInfo{UserId: mention, Username: mention})
+			if mention == selfId {
+				continue
+			}
+		}
+		words = append(words, word)
+	}
+	msg.text = strings.Join(words, " ")
+	c.storeMessage(msg)
+	return msg
+}
+
+// describe summarizes the message for the echo line of the console
+func (m *ConsoleMessage) describe() string {
+	var parts []string
+	if m.replyToId != "" {
+		parts = append(parts, "(reply to #"+m.replyToId+")")
+	}
+	for _, user := range m.mentionedUsers {
+		if user.UserId == selfId {
+			parts = append(parts, "(@bot)")
+		}
+	}
+	if m.imagePath != "" {
+		parts = append(parts, "🖼 "+m.imagePath)
+	}
+	if m.text != "" {
+		parts = append(parts, m.text)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (m *ConsoleMessage) GetId() string {
+	return m.id
+}
+
+func (m *ConsoleMessage) GetText() string {
+	return m.text
+}
+
+func (m *ConsoleMessage) GetContent() string {
+	return m.text
+}
+
+func (m *ConsoleMessage) GetUserId() string {
+	return m.userId
+}
+
+func (m *ConsoleMessage) GetGroupId() string {
+	return m.groupId
+}
+
+func (m *ConsoleMessage) GetTarget() string {
+	if m.groupId != "" {
+		return m.groupId
+	}
+	return m.userId
+}
+
+func (m *ConsoleMessage) IsGroup() bool {
+	return m.groupId != ""
+}
+
+func (m *ConsoleMessage) IsText() bool {
+	return m.text != ""
+}
+
+func (m *ConsoleMessage) IsImage() bool {
+	return m.imagePath != "" && m.text == ""
+}
+
+func (m *ConsoleMessage) GetReferMessage() (contract.GenericMessage, bool) {
+	if m.replyToId == "" {
+		return nil, false
+	}
+	refer, ok := m.client.getMessage(m.replyToId)
+	if !ok {
+		return nil, false
+	}
+	return refer, true
+}
+
+func (m *ConsoleMessage) GetMentionedUsers() []contract.UserInfo {
+	if len(m.mentionedUsers) == 0 {
+		return nil
+	}
+	mentionedUsers := make([]contract.UserInfo, len(m.mentionedUsers))
+	copy(mentionedUsers, m.mentionedUsers)
+	return mentionedUsers
+}
@@ -38,25 +38,27 @@ type LarkClient struct {
 	sdk      *larkSDK.Client
 	cfg      *config.LarkConfig
 	handlers []func(ctx context.Context, msg contract.GenericMessage) bool
-	redis    *db.Redis
+	kv       db.KV
 	appCtx   context.Context // application context for graceful shutdown
+	// botOpenId stores the bot's open_id, set at startup
+	botOpenId string
 }
 
 var _ contract.GenericClient = (*LarkClient)(nil)
 
-func NewLarkClient(cfg *config.Config, redis *db.Redis) (*LarkClient, error) {
-	if cfg.Lark.AppID == "" || cfg.Lark.AppSecret == "" {
+func NewLarkClient(cfg *config.LarkConfig, kv db.KV) (*LarkClient, error) {
+	if cfg.AppID == "" || cfg.AppSecret == "" {
 		return nil, fmt.Errorf("lark appId and appSecret are required")
 	}
 
-	sdkClient := larkSDK.NewClient(cfg.Lark.AppID, cfg.Lark.AppSecret,
+	sdkClient := larkSDK.NewClient(cfg.AppID, cfg.AppSecret,
 		larkSDK.WithEnableTokenCache(true),
 	)
 
 	return &LarkClient{
-		sdk:   sdkClient,
-		cfg:   &cfg.Lark,
-		redis: redis,
+		sdk: sdkClient,
+		cfg: cfg,
+		kv:  kv,
 	}, nil
 }
 
@@ -91,7 +93,7 @@ func (l *LarkClient) fetchBotInfo(ctx context.Context) error {
 		return fmt.Errorf("bot open_id is empty in response")
 	}
 
-	botOpenId = botInfo.Bot.OpenId
+	l.botOpenId = botInfo.Bot.OpenId
 	return nil
 }
 
@@ -103,25 +105,24 @@ func (l *LarkClient) Start(ctx context.Context) error {
 		logger.Error("failed to fetch bot info", slog.Any("error", err))
 		return fmt.Errorf("failed to fetch bot info: %w", err)
 	}
-	logger.Info("bot info fetched successfully", slog.String("bot_open_id", botOpenId))
+	logger.Info("bot info fetched successfully", slog.String("bot_open_id", l.botOpenId))
 
 	eventHandler := dispatcher.NewEventDispatcher("", l.cfg.VerificationToken).
 		OnP2MessageReceiveV1(func(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
 			// Process everything asynchronously to respond to Lark immediately.
 			// Lark requires response within 3 seconds, otherwise it will retry.
 			go func() {
-				// Deduplicate messages using Redis
+				// Deduplicate messages using the KV store
 				msgId := ""
 				if event.Event != nil && event.Event.Message != nil && event.Event.Message.MessageId != nil {
 					msgId = *event.Event.Message.MessageId
 				}
 				if msgId != "" {
 					key := msgDedupeKeyPrefix + msgId
-					// Use Background context to ensure dedup check completes regardless of event context timeout
-					set, err := l.redis.RedisClient.SetNX(context.Background(), key, "1", msgDedupeTTL).Result()
+					set, err := l.kv.SetNX(key, "1", msgDedupeTTL)
 					if err != nil {
-						logger.Error("failed to check message dedup in redis", slog.Any("error", err))
-						// On Redis error, still skip to avoid duplicate processing if this is a retry
+						logger.Error("failed to check message dedup", slog.Any("error", err))
+						// On storage error, still skip to avoid duplicate processing if this is a retry
 						return
 					}
 					if !set {
@@ -187,6 +188,12 @@ func (l *LarkClient) UploadImage(base64Content string) (string, error) {
 	return l.uploadBase64Image(c)
 }
 
+// custom_width of card images must be within this range
+const (
+	larkImageMinWidth = 278
+	larkImageMaxWidth = 580
+)
+
 // buildRichCardContent creates a Lark interactive card from CardBuilder
 func (l *LarkClient) buildRichCardContent(card *contract.CardBuilder) string {
 	elements := []map[string]interface{}{}
@@ -203,10 +210,15 @@ func (l *LarkClient) buildRichCardContent(card *contract.CardBuilder) string {
 			if altText == "" {
 				altText = "image"
 			}
+			// limit image width to 300px, or the given width within the range lark accepts
+			width := 300
+			if elem.Width > 0 {
+				width = min(max(elem.Width, larkImageMinWidth), larkImageMaxWidth)
+			}
 			elements = append(elements, map[string]interface{}{
 				"tag":          "img",
 				"img_key":      elem.Content,
-				"custom_width": 300, // limit image width to 300px
+				"custom_width": width,
 				"alt": map[string]interface{}{
 					"tag":     "plain_text",
 					"content": altText,
@@ -216,6 +228,11 @@ func (l *LarkClient) buildRichCardContent(card *contract.CardBuilder) string {
 			elements = append(elements, map[string]interface{}{
 				"tag": "hr",
 			})
+		case contract.CardElementMention:
+			elements = append(elements, map[string]interface{}{
+				"tag":     "markdown",
+				"content": fmt.Sprintf("<at id=%s></at>", elem.Content),
+			})
 		case contract.CardElementButtons:
 			// Render buttons as markdown links: [`text`](data)
 			var links []string
@@ -433,8 +450,8 @@ func (c *LarkContact) AvatarUrl() string { return c.avatarUrl }
 
 func (l *LarkClient) GetSelfUserId() string {
 	// Return the cached bot open_id if available, otherwise fall back to AppID
-	if botOpenId != "" {
-		return botOpenId
+	if l.botOpenId != "" {
+		return l.botOpenId
 	}
 	return l.cfg.AppID
 }
@@ -19,9 +19,6 @@ const (
 	chatTypeP2P   = "p2p"
 )
 
-// botOpenId stores the bot's open_id, set at startup
-var botOpenId string
-
 // LarkMessage implements contract.GenericMessage
 type LarkMessage struct {
 	messageId        string
@@ -197,8 +194,8 @@ func (l *LarkClient) getMessageByID(messageId string) (*LarkMessage, error) {
 		lm.senderType = derefStr(item.Sender.SenderType)
 		// Message.Get API returns app_id (cli_xxx) for bot-sent messages,
 		// normalize to open_id so it matches GetSelfUserId()
-		if lm.senderType == "app" && botOpenId != "" {
-			lm.senderId = botOpenId
+		if lm.senderType == "app" && l.botOpenId != "" {
+			lm.senderId = l.botOpenId
 		}
 	}
 	if item.Body != nil {
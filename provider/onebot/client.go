@@ -0,0 +1,472 @@
+package onebot
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"focalors-go/config"
+	"focalors-go/contract"
+	"focalors-go/slogger"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	R "resty.dev/v3"
+)
+
+var logger = slogger.New("onebot")
+
+const (
+	// how long to wait for the OneBot implementation to answer an action
+	actionTimeout = 30 * time.Second
+	// group targets carry this suffix since QQ group and user ids share the same number space
+	groupSuffix = "@group"
+)
+
+var errNotConnected = errors.New("no OneBot connection")
+
+type OneBotClient struct {
+	cfg        *config.OneBotConfig
+	handlers   []func(ctx context.Context, msg contract.GenericMessage) bool
+	httpClient *R.Client
+	appCtx     context.Context
+	selfId     atomic.Value // string
+
+	connMu  sync.Mutex
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	echoSeq   atomic.Uint64
+	pendingMu sync.Mutex
+	pending   map[string]chan *actionResponse
+}
+
+var _ contract.GenericClient = (*OneBotClient)(nil)
+
+func NewOneBotClient(cfg *config.OneBotConfig) (*OneBotClient, error) {
+	if cfg.Listen == "" {
+		return nil, fmt.Errorf("onebot listen address is required")
+	}
+	c := &OneBotClient{
+		cfg:        cfg,
+		httpClient: R.New().SetTimeout(1 * time.Minute),
+		pending:    make(map[string]chan *actionResponse),
+	}
+	c.selfId.Store("")
+	return c, nil
+}
+
+// GroupTarget returns the target id used for a QQ group
+func GroupTarget(groupId int64) string {
+	return strconv.FormatInt(groupId, 10) + groupSuffix
+}
+
+func isGroupTarget(target string) bool {
+	return strings.HasSuffix(target, groupSuffix)
+}
+
+func parseTargetId(target string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimSuffix(target, groupSuffix), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid onebot target %q: %w", target, err)
+	}
+	return id, nil
+}
+
+type actionRequest struct {
+	Action string `json:"action"`
+	Params any    `json:"params"`
+	Echo   string `json:"echo"`
+}
+
+type actionResponse struct {
+	Status  string          `json:"status"`
+	RetCode int             `json:"retcode"`
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"message"`
+	Wording string          `json:"wording"`
+	Echo    json.RawMessage `json:"echo"`
+}
+
+// frame is used to tell action responses from events on the shared connection
+type frame struct {
+	Echo     json.RawMessage `json:"echo"`
+	PostType string          `json:"post_type"`
+}
+
+func (o *OneBotClient) context() context.Context {
+	if o.appCtx != nil {
+		return o.appCtx
+	}
+	return context.Background()
+}
+
+func (o *OneBotClient) authorized(r *http.Request) bool {
+	if o.cfg.AccessToken == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("access_token")
+	}
+	return token == o.cfg.AccessToken
+}
+
+func (o *OneBotClient) Start(ctx context.Context) error {
+	o.appCtx = ctx
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(o.cfg.Path, func(rw http.ResponseWriter, r *http.Request) {
+		if !o.authorized(r) {
+			logger.Warn("Rejected OneBot connection", slog.String("remote_addr", r.RemoteAddr))
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if role := r.Header.Get("X-Client-Role"); role != "" && role != "Universal" {
+			logger.Warn("Only Universal reverse WebSocket is supported", slog.String("role", role))
+			http.Error(rw, "unsupported client role", http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			logger.Error("Failed to upgrade OneBot connection", slog.Any("error", err))
+			return
+		}
+		if selfId := r.Header.Get("X-Self-ID"); selfId != "" {
+			o.selfId.Store(selfId)
+		}
+		logger.Info("OneBot connected", slog.String("remote_addr", r.RemoteAddr), slog.String("self_id", o.GetSelfUserId()))
+		o.serve(conn)
+	})
+
+	server := &http.Server{
+		Addr:    o.cfg.Listen,
+		Handler: mux,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+		o.connMu.Lock()
+		if o.conn != nil {
+			o.conn.Close()
+		}
+		o.connMu.Unlock()
+	}()
+
+	logger.Info("Starting OneBot reverse WebSocket server", slog.String("listen", o.cfg.Listen), slog.String("path", o.cfg.Path))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// serve reads frames from a connection until it closes. A newer connection replaces the current one.
+func (o *OneBotClient) serve(conn *websocket.Conn) {
+	o.connMu.Lock()
+	if o.conn != nil {
+		o.conn.Close()
+	}
+	o.conn = conn
+	o.connMu.Unlock()
+
+	defer func() {
+		o.connMu.Lock()
+		if o.conn == conn {
+			o.conn = nil
+		}
+		o.connMu.Unlock()
+		conn.Close()
+		logger.Info("OneBot disconnected")
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Warn("Failed to read OneBot frame", slog.Any("error", err))
+			}
+			return
+		}
+		var f frame
+		if err := json.Unmarshal(data, &f); err != nil {
+			logger.Warn("Invalid OneBot frame", slog.Any("error", err))
+			continue
+		}
+		if len(f.Echo) > 0 && f.PostType == "" {
+			o.onActionResponse(data)
+			continue
+		}
+		if f.PostType == "message" {
+			go o.onMessageEvent(data)
+		}
+	}
+}
+
+func (o *OneBotClient) onActionResponse(data []byte) {
+	var resp actionResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		logger.Warn("Invalid OneBot action response", slog.Any("error", err))
+		return
+	}
+	var echo string
+	if err := json.Unmarshal(resp.Echo, &echo); err != nil {
+		echo = string(resp.Echo)
+	}
+	o.pendingMu.Lock()
+	ch, ok := o.pending[echo]
+	delete(o.pending, echo)
+	o.pendingMu.Unlock()
+	if ok {
+		ch <- &resp
+	}
+}
+
+func (o *OneBotClient) onMessageEvent(data []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in message handler", slog.Any("panic", r))
+		}
+	}()
+	var event MessageEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		logger.Error("Failed to parse OneBot message event", slog.Any("error", err))
+		return
+	}
+	if event.SelfId != 0 {
+		o.selfId.Store(strconv.FormatInt(event.SelfId, 10))
+	}
+	msg := o.parseMessage(&event)
+	for _, handler := range o.handlers {
+		if handler(o.context(), msg) {
+			return
+		}
+	}
+}
+
+// callAction sends an action over the connection and waits for its response
+func (o *OneBotClient) callAction(action string, params any) (json.RawMessage, error) {
+	o.connMu.Lock()
+	conn := o.conn
+	o.connMu.Unlock()
+	if conn == nil {
+		return nil, errNotConnected
+	}
+
+	echo := strconv.FormatUint(o.echoSeq.Add(1), 10)
+	ch := make(chan *actionResponse, 1)
+	o.pendingMu.Lock()
+	o.pending[echo] = ch
+	o.pendingMu.Unlock()
+	defer func() {
+		o.pendingMu.Lock()
+		delete(o.pending, echo)
+		o.pendingMu.Unlock()
+	}()
+
+	o.writeMu.Lock()
+	err := conn.WriteJSON(actionRequest{Action: action, Params: params, Echo: echo})
+	o.writeMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("onebot %s: %w", action, err)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Status == "failed" || resp.RetCode != 0 {
+			msg := resp.Wording
+			if msg == "" {
+				msg = resp.Message
+			}
+			return nil, fmt.Errorf("onebot %s: retcode=%d, msg=%s", action, resp.RetCode, msg)
+		}
+		return resp.Data, nil
+	case <-time.After(actionTimeout):
+		return nil, fmt.Errorf("onebot %s: timeout", action)
+	case <-o.context().Done():
+		return nil, o.context().Err()
+	}
+}
+
+func (o *OneBotClient) AddMessageHandler(handler func(ctx context.Context, msg contract.GenericMessage) bool) {
+	o.handlers = append(o.handlers, handler)
+}
+
+func (o *OneBotClient) GetSelfUserId() string {
+	return o.selfId.Load().(string)
+}
+
+func (o *OneBotClient) RecallMessage(messageId string) error {
+	if messageId == "" {
+		return nil
+	}
+	id, err := strconv.ParseInt(messageId, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid onebot message id %q: %w", messageId, err)
+	}
+	_, err = o.callAction("delete_msg", map[string]any{"message_id": id})
+	return err
+}
+
+func (o *OneBotClient) UploadImage(base64Content string) (string, error) {
+	// OneBot takes images inline in the message, keep the content as the image key
+	c := strings.TrimSpace(strings.TrimPrefix(base64Content, "base64://"))
+	return c, nil
+}
+
+func (o *OneBotClient) SendRichCard(target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	return o.sendSegments(target.GetTarget(), buildSegments(card))
+}
+
+func (o *OneBotClient) ReplyRichCard(replyToMsgId string, target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	segments := buildSegments(card)
+	if replyToMsgId != "" {
+		segments = append([]Segment{{Type: "reply", Data: map[string]any{"id": replyToMsgId}}}, segments...)
+	}
+	return o.sendSegments(target.GetTarget(), segments)
+}
+
+func (o *OneBotClient) sendSegments(target string, segments []Segment) (string, error) {
+	if len(segments) == 0 {
+		return "", nil
+	}
+	id, err := parseTargetId(target)
+	if err != nil {
+		return "", err
+	}
+	params := map[string]any{"message": segments}
+	if isGroupTarget(target) {
+		params["message_type"] = "group"
+		params["group_id"] = id
+	} else {
+		params["message_type"] = "private"
+		params["user_id"] = id
+	}
+	data, err := o.callAction("send_msg", params)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		MessageId json.Number `json:"message_id"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("failed to parse send_msg result: %w", err)
+	}
+	return result.MessageId.String(), nil
+}
+
+func (o *OneBotClient) UpdateRichCard(messageId string, card *contract.CardBuilder) error {
+	// QQ messages can not be edited
+	return fmt.Errorf("not supported")
+}
+
+func (o *OneBotClient) GetContactDetail(userId ...string) ([]contract.Contact, error) {
+	contacts := make([]contract.Contact, 0, len(userId))
+	for _, target := range userId {
+		id, err := parseTargetId(target)
+		if err != nil {
+			logger.Warn("skipping invalid contact id", slog.Any("error", err))
+			continue
+		}
+		if isGroupTarget(target) {
+			data, err := o.callAction("get_group_info", map[string]any{"group_id": id})
+			if err != nil {
+				logger.Warn("failed to get group info", slog.String("target", target), slog.Any("error", err))
+				continue
+			}
+			var info struct {
+				GroupName string `json:"group_name"`
+			}
+			json.Unmarshal(data, &info)
+			contacts = append(contacts, &OneBotContact{
+				id:        target,
+				name:      info.GroupName,
+				avatarUrl: fmt.Sprintf("https://p.qlogo.cn/gh/%d/%d/640", id, id),
+			})
+			continue
+		}
+		data, err := o.callAction("get_stranger_info", map[string]any{"user_id": id})
+		if err != nil {
+			logger.Warn("failed to get user info", slog.String("target", target), slog.Any("error", err))
+			continue
+		}
+		var info struct {
+			Nickname string `json:"nickname"`
+		}
+		json.Unmarshal(data, &info)
+		contacts = append(contacts, &OneBotContact{
+			id:        target,
+			name:      info.Nickname,
+			avatarUrl: fmt.Sprintf("https://q1.qlogo.cn/g?b=qq&nk=%d&s=640", id),
+		})
+	}
+	return contacts, nil
+}
+
+// OneBotContact implements contract.Contact
+type OneBotContact struct {
+	id        string
+	name      string
+	avatarUrl string
+}
+
+func (c *OneBotContact) Username() string  { return c.id }
+func (c *OneBotContact) Nickname() string  { return c.name }
+func (c *OneBotContact) AvatarUrl() string { return c.avatarUrl }
+
+func (o *OneBotClient) DownloadMessageImage(msgId string) (string, error) {
+	event, err := o.getMessage(msgId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get message: %w", err)
+	}
+	for _, seg := range event.Message {
+		if seg.Type != "image" {
+			continue
+		}
+		url := seg.str("url")
+		if url == "" {
+			url = seg.str("file")
+		}
+		if b64, ok := strings.CutPrefix(url, "base64://"); ok {
+			return b64, nil
+		}
+		if !strings.HasPrefix(url, "http") {
+			continue
+		}
+		resp, err := o.httpClient.R().SetContext(o.context()).Get(url)
+		if err != nil {
+			return "", fmt.Errorf("failed to download image: %w", err)
+		}
+		if !resp.IsSuccess() {
+			return "", fmt.Errorf("failed to download image: %s", resp.Status())
+		}
+		return base64.StdEncoding.EncodeToString(resp.Bytes()), nil
+	}
+	return "", fmt.Errorf("no image found in message %s", msgId)
+}
+
+// getMessage fetches a message by id via get_msg
+func (o *OneBotClient) getMessage(msgId string) (*MessageEvent, error) {
+	id, err := strconv.ParseInt(msgId, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid onebot message id %q: %w", msgId, err)
+	}
+	data, err := o.callAction("get_msg", map[string]any{"message_id": id})
+	if err != nil {
+		return nil, err
+	}
+	var event MessageEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse get_msg result: %w", err)
+	}
+	return &event, nil
+}
@@ -0,0 +1,156 @@
+package onebot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"focalors-go/config"
+	"focalors-go/contract"
+	"focalors-go/provider/onebot"
+
+	"github.com/gorilla/websocket"
+)
+
+// peer plays the OneBot implementation connecting to the bot
+type peer struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func startClient(t *testing.T, token string) (*onebot.OneBotClient, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	client, err := onebot.NewOneBotClient(&config.OneBotConfig{Listen: addr, Path: "/onebot/v11/ws", AccessToken: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go client.Start(ctx)
+	return client, "ws://" + addr + "/onebot/v11/ws"
+}
+
+func dial(t *testing.T, url string, header http.Header) (*peer, *http.Response, error) {
+	t.Helper()
+	var conn *websocket.Conn
+	var resp *http.Response
+	var err error
+	// the server starts in the background
+	for i := 0; i < 50; i++ {
+		conn, resp, err = websocket.DefaultDialer.Dial(url, header)
+		if err == nil || resp != nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		return nil, resp, err
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &peer{t: t, conn: conn}, resp, nil
+}
+
+func (p *peer) push(event any) {
+	p.t.Helper()
+	if err := p.conn.WriteJSON(event); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+// action reads the next action request of the bot and answers it with data
+func (p *peer) action(data any) map[string]any {
+	p.t.Helper()
+	p.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	var req map[string]any
+	if err := p.conn.ReadJSON(&req); err != nil {
+		p.t.Fatalf("no action received: %v", err)
+	}
+	p.push(map[string]any{"status": "ok", "retcode": 0, "data": data, "echo": req["echo"]})
+	return req
+}
+
+func TestRejectsWrongToken(t *testing.T) {
+	_, url := startClient(t, "secret")
+	_, resp, err := dial(t, url, http.Header{"Authorization": {"Bearer wrong"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v %v", resp, err)
+	}
+}
+
+func TestGroupMessageRoundTrip(t *testing.T) {
+	client, url := startClient(t, "secret")
+	received := make(chan contract.GenericMessage, 1)
+	client.AddMessageHandler(func(ctx context.Context, msg contract.GenericMessage) bool {
+		received <- msg
+		return true
+	})
+	p, _, err := dial(t, url, http.Header{"Authorization": {"Bearer secret"}, "X-Self-ID": {"10000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.push(map[string]any{
+		"post_type":    "message",
+		"message_type": "group",
+		"self_id":      10000,
+		"message_id":   7,
+		"user_id":      123,
+		"group_id":     456,
+		"message": []map[string]any{
+			{"type": "at", "data": map[string]any{"qq": "10000"}},
+			{"type": "text", "data": map[string]any{"text": " #help"}},
+		},
+	})
+	var msg contract.GenericMessage
+	select {
+	case msg = <-received:
+	case <-time.After(3 * time.Second):
+		t.Fatal("message not delivered")
+	}
+	if msg.GetText() != "#help" || msg.GetUserId() != "123" || msg.GetTarget() != "456@group" || msg.GetId() != "7" {
+		t.Fatalf("unexpected message: text=%q user=%q target=%q id=%q", msg.GetText(), msg.GetUserId(), msg.GetTarget(), msg.GetId())
+	}
+	if !contract.IsMentioned(msg, client.GetSelfUserId()) {
+		t.Error("the bot should be mentioned")
+	}
+
+	sent := make(chan string, 1)
+	go func() {
+		id, err := client.ReplyRichCard(msg.GetId(), msg, contract.NewCardBuilder().AddMarkdown("hello"))
+		if err != nil {
+			t.Error(err)
+		}
+		sent <- id
+	}()
+	req := p.action(map[string]any{"message_id": 8})
+	if req["action"] != "send_msg" {
+		t.Fatalf("unexpected action %v", req["action"])
+	}
+	raw, _ := json.Marshal(req["params"])
+	var params struct {
+		MessageType string           `json:"message_type"`
+		GroupId     int64            `json:"group_id"`
+		Message     []onebot.Segment `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.MessageType != "group" || params.GroupId != 456 {
+		t.Errorf("unexpected target: %+v", params)
+	}
+	if len(params.Message) != 2 || params.Message[0].Type != "reply" || params.Message[1].Type != "text" {
+		t.Errorf("unexpected segments: %+v", params.Message)
+	}
+	if id := <-sent; id != "8" {
+		t.Errorf("message id = %q, want 8", id)
+	}
+}
@@ -0,0 +1,286 @@
+package onebot
+
+import (
+	"encoding/json"
+	"fmt"
+	"focalors-go/contract"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Segment is a OneBot v11 message segment
+type Segment struct {
+	Type string         `json:"type"`
+	Data map[string]any `json:"data"`
+}
+
+// str reads a data field, implementations differ in sending ids as strings or numbers
+func (s *Segment) str(key string) string {
+	switch v := s.Data[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// MessageChain accepts both the array and the CQ code string message formats
+type MessageChain []Segment
+
+func (m *MessageChain) UnmarshalJSON(data []byte) error {
+	var segments []Segment
+	if err := json.Unmarshal(data, &segments); err == nil {
+		*m = segments
+		return nil
+	}
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("unsupported onebot message format: %w", err)
+	}
+	*m = parseCQCode(raw)
+	return nil
+}
+
+var cqCodeRegex = regexp.MustCompile(`\[CQ:([a-zA-Z_]+)((?:,[^,\]]+)*)\]`)
+
+var cqUnescaper = strings.NewReplacer("&#91;", "[", "&#93;", "]", "&#44;", ",", "&amp;", "&")
+
+// parseCQCode converts a CQ code string like "[CQ:at,qq=123] hi" into segments
+func parseCQCode(raw string) []Segment {
+	var segments []Segment
+	appendText := func(text string) {
+		if text != "" {
+			segments = append(segments, Segment{Type: "text", Data: map[string]any{"text": cqUnescaper.Replace(text)}})
+		}
+	}
+	last := 0
+	for _, loc := range cqCodeRegex.FindAllStringSubmatchIndex(raw, -1) {
+		appendText(raw[last:loc[0]])
+		seg := Segment{Type: raw[loc[2]:loc[3]], Data: map[string]any{}}
+		for _, kv := range strings.Split(strings.TrimPrefix(raw[loc[4]:loc[5]], ","), ",") {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				seg.Data[k] = cqUnescaper.Replace(v)
+			}
+		}
+		segments = append(segments, seg)
+		last = loc[1]
+	}
+	appendText(raw[last:])
+	return segments
+}
+
+type Sender struct {
+	UserId   int64  `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Card     string `json:"card"`
+}
+
+// MessageEvent is a message event pushed by the OneBot implementation, also the result of get_msg
+type MessageEvent struct {
+	Time        int64        `json:"time"`
+	SelfId      int64        `json:"self_id"`
+	PostType    string       `json:"post_type"`
+	MessageType string       `json:"message_type"` // private or group
+	MessageId   json.Number  `json:"message_id"`
+	UserId      int64        `json:"user_id"`
+	GroupId     int64        `json:"group_id"`
+	Message     MessageChain `json:"message"`
+	RawMessage  string       `json:"raw_message"`
+	Sender      Sender       `json:"sender"`
+}
+
+// OneBotMessage implements contract.GenericMessage
+type OneBotMessage struct {
+	id             string
+	text           string
+	content        string
+	userId         string
+	groupId        string
+	isImage        bool
+	mentionedUsers []contract.UserInfo
+	replyToId      string
+	client         *OneBotClient
+	referOnce      sync.Once
+	referMessage   contract.GenericMessage
+}
+
+var _ contract.GenericMessage = (*OneBotMessage)(nil)
+
+func (o *OneBotClient) parseMessage(event *MessageEvent) *OneBotMessage {
+	msg := &OneBotMessage{
+		id:      event.MessageId.String(),
+		content: event.RawMessage,
+		client:  o,
+	}
+	userId := event.UserId
+	if userId == 0 {
+		userId = event.Sender.UserId
+	}
+	msg.userId = strconv.FormatInt(userId, 10)
+	if event.MessageType == "group" && event.GroupId != 0 {
+		msg.groupId = GroupTarget(event.GroupId)
+	}
+
+	selfId := o.GetSelfUserId()
+	var texts []string
+	hasImage := false
+	for _, seg := range event.Message {
+		switch seg.Type {
+		case "text":
+			texts = append(texts, seg.str("text"))
+		case "at":
+			qq := seg.str("qq")
+			if qq == "all" {
+				continue
+			}
+			msg.mentionedUsers = append(msg.mentionedUsers, contract.UserInfo{UserId: qq, Username: seg.str("name")})
+			// keep mentions of other users readable, drop our own so commands parse as usual
+			if qq != selfId {
+				texts = append(texts, "@"+qq)
+			}
+		case "reply":
+			msg.replyToId = seg.str("id")
+		case "image":
+			hasImage = true
+		}
+	}
+	msg.text = strings.TrimSpace(strings.Join(texts, ""))
+	msg.isImage = hasImage && msg.text == ""
+	if msg.content == "" {
+		msg.content = msg.text
+	}
+	return msg
+}
+
+func (m *OneBotMessage) GetId() string {
+	return m.id
+}
+
+func (m *OneBotMessage) GetText() string {
+	return m.text
+}
+
+func (m *OneBotMessage) GetContent() string {
+	return m.content
+}
+
+func (m *OneBotMessage) GetUserId() string {
+	return m.userId
+}
+
+func (m *OneBotMessage) GetGroupId() string {
+	return m.groupId
+}
+
+func (m *OneBotMessage) GetTarget() string {
+	if m.groupId != "" {
+		return m.groupId
+	}
+	return m.userId
+}
+
+func (m *OneBotMessage) IsGroup() bool {
+	return m.groupId != ""
+}
+
+func (m *OneBotMessage) IsText() bool {
+	return m.text != ""
+}
+
+func (m *OneBotMessage) IsImage() bool {
+	return m.isImage
+}
+
+func (m *OneBotMessage) GetReferMessage() (contract.GenericMessage, bool) {
+	if m.replyToId == "" {
+		return nil, false
+	}
+	m.referOnce.Do(func() {
+		event, err := m.client.getMessage(m.replyToId)
+		if err != nil {
+			logger.Warn("failed to fetch referred message", slog.String("message_id", m.replyToId), slog.Any("error", err))
+			return
+		}
+		// get_msg does not always report the chat, it is the same as the replying message
+		if event.MessageType == "" && m.groupId != "" {
+			event.MessageType = "group"
+		}
+		if event.GroupId == 0 && m.groupId != "" {
+			event.GroupId, _ = parseTargetId(m.groupId)
+		}
+		m.referMessage = m.client.parseMessage(event)
+	})
+	if m.referMessage == nil {
+		return nil, false
+	}
+	return m.referMessage, true
+}
+
+func (m *OneBotMessage) GetMentionedUsers() []contract.UserInfo {
+	if len(m.mentionedUsers) == 0 {
+		return nil
+	}
+	mentionedUsers := make([]contract.UserInfo, len(m.mentionedUsers))
+	copy(mentionedUsers, m.mentionedUsers)
+	return mentionedUsers
+}
+
+func textSegment(text string) Segment {
+	return Segment{Type: "text", Data: map[string]any{"text": text}}
+}
+
+// buildSegments renders a card as OneBot segments. QQ has no markdown for ordinary bots,
+// so markdown is sent as plain text and buttons are listed as text.
+func buildSegments(card *contract.CardBuilder) []Segment {
+	var segments []Segment
+	var lines []string
+	flush := func() {
+		if len(lines) > 0 {
+			segments = append(segments, textSegment(strings.Join(lines, "\n")))
+			lines = nil
+		}
+	}
+	if card.Header != "" {
+		lines = append(lines, card.Header)
+	}
+	for _, elem := range card.Elements {
+		switch elem.Type {
+		case contract.CardElementMarkdown:
+			if text := strings.TrimSpace(elem.Content); text != "" {
+				lines = append(lines, text)
+			}
+		case contract.CardElementImage:
+			if elem.Content == "" {
+				continue
+			}
+			flush()
+			file := elem.Content
+			if !strings.HasPrefix(file, "http") && !strings.HasPrefix(file, "base64://") {
+				file = "base64://" + file
+			}
+			segments = append(segments, Segment{Type: "image", Data: map[string]any{"file": file}})
+		case contract.CardElementDivider:
+			lines = append(lines, "——————")
+		case contract.CardElementMention:
+			flush()
+			segments = append(segments, Segment{Type: "at", Data: map[string]any{"qq": elem.Content}})
+		case contract.CardElementButtons:
+			for _, row := range elem.Buttons {
+				for _, btn := range row {
+					lines = append(lines, fmt.Sprintf("👉 %s: %s", btn.Text, btn.Data))
+				}
+			}
+		}
+	}
+	flush()
+	return segments
+}
@@ -0,0 +1,56 @@
+package router
+
+import (
+	"focalors-go/contract"
+)
+
+// routedMessage qualifies every id of a platform message with the platform instance name
+type routedMessage struct {
+	contract.GenericMessage
+	platform string
+}
+
+var _ contract.GenericMessage = (*routedMessage)(nil)
+
+func wrapMessage(platform string, msg contract.GenericMessage) contract.GenericMessage {
+	if msg == nil {
+		return nil
+	}
+	return &routedMessage{GenericMessage: msg, platform: platform}
+}
+
+func (m *routedMessage) GetId() string {
+	return Qualify(m.platform, m.GenericMessage.GetId())
+}
+
+func (m *routedMessage) GetUserId() string {
+	return Qualify(m.platform, m.GenericMessage.GetUserId())
+}
+
+func (m *routedMessage) GetGroupId() string {
+	return Qualify(m.platform, m.GenericMessage.GetGroupId())
+}
+
+func (m *routedMessage) GetTarget() string {
+	return Qualify(m.platform, m.GenericMessage.GetTarget())
+}
+
+func (m *routedMessage) GetReferMessage() (contract.GenericMessage, bool) {
+	refer, ok := m.GenericMessage.GetReferMessage()
+	if !ok {
+		return nil, false
+	}
+	return wrapMessage(m.platform, refer), true
+}
+
+func (m *routedMessage) GetMentionedUsers() []contract.UserInfo {
+	mentioned := m.GenericMessage.GetMentionedUsers()
+	if len(mentioned) == 0 {
+		return nil
+	}
+	users := make([]contract.UserInfo, len(mentioned))
+	for i, user := range mentioned {
+		users[i] = contract.UserInfo{UserId: Qualify(m.platform, user.UserId), Username: user.Username}
+	}
+	return users
+}
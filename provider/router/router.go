@@ -0,0 +1,245 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"focalors-go/contract"
+	"focalors-go/slogger"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+var logger = slogger.New("router")
+
+// imagePrefix marks image keys that still have to be uploaded to the platform the card is sent to
+const imagePrefix = "base64://"
+
+// Router serves several platform clients behind one contract.GenericClient so that all of them
+// share a single middleware pipeline. Every id passing through the router is qualified with the
+// platform instance name, e.g. "lark:oc_xxx", and routed back to that platform on the way out.
+type Router struct {
+	clients map[string]contract.GenericClient
+	names   []string
+}
+
+var _ contract.GenericClient = (*Router)(nil)
+
+func New() *Router {
+	return &Router{clients: make(map[string]contract.GenericClient)}
+}
+
+// Add registers a platform client under the given instance name
+func (r *Router) Add(name string, client contract.GenericClient) {
+	if _, exists := r.clients[name]; !exists {
+		r.names = append(r.names, name)
+	}
+	r.clients[name] = client
+}
+
+// Qualify prefixes a platform specific id with the platform instance name
+func Qualify(platform, id string) string {
+	if id == "" {
+		return ""
+	}
+	return platform + ":" + id
+}
+
+// Split separates a qualified id into the platform instance name and the platform specific id
+func Split(id string) (platform string, rawId string, ok bool) {
+	return strings.Cut(id, ":")
+}
+
+func (r *Router) resolve(id string) (contract.GenericClient, string, string, error) {
+	platform, rawId, ok := Split(id)
+	if !ok {
+		return nil, "", "", fmt.Errorf("id %q is not qualified with a platform", id)
+	}
+	client, ok := r.clients[platform]
+	if !ok {
+		return nil, "", "", fmt.Errorf("unknown platform %q in id %q", platform, id)
+	}
+	return client, platform, rawId, nil
+}
+
+func (r *Router) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(r.names))
+	for i, name := range r.names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.clients[name].Start(ctx); err != nil {
+				logger.Error("Platform stopped", slog.String("platform", name), slog.Any("error", err))
+				errs[i] = fmt.Errorf("%s: %w", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (r *Router) AddMessageHandler(handler func(ctx context.Context, msg contract.GenericMessage) bool) {
+	for _, name := range r.names {
+		r.clients[name].AddMessageHandler(func(ctx context.Context, msg contract.GenericMessage) bool {
+			return handler(ctx, wrapMessage(name, msg))
+		})
+	}
+}
+
+func (r *Router) RecallMessage(messageId string) error {
+	if messageId == "" {
+		return nil
+	}
+	client, _, rawId, err := r.resolve(messageId)
+	if err != nil {
+		return err
+	}
+	return client.RecallMessage(rawId)
+}
+
+// UploadImage defers the upload until the target platform is known, see prepareCard
+func (r *Router) UploadImage(base64Content string) (string, error) {
+	if strings.HasPrefix(base64Content, imagePrefix) {
+		return base64Content, nil
+	}
+	return imagePrefix + base64Content, nil
+}
+
+// prepareCard returns a copy of the card with deferred images uploaded to the given platform
+// and mentioned users unqualified
+func prepareCard(client contract.GenericClient, card *contract.CardBuilder) (*contract.CardBuilder, error) {
+	uploaded := &contract.CardBuilder{
+		Header:   card.Header,
+		Elements: make([]contract.CardElement, len(card.Elements)),
+	}
+	copy(uploaded.Elements, card.Elements)
+	for i, elem := range uploaded.Elements {
+		if elem.Type == contract.CardElementMention {
+			if _, rawId, ok := Split(elem.Content); ok {
+				uploaded.Elements[i].Content = rawId
+			}
+			continue
+		}
+		if elem.Type != contract.CardElementImage || !strings.HasPrefix(elem.Content, imagePrefix) {
+			continue
+		}
+		key, err := client.UploadImage(strings.TrimPrefix(elem.Content, imagePrefix))
+		if err != nil {
+			return nil, err
+		}
+		uploaded.Elements[i].Content = key
+	}
+	return uploaded, nil
+}
+
+func (r *Router) SendRichCard(target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	client, platform, rawId, err := r.resolve(target.GetTarget())
+	if err != nil {
+		return "", err
+	}
+	if card, err = prepareCard(client, card); err != nil {
+		return "", err
+	}
+	msgId, err := client.SendRichCard(contract.NewTarget(rawId), card)
+	return Qualify(platform, msgId), err
+}
+
+func (r *Router) ReplyRichCard(replyToMsgId string, target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	client, platform, rawId, err := r.resolve(target.GetTarget())
+	if err != nil {
+		return "", err
+	}
+	rawReplyId := ""
+	if replyToMsgId != "" {
+		replyPlatform, id, _ := Split(replyToMsgId)
+		if replyPlatform != platform {
+			return "", fmt.Errorf("can not reply to %q on platform %q", replyToMsgId, platform)
+		}
+		rawReplyId = id
+	}
+	if card, err = prepareCard(client, card); err != nil {
+		return "", err
+	}
+	msgId, err := client.ReplyRichCard(rawReplyId, contract.NewTarget(rawId), card)
+	return Qualify(platform, msgId), err
+}
+
+func (r *Router) UpdateRichCard(messageId string, card *contract.CardBuilder) error {
+	if messageId == "" {
+		return nil
+	}
+	client, _, rawId, err := r.resolve(messageId)
+	if err != nil {
+		return err
+	}
+	if card, err = prepareCard(client, card); err != nil {
+		return err
+	}
+	return client.UpdateRichCard(rawId, card)
+}
+
+func (r *Router) GetContactDetail(userId ...string) ([]contract.Contact, error) {
+	// group ids by platform to keep batch lookups
+	byPlatform := make(map[string][]string)
+	for _, id := range userId {
+		platform, rawId, ok := Split(id)
+		if !ok {
+			logger.Warn("skipping unqualified contact id", slog.String("id", id))
+			continue
+		}
+		byPlatform[platform] = append(byPlatform[platform], rawId)
+	}
+	var contacts []contract.Contact
+	for _, name := range r.names {
+		ids := byPlatform[name]
+		if len(ids) == 0 {
+			continue
+		}
+		found, err := r.clients[name].GetContactDetail(ids...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, c := range found {
+			contacts = append(contacts, &contact{Contact: c, platform: name})
+		}
+	}
+	return contacts, nil
+}
+
+// GetSelfUserId returns the bot id on the first platform, use SelfUserIdFor to get the id
+// matching a target.
+func (r *Router) GetSelfUserId() string {
+	if len(r.names) == 0 {
+		return ""
+	}
+	return Qualify(r.names[0], r.clients[r.names[0]].GetSelfUserId())
+}
+
+// SelfUserIdFor returns the bot id on the platform the target belongs to
+func (r *Router) SelfUserIdFor(target string) string {
+	client, platform, _, err := r.resolve(target)
+	if err != nil {
+		return ""
+	}
+	return Qualify(platform, client.GetSelfUserId())
+}
+
+func (r *Router) DownloadMessageImage(msgId string) (string, error) {
+	client, _, rawId, err := r.resolve(msgId)
+	if err != nil {
+		return "", err
+	}
+	return client.DownloadMessageImage(rawId)
+}
+
+// contact qualifies the username of a platform contact
+type contact struct {
+	contract.Contact
+	platform string
+}
+
+func (c *contact) Username() string {
+	return Qualify(c.platform, c.Contact.Username())
+}
@@ -0,0 +1,154 @@
+package router
+
+import (
+	"context"
+	"focalors-go/contract"
+	"testing"
+)
+
+// fakeClient records what the router hands to a platform
+type fakeClient struct {
+	contract.GenericClient
+	selfId   string
+	sent     []string // targets of sent cards
+	replied  []string // ids of replied messages
+	uploaded []string
+	cards    []*contract.CardBuilder
+	handlers []func(ctx context.Context, msg contract.GenericMessage) bool
+}
+
+func (c *fakeClient) GetSelfUserId() string {
+	return c.selfId
+}
+
+func (c *fakeClient) SendRichCard(target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	c.sent = append(c.sent, target.GetTarget())
+	c.cards = append(c.cards, card)
+	return "m1", nil
+}
+
+func (c *fakeClient) ReplyRichCard(replyToMsgId string, target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	c.sent = append(c.sent, target.GetTarget())
+	c.replied = append(c.replied, replyToMsgId)
+	c.cards = append(c.cards, card)
+	return "m2", nil
+}
+
+func (c *fakeClient) UploadImage(base64Content string) (string, error) {
+	c.uploaded = append(c.uploaded, base64Content)
+	return "key", nil
+}
+
+func (c *fakeClient) AddMessageHandler(handler func(ctx context.Context, msg contract.GenericMessage) bool) {
+	c.handlers = append(c.handlers, handler)
+}
+
+// message is a private text message of a platform
+type message struct {
+	contract.GenericMessage
+	id, userId string
+}
+
+func (m *message) GetId() string                                    { return m.id }
+func (m *message) GetUserId() string                                { return m.userId }
+func (m *message) GetGroupId() string                               { return "" }
+func (m *message) GetTarget() string                                { return m.userId }
+func (m *message) GetReferMessage() (contract.GenericMessage, bool) { return nil, false }
+func (m *message) GetMentionedUsers() []contract.UserInfo           { return nil }
+
+func newTestRouter() (*Router, *fakeClient, *fakeClient) {
+	lark, tg := &fakeClient{selfId: "bot"}, &fakeClient{selfId: "42"}
+	r := New()
+	r.Add("lark", lark)
+	r.Add("tg", tg)
+	return r, lark, tg
+}
+
+func TestRouterSendsToPlatform(t *testing.T) {
+	r, lark, tg := newTestRouter()
+
+	card := contract.NewCardBuilder().AddImage("base64://aW1n", "").AddMention("tg:u1", "Alice")
+	key, _ := r.UploadImage("aW1n")
+	if key != "base64://aW1n" {
+		t.Errorf("upload key = %q, want the upload deferred", key)
+	}
+	msgId, err := r.SendRichCard(contract.NewTarget("tg:chat:1"), card)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgId != "tg:m1" {
+		t.Errorf("message id = %q, want it qualified", msgId)
+	}
+	if len(lark.sent) != 0 || len(tg.sent) != 1 || tg.sent[0] != "chat:1" {
+		t.Fatalf("lark sent to %v, tg sent to %v", lark.sent, tg.sent)
+	}
+	if len(tg.uploaded) != 1 || tg.uploaded[0] != "aW1n" {
+		t.Errorf("uploaded = %v, want the image uploaded to tg", tg.uploaded)
+	}
+	elems := tg.cards[0].Elements
+	if elems[0].Content != "key" || elems[1].Content != "u1" {
+		t.Errorf("elements = %+v, want the uploaded key and the raw user id", elems)
+	}
+	if card.Elements[0].Content != "base64://aW1n" {
+		t.Error("the card of the caller was modified")
+	}
+
+	if _, err := r.SendRichCard(contract.NewTarget("chat"), card); err == nil {
+		t.Error("unqualified target is accepted")
+	}
+	if _, err := r.SendRichCard(contract.NewTarget("qq:chat"), card); err == nil {
+		t.Error("unknown platform is accepted")
+	}
+}
+
+func TestRouterRepliesOnPlatform(t *testing.T) {
+	r, lark, _ := newTestRouter()
+
+	msgId, err := r.ReplyRichCard("lark:om_1", contract.NewTarget("lark:oc_1"), contract.NewCardBuilder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgId != "lark:m2" || len(lark.replied) != 1 || lark.replied[0] != "om_1" || lark.sent[0] != "oc_1" {
+		t.Errorf("reply %q, lark replied to %v in %v", msgId, lark.replied, lark.sent)
+	}
+	if _, err := r.ReplyRichCard("tg:1", contract.NewTarget("lark:oc_1"), contract.NewCardBuilder()); err == nil {
+		t.Error("replying across platforms is accepted")
+	}
+}
+
+func TestRouterQualifiesMessages(t *testing.T) {
+	r, _, tg := newTestRouter()
+	var got contract.GenericMessage
+	r.AddMessageHandler(func(ctx context.Context, msg contract.GenericMessage) bool {
+		got = msg
+		return true
+	})
+	tg.handlers[0](context.Background(), &message{id: "7", userId: "u1"})
+	if got.GetId() != "tg:7" || got.GetUserId() != "tg:u1" || got.GetTarget() != "tg:u1" || got.GetGroupId() != "" {
+		t.Errorf("message ids = %q %q %q %q", got.GetId(), got.GetUserId(), got.GetTarget(), got.GetGroupId())
+	}
+}
+
+func TestRouterSelfUserId(t *testing.T) {
+	r, _, _ := newTestRouter()
+	if id := r.GetSelfUserId(); id != "lark:bot" {
+		t.Errorf("GetSelfUserId = %q, want the bot of the first platform", id)
+	}
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"lark:oc_1", "lark:bot"},
+		{"tg:-100:5", "tg:42"},
+		{"qq:1", ""},
+		{"u1", ""},
+	}
+	for _, tt := range tests {
+		if id := contract.GetSelfUserIdFor(r, tt.target); id != tt.want {
+			t.Errorf("GetSelfUserIdFor(%q) = %q, want %q", tt.target, id, tt.want)
+		}
+	}
+	if id := New().GetSelfUserId(); id != "" {
+		t.Errorf("GetSelfUserId without platforms = %q", id)
+	}
+}
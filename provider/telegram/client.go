@@ -0,0 +1,531 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"focalors-go/config"
+	"focalors-go/contract"
+	"focalors-go/slogger"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	R "resty.dev/v3"
+)
+
+var logger = slogger.New("telegram")
+
+const (
+	// long polling timeout passed to getUpdates, in seconds
+	pollTimeout = 30
+	// how long a received photo can be downloaded by message id
+	photoCacheTTL = 1 * time.Hour
+	// Telegram limits callback_data to 64 bytes
+	maxCallbackDataLen = 64
+	// Telegram limits message text to 4096 characters
+	maxTextLen = 4096
+)
+
+type TelegramClient struct {
+	cfg        *config.TelegramConfig
+	httpClient *R.Client
+	handlers   []func(ctx context.Context, msg contract.GenericMessage) bool
+	// set by Start, read by handlers and senders
+	mu     sync.RWMutex
+	self   *User
+	appCtx context.Context
+	// photo file ids of received messages, keyed by message id
+	photoMu sync.Mutex
+	photos  map[string]cachedPhoto
+}
+
+type cachedPhoto struct {
+	fileId   string
+	cachedAt time.Time
+}
+
+var _ contract.GenericClient = (*TelegramClient)(nil)
+
+func NewTelegramClient(cfg *config.TelegramConfig) (*TelegramClient, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("telegram token is required")
+	}
+	if cfg.UpdateMode == config.TelegramUpdateWebhook && cfg.WebhookURL == "" {
+		return nil, fmt.Errorf("telegram webhookURL is required in webhook mode")
+	}
+
+	httpClient := R.New().
+		SetBaseURL(strings.TrimSuffix(cfg.ApiServer, "/")).
+		// long polling holds the request open for pollTimeout seconds
+		SetTimeout((pollTimeout + 30) * time.Second)
+
+	return &TelegramClient{
+		cfg:        cfg,
+		httpClient: httpClient,
+		photos:     make(map[string]cachedPhoto),
+	}, nil
+}
+
+type apiResponse[T any] struct {
+	Ok          bool   `json:"ok"`
+	Result      T      `json:"result"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+func methodPath(token, method string) string {
+	return fmt.Sprintf("/bot%s/%s", token, method)
+}
+
+// callAPI invokes a Bot API method with a JSON body and decodes its result
+func callAPI[T any](ctx context.Context, t *TelegramClient, method string, body any) (T, error) {
+	res := &apiResponse[T]{}
+	req := t.httpClient.R().SetContext(ctx).SetResult(res).SetError(res)
+	if body != nil {
+		req.SetBody(body)
+	}
+	resp, err := req.Post(methodPath(t.cfg.Token, method))
+	if err != nil {
+		return res.Result, fmt.Errorf("telegram %s: %w", method, err)
+	}
+	if !res.Ok {
+		return res.Result, fmt.Errorf("telegram %s: status=%s code=%d, msg=%s", method, resp.Status(), res.ErrorCode, res.Description)
+	}
+	return res.Result, nil
+}
+
+func (t *TelegramClient) context() context.Context {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.appCtx != nil {
+		return t.appCtx
+	}
+	return context.Background()
+}
+
+func (t *TelegramClient) Start(ctx context.Context) error {
+	t.mu.Lock()
+	t.appCtx = ctx
+	t.mu.Unlock()
+
+	self, err := callAPI[User](ctx, t, "getMe", nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch bot info: %w", err)
+	}
+	t.mu.Lock()
+	t.self = &self
+	t.mu.Unlock()
+	logger.Info("bot info fetched successfully", slog.Int64("id", self.Id), slog.String("username", self.Username))
+
+	switch t.cfg.UpdateMode {
+	case config.TelegramUpdateWebhook:
+		return t.startWebhook(ctx)
+	case config.TelegramUpdatePolling, "":
+		return t.startPolling(ctx)
+	default:
+		return fmt.Errorf("unsupported telegram update mode: %s", t.cfg.UpdateMode)
+	}
+}
+
+func (t *TelegramClient) startPolling(ctx context.Context) error {
+	// getUpdates does not work while a webhook is set
+	if _, err := callAPI[bool](ctx, t, "deleteWebhook", nil); err != nil {
+		logger.Warn("failed to delete webhook", slog.Any("error", err))
+	}
+
+	logger.Info("Starting Telegram bot via long polling")
+	offset := int64(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		updates, err := callAPI[[]Update](ctx, t, "getUpdates", map[string]any{
+			"offset":          offset,
+			"timeout":         pollTimeout,
+			"allowed_updates": []string{"message", "callback_query"},
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error("failed to get updates", slog.Any("error", err))
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		for i := range updates {
+			offset = updates[i].UpdateId + 1
+			go t.handleUpdate(&updates[i])
+		}
+	}
+}
+
+func (t *TelegramClient) startWebhook(ctx context.Context) error {
+	if _, err := callAPI[bool](ctx, t, "setWebhook", map[string]any{
+		"url":             t.cfg.WebhookURL,
+		"secret_token":    t.cfg.WebhookSecret,
+		"allowed_updates": []string{"message", "callback_query"},
+	}); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/telegram", func(rw http.ResponseWriter, r *http.Request) {
+		if t.cfg.WebhookSecret != "" && r.Header.Get("X-Telegram-Bot-Api-Secret-Token") != t.cfg.WebhookSecret {
+			logger.Warn("Invalid webhook secret", slog.String("remote_addr", r.RemoteAddr))
+			http.Error(rw, "invalid secret", http.StatusUnauthorized)
+			return
+		}
+		var update Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			logger.Error("Failed to decode update", slog.Any("error", err))
+			http.Error(rw, "bad request", http.StatusBadRequest)
+			return
+		}
+		// Respond immediately, Telegram retries slow webhooks
+		rw.WriteHeader(http.StatusOK)
+		go t.handleUpdate(&update)
+	})
+
+	server := &http.Server{
+		Addr:    t.cfg.WebhookListen,
+		Handler: mux,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	logger.Info("Starting Telegram webhook server", slog.String("listen", t.cfg.WebhookListen))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (t *TelegramClient) handleUpdate(update *Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in update handler", slog.Any("panic", r))
+		}
+	}()
+
+	var msg *TelegramMessage
+	switch {
+	case update.Message != nil:
+		msg = t.parseMessage(update.Message)
+	case update.CallbackQuery != nil:
+		msg = t.parseCallbackQuery(update.CallbackQuery)
+	}
+	if msg == nil {
+		return
+	}
+	for _, handler := range t.handlers {
+		if handler(t.context(), msg) {
+			return
+		}
+	}
+}
+
+func (t *TelegramClient) AddMessageHandler(handler func(ctx context.Context, msg contract.GenericMessage) bool) {
+	t.handlers = append(t.handlers, handler)
+}
+
+// GetSelfUserId returns the id of the bot, empty until Start has fetched it
+func (t *TelegramClient) GetSelfUserId() string {
+	self := t.getSelf()
+	if self == nil {
+		return ""
+	}
+	return strconv.FormatInt(self.Id, 10)
+}
+
+// getSelf returns the bot user, nil until Start has fetched it. The user is never modified once set
+func (t *TelegramClient) getSelf() *User {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.self
+}
+
+// messageKey builds the id exposed to middlewares. Telegram message ids are only unique per chat,
+// so the chat id is part of the key.
+func messageKey(chatId int64, messageId int64) string {
+	return fmt.Sprintf("%d:%d", chatId, messageId)
+}
+
+func parseMessageKey(key string) (chatId int64, messageId int64, err error) {
+	chat, msg, ok := strings.Cut(key, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid telegram message id: %s", key)
+	}
+	if chatId, err = strconv.ParseInt(chat, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid telegram chat id: %w", err)
+	}
+	if messageId, err = strconv.ParseInt(msg, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid telegram message id: %w", err)
+	}
+	return chatId, messageId, nil
+}
+
+func (t *TelegramClient) RecallMessage(messageId string) error {
+	if messageId == "" {
+		return nil
+	}
+	chatId, msgId, err := parseMessageKey(messageId)
+	if err != nil {
+		return err
+	}
+	_, err = callAPI[bool](t.context(), t, "deleteMessage", map[string]any{
+		"chat_id":    chatId,
+		"message_id": msgId,
+	})
+	return err
+}
+
+func (t *TelegramClient) UploadImage(base64Content string) (string, error) {
+	// Telegram uploads photos along with the message, keep the base64 content as the image key
+	c := strings.TrimPrefix(base64Content, "base64://")
+	return strings.TrimSpace(c), nil
+}
+
+func (t *TelegramClient) SendRichCard(target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	return t.sendCard(target.GetTarget(), 0, card)
+}
+
+func (t *TelegramClient) ReplyRichCard(replyToMsgId string, target contract.SendTarget, card *contract.CardBuilder) (string, error) {
+	if replyToMsgId == "" {
+		return t.SendRichCard(target, card)
+	}
+	_, msgId, err := parseMessageKey(replyToMsgId)
+	if err != nil {
+		return "", err
+	}
+	return t.sendCard(target.GetTarget(), msgId, card)
+}
+
+// sendCard sends the card as a sequence of text and photo messages, keeping the element order.
+// The id of the last text message is returned so that the card can be edited later.
+func (t *TelegramClient) sendCard(chatId string, replyTo int64, card *contract.CardBuilder) (string, error) {
+	parts := renderCard(card)
+	keyboard := buildKeyboard(card)
+	lastId := ""
+	for i, part := range parts {
+		var markup any
+		if i == len(parts)-1 && keyboard != nil {
+			markup = keyboard
+		}
+		var (
+			sent *Message
+			err  error
+		)
+		if part.image != "" {
+			sent, err = t.sendPhoto(chatId, replyTo, part.image, markup)
+		} else {
+			sent, err = t.sendText(chatId, replyTo, part.text, markup)
+		}
+		if err != nil {
+			return lastId, err
+		}
+		// only the first message of a card is threaded
+		replyTo = 0
+		lastId = messageKey(sent.Chat.Id, sent.MessageId)
+	}
+	return lastId, nil
+}
+
+func (t *TelegramClient) sendText(chatId string, replyTo int64, text string, markup any) (*Message, error) {
+	body := map[string]any{
+		"chat_id":    chatId,
+		"text":       truncateHTML(text, maxTextLen),
+		"parse_mode": "HTML",
+	}
+	if replyTo != 0 {
+		body["reply_parameters"] = replyParameters(replyTo)
+	}
+	if markup != nil {
+		body["reply_markup"] = markup
+	}
+	sent, err := callAPI[Message](t.context(), t, "sendMessage", body)
+	if err != nil {
+		return nil, err
+	}
+	return &sent, nil
+}
+
+func (t *TelegramClient) sendPhoto(chatId string, replyTo int64, base64Content string, markup any) (*Message, error) {
+	data, err := base64.StdEncoding.DecodeString(base64Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 image: %w", err)
+	}
+	form := map[string]string{"chat_id": chatId}
+	if replyTo != 0 {
+		raw, _ := json.Marshal(replyParameters(replyTo))
+		form["reply_parameters"] = string(raw)
+	}
+	if markup != nil {
+		raw, _ := json.Marshal(markup)
+		form["reply_markup"] = string(raw)
+	}
+	res := &apiResponse[Message]{}
+	resp, err := t.httpClient.R().
+		SetContext(t.context()).
+		SetResult(res).
+		SetError(res).
+		SetFormData(form).
+		SetFileReader("photo", "image", bytes.NewReader(data)).
+		Post(methodPath(t.cfg.Token, "sendPhoto"))
+	if err != nil {
+		return nil, fmt.Errorf("telegram sendPhoto: %w", err)
+	}
+	if !res.Ok {
+		return nil, fmt.Errorf("telegram sendPhoto: status=%s code=%d, msg=%s", resp.Status(), res.ErrorCode, res.Description)
+	}
+	return &res.Result, nil
+}
+
+func (t *TelegramClient) UpdateRichCard(messageId string, card *contract.CardBuilder) error {
+	if messageId == "" {
+		return nil
+	}
+	chatId, msgId, err := parseMessageKey(messageId)
+	if err != nil {
+		return err
+	}
+
+	// editMessageText can only change text, images are sent as follow-up messages
+	var texts []string
+	var images []string
+	for _, part := range renderCard(card) {
+		if part.image != "" {
+			images = append(images, part.image)
+		} else {
+			texts = append(texts, part.text)
+		}
+	}
+	text := strings.Join(texts, "\n\n")
+	if text == "" {
+		text = "🖼"
+	}
+	body := map[string]any{
+		"chat_id":    chatId,
+		"message_id": msgId,
+		"text":       truncateHTML(text, maxTextLen),
+		"parse_mode": "HTML",
+	}
+	if keyboard := buildKeyboard(card); keyboard != nil {
+		body["reply_markup"] = keyboard
+	}
+	if _, err := callAPI[json.RawMessage](t.context(), t, "editMessageText", body); err != nil {
+		// editing with identical content is not an error for us
+		if !strings.Contains(err.Error(), "message is not modified") {
+			return err
+		}
+	}
+	for _, image := range images {
+		if _, err := t.sendPhoto(strconv.FormatInt(chatId, 10), 0, image, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cachePhoto remembers the largest photo size of a received message for DownloadMessageImage
+func (t *TelegramClient) cachePhoto(key string, photos []PhotoSize) {
+	if len(photos) == 0 {
+		return
+	}
+	largest := photos[len(photos)-1]
+	now := time.Now()
+	t.photoMu.Lock()
+	defer t.photoMu.Unlock()
+	for k, v := range t.photos {
+		if now.Sub(v.cachedAt) > photoCacheTTL {
+			delete(t.photos, k)
+		}
+	}
+	t.photos[key] = cachedPhoto{fileId: largest.FileId, cachedAt: now}
+}
+
+func (t *TelegramClient) fileURL(fileId string) (string, error) {
+	file, err := callAPI[File](t.context(), t, "getFile", map[string]any{"file_id": fileId})
+	if err != nil {
+		return "", err
+	}
+	if file.FilePath == "" {
+		return "", fmt.Errorf("no file path returned for %s", fileId)
+	}
+	return fmt.Sprintf("%s/file/bot%s/%s", strings.TrimSuffix(t.cfg.ApiServer, "/"), t.cfg.Token, file.FilePath), nil
+}
+
+func (t *TelegramClient) DownloadMessageImage(msgId string) (string, error) {
+	t.photoMu.Lock()
+	photo, ok := t.photos[msgId]
+	t.photoMu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("no image found for message %s", msgId)
+	}
+
+	url, err := t.fileURL(photo.fileId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get image file: %w", err)
+	}
+	resp, err := t.httpClient.R().SetContext(t.context()).SetDoNotParseResponse(true).Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+	if !resp.IsSuccess() {
+		return "", fmt.Errorf("failed to download image: %s", resp.Status())
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image data: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (t *TelegramClient) GetContactDetail(userId ...string) ([]contract.Contact, error) {
+	contacts := make([]contract.Contact, 0, len(userId))
+	for _, id := range userId {
+		chat, err := callAPI[Chat](t.context(), t, "getChat", map[string]any{"chat_id": id})
+		if err != nil {
+			logger.Warn("failed to get chat info", slog.String("id", id), slog.Any("error", err))
+			continue
+		}
+		contact := &TelegramContact{
+			id:   strconv.FormatInt(chat.Id, 10),
+			name: chat.DisplayName(),
+		}
+		if chat.Photo != nil {
+			if url, err := t.fileURL(chat.Photo.SmallFileId); err == nil {
+				contact.avatarUrl = url
+			}
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, nil
+}
+
+// TelegramContact implements contract.Contact
+type TelegramContact struct {
+	id        string
+	name      string
+	avatarUrl string
+}
+
+func (c *TelegramContact) Username() string  { return c.id }
+func (c *TelegramContact) Nickname() string  { return c.name }
+func (c *TelegramContact) AvatarUrl() string { return c.avatarUrl }
+
+// replyParameters threads a message to replyTo, it is still sent if replyTo was deleted
+func replyParameters(replyTo int64) map[string]any {
+	return map[string]any{"message_id": replyTo, "allow_sending_without_reply": true}
+}
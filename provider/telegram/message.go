@@ -0,0 +1,272 @@
+package telegram
+
+import (
+	"focalors-go/contract"
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Update is an incoming update from the Bot API
+type Update struct {
+	UpdateId      int64          `json:"update_id"`
+	Message       *Message       `json:"message,omitempty"`
+	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+}
+
+type User struct {
+	Id        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+func (u *User) DisplayName() string {
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+type ChatPhoto struct {
+	SmallFileId string `json:"small_file_id"`
+	BigFileId   string `json:"big_file_id"`
+}
+
+type Chat struct {
+	Id        int64      `json:"id"`
+	Type      string     `json:"type"` // private, group, supergroup or channel
+	Title     string     `json:"title,omitempty"`
+	Username  string     `json:"username,omitempty"`
+	FirstName string     `json:"first_name,omitempty"`
+	LastName  string     `json:"last_name,omitempty"`
+	Photo     *ChatPhoto `json:"photo,omitempty"`
+}
+
+func (c *Chat) DisplayName() string {
+	if c.Title != "" {
+		return c.Title
+	}
+	return strings.TrimSpace(c.FirstName + " " + c.LastName)
+}
+
+func (c *Chat) IsGroup() bool {
+	return c.Type == "group" || c.Type == "supergroup"
+}
+
+type MessageEntity struct {
+	Type   string `json:"type"` // mention, text_mention, bot_command, ...
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	User   *User  `json:"user,omitempty"`
+}
+
+type PhotoSize struct {
+	FileId       string `json:"file_id"`
+	FileUniqueId string `json:"file_unique_id"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+type File struct {
+	FileId   string `json:"file_id"`
+	FilePath string `json:"file_path,omitempty"`
+}
+
+type Message struct {
+	MessageId       int64           `json:"message_id"`
+	From            *User           `json:"from,omitempty"`
+	Chat            Chat            `json:"chat"`
+	Date            int64           `json:"date"`
+	Text            string          `json:"text,omitempty"`
+	Caption         string          `json:"caption,omitempty"`
+	Entities        []MessageEntity `json:"entities,omitempty"`
+	CaptionEntities []MessageEntity `json:"caption_entities,omitempty"`
+	Photo           []PhotoSize     `json:"photo,omitempty"`
+	ReplyToMessage  *Message        `json:"reply_to_message,omitempty"`
+}
+
+type CallbackQuery struct {
+	Id      string   `json:"id"`
+	From    User     `json:"from"`
+	Message *Message `json:"message,omitempty"`
+	Data    string   `json:"data,omitempty"`
+}
+
+// TelegramMessage implements contract.GenericMessage
+type TelegramMessage struct {
+	id             string
+	text           string
+	content        string
+	userId         string
+	chat           Chat
+	isImage        bool
+	mentionedUsers []contract.UserInfo
+	referMessage   *TelegramMessage
+}
+
+var _ contract.GenericMessage = (*TelegramMessage)(nil)
+
+func (t *TelegramClient) parseMessage(m *Message) *TelegramMessage {
+	msg := &TelegramMessage{
+		id:      messageKey(m.Chat.Id, m.MessageId),
+		chat:    m.Chat,
+		isImage: len(m.Photo) > 0,
+	}
+	if m.From != nil {
+		msg.userId = strconv.FormatInt(m.From.Id, 10)
+	}
+
+	text, entities := m.Text, m.Entities
+	if msg.isImage {
+		text, entities = m.Caption, m.CaptionEntities
+		t.cachePhoto(msg.id, m.Photo)
+	}
+	msg.content = text
+	msg.mentionedUsers = t.extractMentions(text, entities)
+	if !msg.isImage {
+		msg.text = t.stripSelfMention(text, entities)
+	}
+
+	if m.ReplyToMessage != nil {
+		msg.referMessage = t.parseMessage(m.ReplyToMessage)
+	}
+	return msg
+}
+
+// parseCallbackQuery turns an inline keyboard click into a text message carrying the button data,
+// so middlewares can handle it like a typed command.
+func (t *TelegramClient) parseCallbackQuery(q *CallbackQuery) *TelegramMessage {
+	if _, err := callAPI[bool](t.context(), t, "answerCallbackQuery", map[string]any{
+		"callback_query_id": q.Id,
+	}); err != nil {
+		logger.Warn("failed to answer callback query", slog.Any("error", err))
+	}
+	if q.Message == nil || q.Data == "" {
+		return nil
+	}
+	msg := &TelegramMessage{
+		// callback queries have no message of their own, replies go to the message holding the keyboard
+		id:      messageKey(q.Message.Chat.Id, q.Message.MessageId),
+		text:    q.Data,
+		content: q.Data,
+		userId:  strconv.FormatInt(q.From.Id, 10),
+		chat:    q.Message.Chat,
+	}
+	msg.referMessage = t.parseMessage(q.Message)
+	return msg
+}
+
+// entityText extracts the text covered by an entity, whose offsets are in UTF-16 code units
+func entityText(units []uint16, e MessageEntity) string {
+	if e.Offset < 0 || e.Offset+e.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+}
+
+func (t *TelegramClient) extractMentions(text string, entities []MessageEntity) []contract.UserInfo {
+	if len(entities) == 0 {
+		return nil
+	}
+	self := t.getSelf()
+	units := utf16.Encode([]rune(text))
+	var users []contract.UserInfo
+	for _, e := range entities {
+		switch e.Type {
+		case "text_mention":
+			if e.User != nil {
+				users = append(users, contract.UserInfo{
+					UserId:   strconv.FormatInt(e.User.Id, 10),
+					Username: e.User.DisplayName(),
+				})
+			}
+		case "mention":
+			username := strings.TrimPrefix(entityText(units, e), "@")
+			user := contract.UserInfo{Username: username}
+			// plain @username mentions carry no user id, but we know our own
+			if self != nil && strings.EqualFold(username, self.Username) {
+				user.UserId = strconv.FormatInt(self.Id, 10)
+			}
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// stripSelfMention removes @bot mentions so that commands like "@bot #煎蛋" parse as usual
+func (t *TelegramClient) stripSelfMention(text string, entities []MessageEntity) string {
+	self := t.getSelf()
+	if self == nil || self.Username == "" {
+		return strings.TrimSpace(text)
+	}
+	units := utf16.Encode([]rune(text))
+	var out []uint16
+	last := 0
+	for _, e := range entities {
+		if e.Type != "mention" || e.Offset < last || e.Offset+e.Length > len(units) {
+			continue
+		}
+		if !strings.EqualFold(strings.TrimPrefix(entityText(units, e), "@"), self.Username) {
+			continue
+		}
+		out = append(out, units[last:e.Offset]...)
+		last = e.Offset + e.Length
+	}
+	out = append(out, units[last:]...)
+	return strings.TrimSpace(string(utf16.Decode(out)))
+}
+
+func (m *TelegramMessage) GetId() string {
+	return m.id
+}
+
+func (m *TelegramMessage) GetText() string {
+	return m.text
+}
+
+func (m *TelegramMessage) GetContent() string {
+	return m.content
+}
+
+func (m *TelegramMessage) GetUserId() string {
+	return m.userId
+}
+
+func (m *TelegramMessage) GetGroupId() string {
+	if m.chat.IsGroup() {
+		return strconv.FormatInt(m.chat.Id, 10)
+	}
+	return ""
+}
+
+func (m *TelegramMessage) GetTarget() string {
+	return strconv.FormatInt(m.chat.Id, 10)
+}
+
+func (m *TelegramMessage) IsGroup() bool {
+	return m.chat.IsGroup()
+}
+
+func (m *TelegramMessage) IsText() bool {
+	return m.text != ""
+}
+
+func (m *TelegramMessage) IsImage() bool {
+	return m.isImage
+}
+
+func (m *TelegramMessage) GetReferMessage() (contract.GenericMessage, bool) {
+	if m.referMessage == nil {
+		return nil, false
+	}
+	return m.referMessage, true
+}
+
+func (m *TelegramMessage) GetMentionedUsers() []contract.UserInfo {
+	if len(m.mentionedUsers) == 0 {
+		return nil
+	}
+	mentionedUsers := make([]contract.UserInfo, len(m.mentionedUsers))
+	copy(mentionedUsers, m.mentionedUsers)
+	return mentionedUsers
+}
@@ -0,0 +1,207 @@
+package telegram
+
+import (
+	"fmt"
+	"focalors-go/contract"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// cardPart is either a chunk of HTML text or a base64 image, sent as one Telegram message
+type cardPart struct {
+	text  string
+	image string
+}
+
+// renderCard flattens a card into messages: consecutive text elements are merged,
+// every image becomes its own photo message.
+func renderCard(card *contract.CardBuilder) []cardPart {
+	var parts []cardPart
+	var texts []string
+	flush := func() {
+		if len(texts) > 0 {
+			parts = append(parts, cardPart{text: strings.Join(texts, "\n\n")})
+			texts = nil
+		}
+	}
+	if card.Header != "" {
+		texts = append(texts, "<b>"+html.EscapeString(card.Header)+"</b>")
+	}
+	for _, elem := range card.Elements {
+		switch elem.Type {
+		case contract.CardElementMarkdown:
+			if text := markdownToHTML(elem.Content); text != "" {
+				texts = append(texts, text)
+			}
+		case contract.CardElementImage:
+			if elem.Content == "" {
+				continue
+			}
+			flush()
+			parts = append(parts, cardPart{image: elem.Content})
+		case contract.CardElementDivider:
+			texts = append(texts, "——————")
+		case contract.CardElementMention:
+			texts = append(texts, fmt.Sprintf(`<a href="tg://user?id=%s">%s</a>`,
+				html.EscapeString(elem.Content), html.EscapeString(elem.MentionName())))
+		}
+	}
+	flush()
+	// a card with only buttons still needs a message to attach the keyboard to
+	if len(parts) == 0 && buildKeyboard(card) != nil {
+		parts = append(parts, cardPart{text: "👇"})
+	}
+	return parts
+}
+
+type inlineKeyboardButton struct {
+	Text         string `json:"text"`
+	Url          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+type inlineKeyboardMarkup struct {
+	InlineKeyboard [][]inlineKeyboardButton `json:"inline_keyboard"`
+}
+
+// buildKeyboard maps all button elements of the card to one inline keyboard.
+// Buttons holding a URL open it, others send their data back as a callback query.
+func buildKeyboard(card *contract.CardBuilder) *inlineKeyboardMarkup {
+	var rows [][]inlineKeyboardButton
+	for _, elem := range card.Elements {
+		if elem.Type != contract.CardElementButtons {
+			continue
+		}
+		for _, row := range elem.Buttons {
+			var buttons []inlineKeyboardButton
+			for _, btn := range row {
+				b := inlineKeyboardButton{Text: btn.Text}
+				if strings.HasPrefix(btn.Data, "http://") || strings.HasPrefix(btn.Data, "https://") {
+					b.Url = btn.Data
+				} else {
+					b.CallbackData = truncateBytes(btn.Data, maxCallbackDataLen)
+				}
+				buttons = append(buttons, b)
+			}
+			if len(buttons) > 0 {
+				rows = append(rows, buttons)
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return &inlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// truncateBytes cuts s to at most n bytes without splitting a UTF-8 sequence
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !isRuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// truncateHTML cuts Telegram HTML to at most limit visible characters, ending with "…". It only
+// cuts between tags and entities, and closes the tags left open, so the result still parses.
+func truncateHTML(text string, limit int) string {
+	if len([]rune(text)) <= limit {
+		return text
+	}
+	var out strings.Builder
+	var open []string
+	visible := 0
+	for i := 0; i < len(text) && visible < limit-1; {
+		switch text[i] {
+		case '<':
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 {
+				i = len(text)
+				continue
+			}
+			tag := text[i : i+end+1]
+			if name, ok := strings.CutPrefix(tag, "</"); ok {
+				if len(open) > 0 && open[len(open)-1] == strings.TrimSuffix(name, ">") {
+					open = open[:len(open)-1]
+				}
+			} else {
+				name := strings.Trim(tag, "<>")
+				if j := strings.IndexByte(name, ' '); j >= 0 {
+					name = name[:j]
+				}
+				open = append(open, name)
+			}
+			out.WriteString(tag)
+			i += end + 1
+			continue
+		}
+		n := 1
+		if text[i] == '&' {
+			if end := strings.IndexByte(text[i:], ';'); end > 0 {
+				n = end + 1
+			}
+		} else {
+			_, n = utf8.DecodeRuneInString(text[i:])
+		}
+		out.WriteString(text[i : i+n])
+		visible++
+		i += n
+	}
+	out.WriteString("…")
+	for j := len(open) - 1; j >= 0; j-- {
+		out.WriteString("</" + open[j] + ">")
+	}
+	return out.String()
+}
+
+var (
+	codeBlockRegex  = regexp.MustCompile("(?s)```[a-zA-Z0-9_+-]*\\n?(.*?)```")
+	inlineCodeRegex = regexp.MustCompile("`([^`\\n]+)`")
+	boldRegex       = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	linkRegex       = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s]+)\)`)
+	headingRegex    = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+)
+
+// markdownToHTML converts the small markdown subset produced by middlewares and LLMs
+// into Telegram HTML. Anything else is escaped and sent as plain text.
+func markdownToHTML(markdown string) string {
+	markdown = strings.TrimSpace(markdown)
+	if markdown == "" {
+		return ""
+	}
+
+	// code is extracted first so that its content is not formatted
+	var codes []string
+	placeholder := func(s string) string {
+		codes = append(codes, s)
+		return "\x00" + strconv.Itoa(len(codes)-1) + "\x00"
+	}
+	text := codeBlockRegex.ReplaceAllStringFunc(markdown, func(m string) string {
+		inner := codeBlockRegex.FindStringSubmatch(m)[1]
+		return placeholder("<pre>" + html.EscapeString(strings.TrimRight(inner, "\n")) + "</pre>")
+	})
+	text = inlineCodeRegex.ReplaceAllStringFunc(text, func(m string) string {
+		inner := inlineCodeRegex.FindStringSubmatch(m)[1]
+		return placeholder("<code>" + html.EscapeString(inner) + "</code>")
+	})
+
+	text = html.EscapeString(text)
+	text = linkRegex.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = boldRegex.ReplaceAllString(text, "<b>$1</b>")
+	text = headingRegex.ReplaceAllString(text, "<b>$1</b>")
+
+	for i, code := range codes {
+		text = strings.Replace(text, "\x00"+strconv.Itoa(i)+"\x00", code, 1)
+	}
+	return text
+}
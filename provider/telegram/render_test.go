@@ -0,0 +1,27 @@
+package telegram
+
+import "testing"
+
+func TestTruncateHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+	}{
+		{"short", "<b>hi</b>", 10, "<b>hi</b>"},
+		{"plain", "abcdef", 4, "abc…"},
+		{"closes open tags", "<b>abcdef</b>", 4, "<b>abc…</b>"},
+		{"nested", `<a href="x"><b>abcdef</b></a>`, 3, `<a href="x"><b>ab…</b></a>`},
+		{"keeps entities whole", "a&amp;bcdef", 3, "a&amp;…"},
+		{"counts runes", "你好世界再见", 3, "你好…"},
+		{"drops tags after the cut", "abc<b>def</b>", 3, "ab…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateHTML(tt.text, tt.limit); got != tt.want {
+				t.Errorf("truncateHTML(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
@@ -37,13 +37,13 @@ func prettyBody(body string) string {
 	return body
 }
 
-func NewWechat(cfg *cfg.Config) (*WechatClient, error) {
+func NewWechat(cfg *cfg.WechatConfig) (*WechatClient, error) {
 	httpClient := R.New()
 	httpClient.
-		SetBaseURL(cfg.Wechat.Server).
+		SetBaseURL(cfg.Server).
 		// SetDebug(cfg.App.Debug).
 		SetTimeout(2*time.Minute).
-		SetQueryParam("key", cfg.Wechat.Token).
+		SetQueryParam("key", cfg.Token).
 		SetDebugLogFormatter(func(dl *R.DebugLog) string {
 			req := fmt.Sprintf("\n-------------\nRequest:\nURL: %s\nHeader: %v\nBody: %s\n", dl.Request.URI, dl.Request.Header, prettyBody(dl.Request.Body))
 			res := fmt.Sprintf("---------------\nResponse:\nStatus: %s\nHeader: %v\nBody: %s\n", dl.Response.Status, dl.Response.Header, prettyBody(dl.Response.Body))
@@ -51,7 +51,7 @@ func NewWechat(cfg *cfg.Config) (*WechatClient, error) {
 		})
 
 	w := &WechatClient{
-		cfg:        &cfg.Wechat,
+		cfg:        cfg,
 		httpClient: httpClient,
 		// ws:         protocol.NewClient[WechatSyncMessage](ctx, cfg.Wechat.SubURL),
 	}
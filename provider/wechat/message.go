@@ -186,16 +186,37 @@ func (w *WechatClient) UploadImage(base64Content string) (string, error) {
 func (w *WechatClient) SendRichCard(target contract.SendTarget, card *contract.CardBuilder) (string, error) {
 	// WeChat doesn't support rich cards, send elements as separate messages
 	var lastMsgId string
+	// mentions are prepended to the next text message
+	var atNames, atIds []string
+	sendAt := func(text string) {
+		w.SendMessage(&TextMessageModel{MsgItem: []TextMessageItem{{
+			ToUserName:  target.GetTarget(),
+			TextContent: strings.Join(append(atNames, text), "\u2005"),
+			MsgType:     1,
+			AtWxIDList:  atIds,
+		}}})
+		atNames, atIds = nil, nil
+	}
 	for _, elem := range card.Elements {
 		switch elem.Type {
 		case contract.CardElementMarkdown:
+			if len(atIds) > 0 {
+				sendAt(strings.Trim(elem.Content, " \n"))
+				continue
+			}
 			w.SendTextBatch(NewMessageUnit(target, elem.Content))
 		case contract.CardElementImage:
 			w.sendImageDirect(target, elem.Content)
 		case contract.CardElementDivider:
 			// Skip dividers for WeChat
+		case contract.CardElementMention:
+			atNames = append(atNames, elem.MentionName())
+			atIds = append(atIds, elem.Content)
 		}
 	}
+	if len(atIds) > 0 {
+		sendAt("")
+	}
 	return lastMsgId, nil
 }
 
@@ -14,11 +14,17 @@ import (
 
 var logger = slogger.New("scheduler")
 
+// cronJob is a scheduled job with the params it was added with
+type cronJob struct {
+	id     cron.EntryID
+	params map[string]string
+}
+
 type CronTask struct {
 	cron      *cron.Cron
-	cronJobs  map[string]cron.EntryID
+	cronJobs  map[string]cronJob
 	cronMutex sync.Mutex
-	redis     *db.Redis
+	kv        db.KV
 }
 
 func (m *CronTask) Start() {
@@ -29,11 +35,11 @@ func (m *CronTask) Stop() {
 	m.cron.Stop()
 }
 
-func NewCronTask(redis *db.Redis) *CronTask {
+func NewCronTask(kv db.KV) *CronTask {
 	return &CronTask{
 		cron:     cron.New(),
-		cronJobs: make(map[string]cron.EntryID),
-		redis:    redis,
+		cronJobs: make(map[string]cronJob),
+		kv:       kv,
 	}
 }
 
@@ -58,25 +64,27 @@ func (m *CronTask) AddCronJob(name string, job func(params map[string]string) er
 		return err
 	}
 	// delete previous job if exists
-	if id, exists := m.cronJobs[name]; exists {
+	if previous, exists := m.cronJobs[name]; exists {
 		// remove existing job
-		m.cron.Remove(id)
+		m.cron.Remove(previous.id)
 	}
-	m.cronJobs[name] = id
+	m.cronJobs[name] = cronJob{id: id, params: params}
 	key := getCronKey(name)
-	m.redis.HSet(key, params)
+	if err := m.kv.HSet(key, params); err != nil {
+		logger.Error("Failed to persist cron job", slog.String("name", name), slog.Any("error", err))
+	}
 	return nil
 }
 
 func (m *CronTask) RemoveCronJob(name string) {
 	m.cronMutex.Lock()
 	defer m.cronMutex.Unlock()
-	if id, exists := m.cronJobs[name]; exists {
-		m.cron.Remove(id)
+	if job, exists := m.cronJobs[name]; exists {
+		m.cron.Remove(job.id)
 		delete(m.cronJobs, name)
-		key := getCronKey(name)
-		m.redis.Del(key)
 	}
+	// the job may be persisted without being scheduled, e.g. before it is restored
+	m.kv.Del(getCronKey(name))
 }
 
 func (m *CronTask) GetCronJobs(key string) (jobs []map[string]string) {
@@ -84,9 +92,9 @@ func (m *CronTask) GetCronJobs(key string) (jobs []map[string]string) {
 	defer m.cronMutex.Unlock()
 
 	// iterate all the keys with "cron:job:{key}"
-	keys, _ := m.redis.Keys(getCronKey(key))
+	keys, _ := db.ScanAll(m.kv, getCronKey(key))
 	for _, key := range keys {
-		val, err := m.redis.HGetAll(key)
+		val, err := m.kv.HGetAll(key)
 		if err != nil {
 			continue // skip if there's an error
 		}
@@ -118,13 +126,9 @@ func (m *CronTask) TaskEntries() []TaskEntry {
 	for _, entry := range entries {
 		wxid := ""
 		taskType := ""
-		for key, cronId := range m.cronJobs {
-			if cronId == entry.ID {
-				ret := strings.Split(key, ":")
-				if len(ret) > 0 {
-					wxid = ret[len(ret)-1]
-					taskType = strings.Join(ret[0:len(ret)-1], ":")
-				}
+		for name, job := range m.cronJobs {
+			if job.id == entry.ID {
+				taskType, wxid = splitJobName(name, job.params)
 				break
 			}
 		}
@@ -139,6 +143,16 @@ func (m *CronTask) TaskEntries() []TaskEntry {
 	return tasks
 }
 
+// splitJobName returns the type and the target of a job named "<type>:<target>[:<id>]". Targets may
+// contain ":" themselves, e.g. "lark:oc_xxx", so the target is taken from the params when they have one.
+func splitJobName(name string, params map[string]string) (taskType string, target string) {
+	taskType, target, _ = strings.Cut(name, ":")
+	if t, ok := params["target"]; ok {
+		target = t
+	}
+	return taskType, target
+}
+
 func ValidateCronInterval(spec string, minInterval time.Duration) error {
 	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
 	schedule, err := parser.Parse(spec)
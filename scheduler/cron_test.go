@@ -0,0 +1,37 @@
+package scheduler
+
+import (
+	"focalors-go/db"
+	"testing"
+)
+
+func TestTaskEntries(t *testing.T) {
+	m := NewCronTask(db.NewMemoryKV())
+	noop := func(map[string]string) error { return nil }
+	jobs := map[string]map[string]string{
+		"reminder:lark:oc_1:r1": {"spec": "0 9 * * *", "target": "lark:oc_1"},
+		"jiadan:telegram:42":    {"spec": "0 * * * *", "target": "telegram:42"},
+		"misc:u1":               {"spec": "0 * * * *"},
+	}
+	for name, params := range jobs {
+		if err := m.AddCronJob(name, noop, params); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{"reminder": "lark:oc_1", "jiadan": "telegram:42", "misc": "u1"}
+	entries := m.TaskEntries()
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(entries), len(want))
+	}
+	for _, entry := range entries {
+		if target, ok := want[entry.Type]; !ok || entry.Wxid != target {
+			t.Errorf("entry %s has target %q, want %q", entry.Type, entry.Wxid, target)
+		}
+	}
+
+	m.RemoveCronJob("misc:u1")
+	if entries := m.TaskEntries(); len(entries) != 2 {
+		t.Errorf("%d entries after removing one, want 2", len(entries))
+	}
+}
@@ -1,22 +1,26 @@
 package service
 
 import (
+	"errors"
 	"focalors-go/db"
 	"slices"
 	"strconv"
 	"strings"
-
-	"github.com/redis/go-redis/v9"
 )
 
 type Access int
 
 const (
 	GPTAccess = 1 << iota
+	DrawAccess
+	// YunzaiAdminAccess lets a user run the admin commands of Yunzai plugins
+	YunzaiAdminAccess
 )
 
 var AccessNameDict = map[string]Access{
-	"gpt": GPTAccess,
+	"gpt":          GPTAccess,
+	"draw":         DrawAccess,
+	"yunzai-admin": YunzaiAdminAccess,
 }
 
 // String returns the string representation of the permission
@@ -67,13 +71,13 @@ func NewAccess(accessType string) Access {
 }
 
 type AccessService struct {
-	redis *db.Redis
+	kv    db.KV
 	admin []string
 }
 
-func NewAccessService(redis *db.Redis, admin []string) *AccessService {
+func NewAccessService(kv db.KV, admin []string) *AccessService {
 	return &AccessService{
-		redis: redis,
+		kv:    kv,
 		admin: admin,
 	}
 }
@@ -88,7 +92,7 @@ type AccessItem struct {
 }
 
 func (a *AccessService) ListAll() ([]AccessItem, error) {
-	keys, err := a.redis.Keys("access:*")
+	keys, err := db.ScanAll(a.kv, "access:*")
 	if err != nil {
 		return nil, err
 	}
@@ -109,9 +113,8 @@ func (a *AccessService) ListAll() ([]AccessItem, error) {
 
 func (a *AccessService) GetAccess(user string) (Access, error) {
 	key := getKey(user)
-	stored, err := a.redis.Get(key)
-	// redis.Nil represents a missing key
-	if err == redis.Nil {
+	stored, err := a.kv.Get(key)
+	if errors.Is(err, db.ErrNotFound) {
 		return 0, nil
 	}
 	if err != nil {
@@ -126,7 +129,7 @@ func (a *AccessService) SetAccess(user string, access Access) error {
 		return nil
 	}
 	key := getKey(user)
-	return a.redis.Set(key, strconv.Itoa(int(access)), 0)
+	return a.kv.Set(key, strconv.Itoa(int(access)), 0)
 }
 
 func (a *AccessService) AddAccess(user string, access Access) error {
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"resty.dev/v3"
+)
+
+// maxGeneratedImageSize caps the download of images returned as URLs
+const maxGeneratedImageSize = 20 << 20
+
+// ImageService generates images with the images endpoint of the OpenAI client
+type ImageService struct {
+	openai *openai.Client
+	model  string
+	client *resty.Client
+}
+
+func NewImageService(client *openai.Client, model string) *ImageService {
+	return &ImageService{
+		openai: client,
+		model:  model,
+		client: resty.New().SetRetryCount(3).SetRetryWaitTime(1 * time.Second).SetResponseBodyLimit(maxGeneratedImageSize),
+	}
+}
+
+// GeneratedImage is a generated image as base64, along with the prompt the model actually used
+type GeneratedImage struct {
+	Base64        string
+	RevisedPrompt string
+}
+
+// isGPTImage tells the gpt-image models apart from DALL·E, they take other sizes and qualities
+// and always answer with base64
+func (s *ImageService) isGPTImage() bool {
+	return strings.HasPrefix(s.model, "gpt-image")
+}
+
+// Generate creates an image. size is "1024x1024", "1792x1024" (landscape) or "1024x1792" (portrait),
+// quality is "standard" or "hd". Both are translated for gpt-image models.
+func (s *ImageService) Generate(ctx context.Context, prompt, size, quality string) (*GeneratedImage, error) {
+	params := openai.ImageGenerateParams{
+		Prompt: prompt,
+		Model:  openai.ImageModel(s.model),
+		N:      openai.Int(1),
+	}
+	if s.isGPTImage() {
+		params.Size = openai.ImageGenerateParamsSize(strings.NewReplacer("1792", "1536").Replace(size))
+		if quality == "hd" {
+			params.Quality = openai.ImageGenerateParamsQualityHigh
+		} else {
+			params.Quality = openai.ImageGenerateParamsQualityMedium
+		}
+	} else {
+		params.Size = openai.ImageGenerateParamsSize(size)
+		params.Quality = openai.ImageGenerateParamsQuality(quality)
+		params.ResponseFormat = openai.ImageGenerateParamsResponseFormatB64JSON
+	}
+
+	resp, err := s.openai.Images.Generate(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no image generated")
+	}
+	image := resp.Data[0]
+	if image.B64JSON != "" {
+		return &GeneratedImage{Base64: image.B64JSON, RevisedPrompt: image.RevisedPrompt}, nil
+	}
+	if image.URL == "" {
+		return nil, fmt.Errorf("neither b64_json nor url in the response")
+	}
+	// compatible backends may ignore response_format and answer with a URL
+	content, err := s.download(ctx, image.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &GeneratedImage{Base64: content, RevisedPrompt: image.RevisedPrompt}, nil
+}
+
+func (s *ImageService) download(ctx context.Context, url string) (string, error) {
+	resp, err := s.client.R().SetContext(ctx).Get(url)
+	if err != nil {
+		return "", fmt.Errorf("download generated image: %w", err)
+	}
+	if resp.StatusCode() != 200 {
+		return "", fmt.Errorf("download generated image: unexpected status code: %s", resp.Status())
+	}
+	return base64.StdEncoding.EncodeToString(resp.Bytes()), nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"focalors-go/db"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const personaKeyPrefix = "persona:"
+
+// PromptVars are the template variables available in system prompts, e.g. "今天是{{.Date}}"
+type PromptVars struct {
+	Date      string // 2006-01-02
+	Time      string // 15:04
+	Weekday   string // 星期一
+	GroupName string // empty in private chats
+	Nickname  string // nickname of the sender
+}
+
+var weekdays = []string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+func NewPromptVars(now time.Time, groupName, nickname string) PromptVars {
+	return PromptVars{
+		Date:      now.Format("2006-01-02"),
+		Time:      now.Format("15:04"),
+		Weekday:   weekdays[now.Weekday()],
+		GroupName: groupName,
+		Nickname:  nickname,
+	}
+}
+
+// PersonaService stores system prompts overriding the default one per target (user/group)
+type PersonaService struct {
+	kv db.KV
+}
+
+func NewPersonaService(kv db.KV) *PersonaService {
+	return &PersonaService{kv: kv}
+}
+
+// Get returns the persona of the target, empty if none is set
+func (p *PersonaService) Get(target string) (string, error) {
+	persona, err := p.kv.Get(personaKeyPrefix + target)
+	if errors.Is(err, db.ErrNotFound) {
+		return "", nil
+	}
+	return persona, err
+}
+
+// Set validates and stores the persona of the target
+func (p *PersonaService) Set(target string, persona string) error {
+	if _, err := parsePrompt(persona); err != nil {
+		return err
+	}
+	return p.kv.Set(personaKeyPrefix+target, persona, 0)
+}
+
+func (p *PersonaService) Clear(target string) error {
+	return p.kv.Del(personaKeyPrefix + target)
+}
+
+func parsePrompt(prompt string) (*template.Template, error) {
+	return template.New("prompt").Option("missingkey=zero").Parse(prompt)
+}
+
+// RenderPrompt fills the template variables of a system prompt, unknown variables render empty
+func RenderPrompt(prompt string, vars PromptVars) (string, error) {
+	tmpl, err := parsePrompt(prompt)
+	if err != nil {
+		return "", err
+	}
+	// missingkey only applies to maps, a struct fails on unknown fields
+	data := map[string]string{
+		"Date":      vars.Date,
+		"Time":      vars.Time,
+		"Weekday":   vars.Weekday,
+		"GroupName": vars.GroupName,
+		"Nickname":  vars.Nickname,
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
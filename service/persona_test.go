@@ -0,0 +1,29 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 5, 0, 0, time.UTC)
+	vars := NewPromptVars(now, "", "Alice")
+	tests := []struct {
+		prompt  string
+		want    string
+		wantErr bool
+	}{
+		{"今天是{{.Date}} {{.Time}} {{.Weekday}}", "今天是2026-10-16 09:05 星期五", false},
+		{"你好{{.Nickname}}", "你好Alice", false},
+		{"群聊: {{.GroupName}}", "群聊:", false},
+		{"{{.Unknown}}未知变量为空", "未知变量为空", false},
+		{"{{if .GroupName}}群聊{{else}}私聊{{end}}", "私聊", false},
+		{"{{.Date", "", true},
+	}
+	for _, tt := range tests {
+		got, err := RenderPrompt(tt.prompt, vars)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("RenderPrompt(%q) = %q, %v, want %q", tt.prompt, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"focalors-go/contract"
+	"focalors-go/scheduler"
+	"focalors-go/slogger"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var reminderLogger = slogger.New("service.reminder")
+
+const (
+	reminderJobPrefix = "reminder:"
+	// MaxRemindersPerUser bounds the pending reminders of a user in one chat
+	MaxRemindersPerUser = 10
+	// minimum interval of recurring reminders
+	reminderMinInterval = 10 * time.Minute
+	// how far ahead a one-shot reminder may be set, its cron spec repeats yearly
+	reminderMaxAhead = 365 * 24 * time.Hour
+)
+
+// Reminder is a message sent to a user at a time (one-shot) or on a cron schedule (recurring)
+type Reminder struct {
+	Id      string
+	Target  string // chat the reminder is sent to
+	User    string // user who set the reminder, mentioned in groups
+	IsGroup bool
+	Text    string
+	At      time.Time // fire time of a one-shot reminder, zero for recurring ones
+	Spec    string    // cron spec of a recurring reminder
+}
+
+// Recurring reports whether the reminder fires on a cron schedule
+func (r *Reminder) Recurring() bool {
+	return r.At.IsZero()
+}
+
+// Next returns the next fire time after now
+func (r *Reminder) Next(now time.Time) time.Time {
+	if !r.Recurring() {
+		return r.At
+	}
+	schedule, err := cron.ParseStandard(r.Spec)
+	if err != nil {
+		return time.Time{}
+	}
+	return schedule.Next(now)
+}
+
+func (r *Reminder) jobName() string {
+	return reminderJobName(r.Target, r.Id)
+}
+
+func reminderJobName(target, id string) string {
+	return fmt.Sprintf("%s%s:%s", reminderJobPrefix, target, id)
+}
+
+func (r *Reminder) params() map[string]string {
+	params := map[string]string{
+		"id":     r.Id,
+		"target": r.Target,
+		"user":   r.User,
+		"group":  strconv.FormatBool(r.IsGroup),
+		"text":   r.Text,
+		"spec":   r.Spec,
+	}
+	if !r.Recurring() {
+		params["at"] = r.At.Format(time.RFC3339)
+		// fires yearly, the job removes itself after the first run
+		params["spec"] = fmt.Sprintf("%d %d %d %d *", r.At.Minute(), r.At.Hour(), r.At.Day(), int(r.At.Month()))
+	}
+	return params
+}
+
+func reminderFromParams(params map[string]string) (*Reminder, error) {
+	r := &Reminder{
+		Id:     params["id"],
+		Target: params["target"],
+		User:   params["user"],
+		Text:   params["text"],
+	}
+	r.IsGroup, _ = strconv.ParseBool(params["group"])
+	if r.Id == "" || r.Target == "" {
+		return nil, fmt.Errorf("reminder without id or target")
+	}
+	if at := params["at"]; at != "" {
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, fmt.Errorf("reminder %s: %w", r.Id, err)
+		}
+		r.At = t.Local()
+	} else {
+		r.Spec = params["spec"]
+	}
+	return r, nil
+}
+
+// ReminderService schedules reminders with the cron task, which persists them
+type ReminderService struct {
+	cron   *scheduler.CronTask
+	client contract.GenericClient
+}
+
+func NewReminderService(cron *scheduler.CronTask, client contract.GenericClient) *ReminderService {
+	return &ReminderService{cron: cron, client: client}
+}
+
+// NewOnce creates a one-shot reminder. Reminders fire on whole minutes, so at is rounded up to the
+// minute: short delays such as "10s" fire a bit late rather than never.
+func NewOnce(at time.Time, text string) (*Reminder, error) {
+	now := time.Now()
+	if !at.After(now) {
+		return nil, errors.New("提醒时间必须在将来")
+	}
+	if truncated := at.Truncate(time.Minute); truncated.Before(at) {
+		at = truncated.Add(time.Minute)
+	}
+	if at.Sub(now) > reminderMaxAhead {
+		return nil, errors.New("最多只能提前一年设置提醒")
+	}
+	return &Reminder{At: at, Text: text}, nil
+}
+
+// NewRecurring creates a reminder firing on a cron schedule
+func NewRecurring(spec string, text string) (*Reminder, error) {
+	if err := scheduler.ValidateCronInterval(spec, reminderMinInterval); err != nil {
+		return nil, err
+	}
+	return &Reminder{Spec: spec, Text: text}, nil
+}
+
+// Add schedules the reminder for the user in the target chat
+func (s *ReminderService) Add(r *Reminder, target, user string, isGroup bool) error {
+	if strings.TrimSpace(r.Text) == "" {
+		return errors.New("提醒内容不能为空")
+	}
+	if len(s.List(target, user)) >= MaxRemindersPerUser {
+		return fmt.Errorf("每人最多设置%d个提醒", MaxRemindersPerUser)
+	}
+	r.Target, r.User, r.IsGroup = target, user, isGroup
+	id := make([]byte, 3)
+	rand.Read(id)
+	r.Id = hex.EncodeToString(id)
+	return s.cron.AddCronJob(r.jobName(), s.job(), r.params())
+}
+
+// List returns the reminders of the user in the target chat, the next due first
+func (s *ReminderService) List(target, user string) []*Reminder {
+	var reminders []*Reminder
+	for _, params := range s.cron.GetCronJobs(reminderJobName(target, "*")) {
+		r, err := reminderFromParams(params)
+		if err != nil || r.Target != target || r.User != user {
+			continue
+		}
+		reminders = append(reminders, r)
+	}
+	now := time.Now()
+	slices.SortFunc(reminders, func(a, b *Reminder) int {
+		return a.Next(now).Compare(b.Next(now))
+	})
+	return reminders
+}
+
+// Cancel removes a reminder of the user, returns false if there is none with the id
+func (s *ReminderService) Cancel(target, user, id string) bool {
+	for _, r := range s.List(target, user) {
+		if r.Id == id {
+			s.cron.RemoveCronJob(r.jobName())
+			return true
+		}
+	}
+	return false
+}
+
+// Restore schedules the persisted reminders again after a restart. One-shot reminders missed
+// while the bot was down are sent right away.
+func (s *ReminderService) Restore() {
+	for _, params := range s.cron.GetCronJobs(reminderJobPrefix + "*") {
+		r, err := reminderFromParams(params)
+		if err != nil {
+			reminderLogger.Warn("Invalid reminder", slog.Any("params", params), slog.Any("error", err))
+			continue
+		}
+		if !r.Recurring() && !r.At.After(time.Now()) {
+			s.fire(r)
+			continue
+		}
+		if err := s.cron.AddCronJob(r.jobName(), s.job(), params); err != nil {
+			reminderLogger.Error("Failed to restore reminder", slog.String("id", r.Id), slog.Any("error", err))
+		}
+	}
+}
+
+func (s *ReminderService) job() func(params map[string]string) error {
+	return func(params map[string]string) error {
+		r, err := reminderFromParams(params)
+		if err != nil {
+			return err
+		}
+		s.fire(r)
+		return nil
+	}
+}
+
+// fire sends the reminder, one-shot reminders are removed afterwards
+func (s *ReminderService) fire(r *Reminder) {
+	if !r.Recurring() {
+		s.cron.RemoveCronJob(r.jobName())
+	}
+	card := contract.NewCardBuilder()
+	if r.IsGroup {
+		name := r.User
+		if contacts, err := s.client.GetContactDetail(r.User); err == nil && len(contacts) > 0 {
+			name = contacts[0].Nickname()
+		}
+		card.AddMention(r.User, name)
+	}
+	text := "⏰ " + r.Text
+	if late := time.Since(r.At); !r.Recurring() && late > time.Minute {
+		text += fmt.Sprintf("\n(原定 %s, 迟到了)", r.At.Format("01-02 15:04"))
+	}
+	card.AddMarkdown(text)
+	if _, err := s.client.SendRichCard(contract.NewTarget(r.Target), card); err != nil {
+		reminderLogger.Error("Failed to send reminder", slog.String("id", r.Id), slog.Any("error", err))
+	}
+}
+
+// reminderDays are the day words a time of day may be prefixed with, and their offset from today
+var reminderDays = map[string]int{"今天": 0, "明天": 1, "后天": 2}
+
+// ParseReminderTime parses the time of a one-shot reminder: a duration ("30m", "2h"), a time of day
+// ("20:00", today or tomorrow if passed), "明天20:00", "后天 8:30", "10-17 20:00" or "2026-10-17 20:00"
+func ParseReminderTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return time.Time{}, errors.New("提醒时间必须在将来")
+		}
+		return now.Add(d), nil
+	}
+	days, day := 0, ""
+	for prefix, offset := range reminderDays {
+		if after, ok := strings.CutPrefix(s, prefix); ok {
+			s, days, day = strings.TrimSpace(after), offset, prefix
+			break
+		}
+	}
+	if t, err := time.ParseInLocation("15:04", s, now.Location()); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day()+days, t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			if day != "" {
+				return time.Time{}, errors.New("提醒时间必须在将来")
+			}
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	if day != "" {
+		return time.Time{}, fmt.Errorf("无法识别的时间: %s%s", day, s)
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("01-02 15:04", s, now.Location()); err == nil {
+		at := time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(1, 0, 0)
+		}
+		return at, nil
+	}
+	return time.Time{}, fmt.Errorf("无法识别的时间: %s", s)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReminderTime(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2026, 10, 16, 10, 30, 45, 0, loc)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, loc)
+	}
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"30m", now.Add(30 * time.Minute), false},
+		{"10s", now.Add(10 * time.Second), false},
+		{" 2h ", now.Add(2 * time.Hour), false},
+		{"0s", time.Time{}, true},
+		{"-5m", time.Time{}, true},
+		{"20:00", at(10, 16, 20, 0), false},
+		{"9:00", at(10, 17, 9, 0), false},    // passed today
+		{"10:30", at(10, 17, 10, 30), false}, // the current minute has passed too
+		{"今天20:00", at(10, 16, 20, 0), false},
+		{"今天 20:00", at(10, 16, 20, 0), false},
+		{"今天 9:00", time.Time{}, true}, // explicitly today, but passed
+		{"明天8:30", at(10, 17, 8, 30), false},
+		{"后天 23:59", at(10, 18, 23, 59), false},
+		{"明天", time.Time{}, true},
+		{"明天 25:00", time.Time{}, true},
+		{"10-17 20:00", at(10, 17, 20, 0), false},
+		{"10-16 9:00", time.Date(2027, 10, 16, 9, 0, 0, 0, loc), false}, // passed this year
+		{"01-05 08:00", time.Date(2027, 1, 5, 8, 0, 0, 0, loc), false},
+		{"2026-12-31 23:59", at(12, 31, 23, 59), false},
+		{"2026-13-01 00:00", time.Time{}, true},
+		{"tomorrow", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseReminderTime(tt.input, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil || !got.Equal(tt.want) {
+				t.Errorf("got %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewOnce(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		at      time.Time
+		wantErr bool
+	}{
+		{"seconds ahead", now.Add(10 * time.Second), false},
+		{"a minute ahead", now.Add(time.Minute), false},
+		{"on a whole minute", now.Truncate(time.Minute).Add(2 * time.Minute), false},
+		{"passed", now.Add(-time.Second), true},
+		{"too far ahead", now.AddDate(1, 0, 2), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewOnce(tt.at, "text")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %v, want an error", r.At)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.At.Before(tt.at) || r.At.Sub(tt.at) >= time.Minute || r.At.Second() != 0 || r.At.Nanosecond() != 0 {
+				t.Errorf("At = %v, want %v rounded up to the minute", r.At, tt.at)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"fmt"
+	"focalors-go/db"
+)
+
+const toolToggleKeyPrefix = "tools:"
+
+// Scopes holding the default tool switches of all group or all private chats
+const (
+	ToolScopeGroups  = "@group"
+	ToolScopePrivate = "@private"
+)
+
+// ToolToggleService stores which GPT tools are switched on or off per target (user/group).
+// A switch of the target wins over the one of its scope (all groups or all private chats),
+// tools without any switch are enabled.
+type ToolToggleService struct {
+	kv db.KV
+}
+
+func NewToolToggleService(kv db.KV) *ToolToggleService {
+	return &ToolToggleService{kv: kv}
+}
+
+func toolToggleKey(scope string) string {
+	return toolToggleKeyPrefix + scope
+}
+
+// Set switches a tool on or off for a target or a scope
+func (t *ToolToggleService) Set(scope string, tool string, enabled bool) error {
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+	return t.kv.HSet(toolToggleKey(scope), map[string]string{tool: value})
+}
+
+// Reset removes the switch of a tool, so the scope default applies again
+func (t *ToolToggleService) Reset(scope string, tool string) error {
+	return t.kv.HSet(toolToggleKey(scope), map[string]string{tool: ""})
+}
+
+// List returns the switches of a target or a scope
+func (t *ToolToggleService) List(scope string) (map[string]bool, error) {
+	values, err := t.kv.HGetAll(toolToggleKey(scope))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]bool, len(values))
+	for tool, value := range values {
+		if value != "" {
+			result[tool] = value == "1"
+		}
+	}
+	return result, nil
+}
+
+// Enabled resolves whether the tool is available for the target
+func (t *ToolToggleService) Enabled(target string, isGroup bool, tool string) (bool, error) {
+	scope := ToolScopePrivate
+	if isGroup {
+		scope = ToolScopeGroups
+	}
+	for _, key := range []string{target, scope} {
+		switches, err := t.List(key)
+		if err != nil {
+			return true, fmt.Errorf("list tool switches of %s: %w", key, err)
+		}
+		if enabled, ok := switches[tool]; ok {
+			return enabled, nil
+		}
+	}
+	return true, nil
+}
@@ -77,12 +77,56 @@ type WeatherLive struct {
 	ReportTime    string `json:"reporttime"`
 }
 
+// WeatherCast is the forecast of one day
+type WeatherCast struct {
+	Date         string `json:"date"` // 2006-01-02
+	Week         string `json:"week"` // 1-7, Monday to Sunday
+	DayWeather   string `json:"dayweather"`
+	NightWeather string `json:"nightweather"`
+	DayTemp      string `json:"daytemp"`
+	NightTemp    string `json:"nighttemp"`
+	DayWind      string `json:"daywind"`
+	NightWind    string `json:"nightwind"`
+	DayPower     string `json:"daypower"`
+	NightPower   string `json:"nightpower"`
+}
+
+var weekNames = map[string]string{"1": "周一", "2": "周二", "3": "周三", "4": "周四", "5": "周五", "6": "周六", "7": "周日"}
+
+// Weekday returns the Chinese name of the day, e.g. 周一
+func (c *WeatherCast) Weekday() string {
+	return weekNames[c.Week]
+}
+
+// WeatherForecast holds the forecasts of today and the next days
+type WeatherForecast struct {
+	Province   string        `json:"province"`
+	City       string        `json:"city"`
+	Adcode     string        `json:"adcode"`
+	ReportTime string        `json:"reporttime"`
+	Casts      []WeatherCast `json:"casts"`
+}
+
 type WeatherData struct {
-	Status   string        `json:"status"` // 1: success, 0: failed
-	Count    string        `json:"count"`
-	Info     string        `json:"info"`
-	InfoCode string        `json:"infocode"` // 返回状态说明,10000代表正确
-	Lives    []WeatherLive `json:"lives"`
+	Status    string            `json:"status"` // 1: success, 0: failed
+	Count     string            `json:"count"`
+	Info      string            `json:"info"`
+	InfoCode  string            `json:"infocode"`  // 返回状态说明,10000代表正确
+	Lives     []WeatherLive     `json:"lives"`     // extensions=base
+	Forecasts []WeatherForecast `json:"forecasts"` // extensions=all
+}
+
+// WeatherIcon returns an emoji for the weather description, e.g. 小雨 -> 🌧
+func WeatherIcon(weather string) string {
+	for _, icon := range []struct{ keyword, emoji string }{
+		{"雷", "⛈"}, {"雪", "❄️"}, {"雨", "🌧"}, {"雾", "🌫"}, {"霾", "🌫"}, {"沙", "🌪"}, {"尘", "🌪"},
+		{"风", "🌬"}, {"多云", "⛅"}, {"阴", "☁️"}, {"晴", "☀️"},
+	} {
+		if strings.Contains(weather, icon.keyword) {
+			return icon.emoji
+		}
+	}
+	return "🌡"
 }
 
 func (w *WeatherService) initCityData() error {
@@ -179,7 +223,25 @@ func (w *WeatherService) getAdcode(location string) (string, error) {
 	return "", fmt.Errorf("no matching adcode found for %s", location)
 }
 
+// GetWeather returns the live weather at the location
 func (w *WeatherService) GetWeather(ctx context.Context, location string) ([]WeatherLive, error) {
+	report, err := w.query(ctx, location, "base")
+	if err != nil {
+		return nil, err
+	}
+	return report.Lives, nil
+}
+
+// GetForecast returns the forecasts of today and the next three days at the location
+func (w *WeatherService) GetForecast(ctx context.Context, location string) ([]WeatherForecast, error) {
+	report, err := w.query(ctx, location, "all")
+	if err != nil {
+		return nil, err
+	}
+	return report.Forecasts, nil
+}
+
+func (w *WeatherService) query(ctx context.Context, location string, extensions string) (*WeatherData, error) {
 	if w.cfg.Key == "" {
 		return nil, fmt.Errorf("weather service key is not set")
 	}
@@ -193,6 +255,7 @@ func (w *WeatherService) GetWeather(ctx context.Context, location string) ([]Wea
 		SetResult(&report).
 		SetQueryParam("key", w.cfg.Key).
 		SetQueryParam("city", adcode).
+		SetQueryParam("extensions", extensions).
 		Get("https://restapi.amap.com/v3/weather/weatherInfo")
 	if err != nil {
 		return nil, err
@@ -204,5 +267,5 @@ func (w *WeatherService) GetWeather(ctx context.Context, location string) ([]Wea
 	if report.Status != "1" {
 		return nil, fmt.Errorf("error fetching weather data: %s", report.Info)
 	}
-	return report.Lives, nil
+	return &report, nil
 }
@@ -2,22 +2,28 @@ package yunzai
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
-	"focalors-go/config"
 	"focalors-go/protocol"
 	"strings"
+	"time"
+
+	"resty.dev/v3"
 )
 
+// images sent as links are downloaded up to this size
+const maxLinkImageSize = 20 << 20
+
 type YunzaiClient struct {
 	ws       *protocol.WebSocketClient[Response]
-	cfg      *config.Config
 	handlers []func(ctx context.Context, msg *Response) bool
+	http     *resty.Client
 }
 
-func NewYunzai(cfg *config.Config) *YunzaiClient {
+func NewYunzai(server string) *YunzaiClient {
 	return &YunzaiClient{
-		ws:  protocol.NewClient[Response](cfg.Yunzai.Server),
-		cfg: cfg,
+		ws:   protocol.NewClient[Response](server),
+		http: resty.New().SetRetryCount(2).SetRetryWaitTime(1 * time.Second).SetResponseBodyLimit(maxLinkImageSize),
 	}
 }
 
@@ -50,7 +56,7 @@ func (y *YunzaiClient) RefreshAvatar(userId string, avatarContent string) {
 		MsgId:     "meta_" + userId,
 		UserId:    userId,
 		GroupId:   "",
-		UserPM:    0,
+		UserPM:    UserPMUser,
 		UserType:  "direct",
 		Content:   []MessageContent{},
 		Sender: map[string]any{
@@ -59,6 +65,15 @@ func (y *YunzaiClient) RefreshAvatar(userId string, avatarContent string) {
 	})
 }
 
+// NewSender returns the sender of a request, the avatar is uploaded separately by RefreshAvatar
+func NewSender(nickname string) map[string]any {
+	sender := map[string]any{}
+	if nickname != "" {
+		sender["nickname"] = nickname
+	}
+	return sender
+}
+
 // toDataURL wraps raw base64 content as a data URL if needed.
 func toDataURL(content string) string {
 	if strings.HasPrefix(content, "data:") || strings.HasPrefix(content, "http") {
@@ -66,3 +81,20 @@ func toDataURL(content string) string {
 	}
 	return fmt.Sprintf("data:image/png;base64,%s", content)
 }
+
+// LoadImage returns the base64 content of an image segment, "base64://..." is returned as is
+// and "link://<url>" is downloaded
+func (y *YunzaiClient) LoadImage(ctx context.Context, data string) (string, error) {
+	url, ok := strings.CutPrefix(data, "link://")
+	if !ok {
+		return data, nil
+	}
+	resp, err := y.http.R().SetContext(ctx).Get(url)
+	if err != nil {
+		return "", fmt.Errorf("download image: %w", err)
+	}
+	if resp.StatusCode() != 200 {
+		return "", fmt.Errorf("download image: unexpected status code: %s", resp.Status())
+	}
+	return base64.StdEncoding.EncodeToString(resp.Bytes()), nil
+}
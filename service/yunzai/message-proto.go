@@ -1,5 +1,11 @@
 package yunzai
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
 // https://docs.sayu-bot.com/CodeAdapter/Protocol.html#%E4%B8%8A%E6%8A%A5%E6%B6%88%E6%81%AF
 // Request sent by the client
 type Request struct {
@@ -11,11 +17,18 @@ type Request struct {
 	// TargetType string `json:"target_type"` // direct
 	// TargetId   string           `json:"target_id"`   // user_id or group_id
 	UserId  string           `json:"user_id"`
-	UserPM  int              `json:"user_pm"` // Permission
+	UserPM  int              `json:"user_pm"` // Permission, see UserPMMaster
 	Content []MessageContent `json:"content"`
 	Sender  map[string]any   `json:"sender"`
 }
 
+// Permission levels of Request.UserPM, lower is more privileged
+const (
+	UserPMMaster = 0
+	UserPMAdmin  = 1
+	UserPMUser   = 6
+)
+
 // https://docs.sayu-bot.com/CodeAdapter/Protocol.html#%E5%8F%91%E9%80%81%E6%B6%88%E6%81%AF
 // Message received by the client
 type Response struct {
@@ -23,6 +36,7 @@ type Response struct {
 	BotSelfId  string `json:"bot_self_id"`
 	TargetType string `json:"target_type"` // direct
 	TargetId   string `json:"target_id"`   // user_id or group_id
+	MsgId      string `json:"msg_id"`      // msg_id of the request answered, if any
 
 	Content []MessageContent `json:"content"`
 }
@@ -33,6 +47,67 @@ func (r *Response) GetTarget() string {
 
 // https://docs.sayu-bot.com/CodeAdapter/Protocol.html#%E6%B6%88%E6%81%AF%E7%B1%BB%E5%9E%8B-message
 type MessageContent struct {
-	Type string `json:"type"` // text, markdown, image, reply, at, image_size,
+	Type string `json:"type"` // text, markdown, image, image_size, reply, at, buttons, template_buttons, file, group, node
 	Data any    `json:"data"`
 }
+
+// Button of a buttons segment, rows of buttons or a single row
+type Button struct {
+	Text        string `json:"text"`
+	Data        string `json:"data"`
+	PressedText string `json:"pressed_text"`
+	Action      int    `json:"action"` // -1 auto, 0 link, 1 callback, 2 command
+}
+
+// ImageSize of an image_size segment, it applies to the following image
+type ImageSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Text returns the data of text-like segments: text, markdown, reply, at, file and group
+func (c *MessageContent) Text() (string, bool) {
+	switch data := c.Data.(type) {
+	case string:
+		return data, true
+	case float64:
+		// ids may be sent as numbers
+		return strconv.FormatFloat(data, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// Buttons decodes the data of a buttons segment
+func (c *MessageContent) Buttons() ([][]Button, error) {
+	raw, err := json.Marshal(c.Data)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]Button
+	if err := json.Unmarshal(raw, &rows); err == nil {
+		return rows, nil
+	}
+	var row []Button
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return nil, fmt.Errorf("decode buttons: %w", err)
+	}
+	return [][]Button{row}, nil
+}
+
+// ImageSize decodes the data of an image_size segment, {"width": w, "height": h} or [w, h]
+func (c *MessageContent) ImageSize() (ImageSize, error) {
+	var size ImageSize
+	raw, err := json.Marshal(c.Data)
+	if err != nil {
+		return size, err
+	}
+	if err := json.Unmarshal(raw, &size); err == nil {
+		return size, nil
+	}
+	var pair []int
+	if err := json.Unmarshal(raw, &pair); err != nil || len(pair) != 2 {
+		return size, fmt.Errorf("invalid image size: %s", raw)
+	}
+	return ImageSize{Width: pair[0], Height: pair[1]}, nil
+}
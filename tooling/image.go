@@ -0,0 +1,67 @@
+package tooling
+
+import (
+	"context"
+	"fmt"
+	"focalors-go/db"
+	"focalors-go/service"
+	"log/slog"
+)
+
+// ImageTool draws images for targets with the draw access, limited by a daily quota per target
+type ImageTool struct {
+	*TypedTool[imageArgs]
+	images *service.ImageService
+	quota  *db.QuotaStore
+	limit  int
+}
+
+type imageArgs struct {
+	Prompt  string `json:"prompt" description:"Detailed description of the image in English" required:"true" min:"1"`
+	Size    string `json:"size" description:"Image size: square, landscape or portrait, defaults to square" enum:"1024x1024,1792x1024,1024x1792" default:"1024x1024"`
+	Quality string `json:"quality" description:"Image quality, use hd only if the user asks for details" enum:"standard,hd" default:"standard"`
+}
+
+// NewImageTool creates an image generation tool, dailyLimit <= 0 means unlimited
+func NewImageTool(images *service.ImageService, quota *db.QuotaStore, dailyLimit int) *ImageTool {
+	i := &ImageTool{
+		images: images,
+		quota:  quota,
+		limit:  dailyLimit,
+	}
+	i.TypedTool = NewTypedTool("generate_image",
+		"Draw an image from a text description. "+
+			"Only call it when the user explicitly asks for a picture, the image is shown to the user automatically.",
+		i.execute).WithAccess(service.DrawAccess)
+	return i
+}
+
+func (i *ImageTool) execute(ctx context.Context, args imageArgs) (*ToolResult, error) {
+	target := GetTarget(ctx)
+	ok, err := i.quota.Take(target, i.limit)
+	if err != nil {
+		logger.Error("Failed to check image quota", slog.String("target", target), slog.Any("error", err))
+		return NewToolResult("Failed to check the drawing quota"), nil
+	}
+	if !ok {
+		return NewToolResult(fmt.Sprintf("The daily drawing quota (%d images) of this chat is used up, try again tomorrow", i.limit)), nil
+	}
+
+	logger.Info("Generating image", slog.String("target", target), slog.String("size", args.Size), slog.String("quality", args.Quality))
+	image, err := i.images.Generate(ctx, args.Prompt, args.Size, args.Quality)
+	if err != nil {
+		logger.Error("Failed to generate image", slog.String("target", target), slog.Any("error", err))
+		if i.limit > 0 {
+			if err := i.quota.Refund(target); err != nil {
+				logger.Warn("Failed to refund image quota", slog.Any("error", err))
+			}
+		}
+		return NewToolResult(fmt.Sprintf("Failed to generate the image: %s", err.Error())), nil
+	}
+
+	text := "The image has been generated and shown to the user"
+	if image.RevisedPrompt != "" {
+		text += fmt.Sprintf(", revised prompt: %s", image.RevisedPrompt)
+	}
+	return NewToolResult(text).AddImage(image.Base64, args.Prompt), nil
+}
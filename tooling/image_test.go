@@ -0,0 +1,91 @@
+package tooling
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"focalors-go/db"
+	"focalors-go/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// newImageServer is a stub images endpoint, the prompt "url" is answered with a URL
+// to download the image from and "fail" with an error
+func newImageServer(t *testing.T, image []byte) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/images/generations":
+			var params struct {
+				Prompt string `json:"prompt"`
+			}
+			json.NewDecoder(r.Body).Decode(&params)
+			w.Header().Set("Content-Type", "application/json")
+			switch params.Prompt {
+			case "fail":
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"message": "rejected"}})
+			case "url":
+				json.NewEncoder(w).Encode(map[string]any{"created": 1, "data": []map[string]any{{"url": server.URL + "/files/cat.png"}}})
+			default:
+				json.NewEncoder(w).Encode(map[string]any{"created": 1, "data": []map[string]any{{
+					"b64_json": base64.StdEncoding.EncodeToString(image), "revised_prompt": "a fluffy cat",
+				}}})
+			}
+		case "/files/cat.png":
+			w.Write(image)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestImageTool(t *testing.T) {
+	image := []byte("png")
+	server := newImageServer(t, image)
+	client := openai.NewClient(option.WithBaseURL(server.URL), option.WithAPIKey("k"), option.WithMaxRetries(0))
+	kv := db.NewMemoryKV()
+	quota := db.NewQuotaStore(kv, "image")
+	tool := NewImageTool(service.NewImageService(&client, "dall-e-3"), quota, 2)
+	ctx := WithTarget(context.Background(), "g1")
+
+	tests := []struct {
+		prompt   string
+		wantText string
+		images   int
+	}{
+		{"cat", "The image has been generated and shown to the user, revised prompt: a fluffy cat", 1},
+		{"fail", "Failed to generate the image", 0}, // refunded
+		{"url", "The image has been generated and shown to the user", 1},
+		{"cat", "The daily drawing quota (2 images) of this chat is used up, try again tomorrow", 0},
+	}
+	for i, tt := range tests {
+		result, err := tool.Execute(ctx, `{"prompt":"`+tt.prompt+`"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(result.Text, tt.wantText) {
+			t.Errorf("%d: text = %q, want %q", i, result.Text, tt.wantText)
+		}
+		if len(result.Contents) != tt.images {
+			t.Fatalf("%d: %d contents, want %d", i, len(result.Contents), tt.images)
+		}
+		if tt.images > 0 {
+			content := result.Contents[0]
+			if content.Type != ContentImage || content.Image != base64.StdEncoding.EncodeToString(image) || content.AltText != tt.prompt {
+				t.Errorf("%d: content = %+v", i, content)
+			}
+		}
+	}
+	if used, _ := quota.Used("g1"); used != 2 {
+		t.Errorf("used = %d, want 2", used)
+	}
+}
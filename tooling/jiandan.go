@@ -5,63 +5,32 @@ import (
 	"fmt"
 	"focalors-go/service"
 	"log/slog"
-
-	"github.com/openai/openai-go"
 )
 
 // JiadanTool provides humor posts from Jiandan
 type JiadanTool struct {
+	*TypedTool[jiadanArgs]
 	jiadan *service.JiadanService
 }
 
 type jiadanArgs struct {
-	Count int `json:"count"`
+	Count int `json:"count" description:"Number of posts to fetch (1-5), defaults to 1" min:"1" max:"5" default:"1"`
 }
 
 // NewJiadanTool creates a new jiadan tool with the given service
 func NewJiadanTool(jiadan *service.JiadanService) *JiadanTool {
-	return &JiadanTool{
+	j := &JiadanTool{
 		jiadan: jiadan,
 	}
+	j.TypedTool = NewTypedTool("jiandan_top",
+		"Get top humor image posts from Jiandan (煎蛋), a Chinese humor website. "+
+			"Returns post info with image URLs that can be shared with users.",
+		j.execute)
+	return j
 }
 
-func (j *JiadanTool) Name() string {
-	return "jiandan_top"
-}
-
-func (j *JiadanTool) Definition() openai.FunctionDefinitionParam {
-	return openai.FunctionDefinitionParam{
-		Name: j.Name(),
-		Description: openai.String("Get top humor image posts from Jiandan (煎蛋), a Chinese humor website. " +
-			"Returns post info with image URLs that can be shared with users."),
-		Parameters: openai.FunctionParameters{
-			"type": "object",
-			"properties": map[string]interface{}{
-				"count": map[string]interface{}{
-					"type":        "integer",
-					"description": "Number of posts to fetch (1-5), defaults to 1",
-					"minimum":     1,
-					"maximum":     5,
-					"default":     1,
-				},
-			},
-		},
-	}
-}
-
-func (j *JiadanTool) Execute(ctx context.Context, argsJSON string) (*ToolResult, error) {
-	args, err := ParseArgs[jiadanArgs](argsJSON)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse jiandan args: %w", err)
-	}
-
+func (j *JiadanTool) execute(ctx context.Context, args jiadanArgs) (*ToolResult, error) {
 	count := args.Count
-	if count < 1 {
-		count = 1
-	}
-	if count > 5 {
-		count = 5
-	}
 
 	logger.Info("Fetching Jiandan posts", slog.Int("count", count))
 
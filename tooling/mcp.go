@@ -0,0 +1,103 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"focalors-go/protocol/mcp"
+	"focalors-go/service"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+// OpenAI function names allow letters, digits, "_" and "-" only, up to 64 characters
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// MCPTool adapts a tool of an MCP server, its name is prefixed with the server name
+type MCPTool struct {
+	client *mcp.Client
+	tool   mcp.Tool
+	name   string
+	access service.Access
+}
+
+// NewMCPTools discovers the tools of an MCP server, they are offered to targets with the access only
+func NewMCPTools(ctx context.Context, client *mcp.Client, access service.Access) ([]*MCPTool, error) {
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list tools of mcp server %s: %w", client.Name(), err)
+	}
+	result := make([]*MCPTool, 0, len(tools))
+	for _, tool := range tools {
+		name := invalidToolNameChars.ReplaceAllString(client.Name()+"_"+tool.Name, "_")
+		if len(name) > 64 {
+			name = name[:64]
+		}
+		result = append(result, &MCPTool{client: client, tool: tool, name: name, access: access})
+	}
+	return result, nil
+}
+
+func (m *MCPTool) Name() string {
+	return m.name
+}
+
+func (m *MCPTool) RequiredAccess() service.Access {
+	return m.access
+}
+
+func (m *MCPTool) Definition() openai.FunctionDefinitionParam {
+	parameters := openai.FunctionParameters(m.tool.InputSchema)
+	if parameters == nil {
+		parameters = openai.FunctionParameters{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return openai.FunctionDefinitionParam{
+		Name:        m.name,
+		Description: openai.String(m.tool.Description),
+		Parameters:  parameters,
+	}
+}
+
+func (m *MCPTool) Execute(ctx context.Context, argsJSON string) (*ToolResult, error) {
+	result, err := m.client.CallTool(ctx, m.tool.Name, json.RawMessage(argsJSON))
+	if err != nil {
+		return nil, fmt.Errorf("call mcp tool %s: %w", m.name, err)
+	}
+
+	// texts go back to the model, images are shown to the user
+	var texts []string
+	var images []Content
+	for _, content := range result.Content {
+		switch content.Type {
+		case "text":
+			texts = append(texts, content.Text)
+		case "image":
+			images = append(images, Content{Type: ContentImage, Image: content.Data, AltText: m.tool.Name})
+			texts = append(texts, "[an image shown to the user]")
+		case "resource":
+			if content.Resource == nil {
+				continue
+			}
+			switch {
+			case content.Resource.Text != "":
+				texts = append(texts, content.Resource.Text)
+			case strings.HasPrefix(content.Resource.MimeType, "image/") && content.Resource.Blob != "":
+				images = append(images, Content{Type: ContentImage, Image: content.Resource.Blob, AltText: content.Resource.URI})
+				texts = append(texts, "[an image shown to the user]")
+			default:
+				texts = append(texts, fmt.Sprintf("[resource %s]", content.Resource.URI))
+			}
+		default:
+			logger.Debug("Ignoring mcp content", slog.String("tool", m.name), slog.String("type", content.Type))
+		}
+	}
+
+	text := strings.Join(texts, "\n")
+	if result.IsError {
+		text = "Tool error: " + text
+	}
+	return &ToolResult{Text: text, Contents: images}, nil
+}
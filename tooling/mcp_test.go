@@ -0,0 +1,67 @@
+package tooling
+
+import (
+	"context"
+	"focalors-go/config"
+	"focalors-go/protocol/mcp"
+	"focalors-go/protocol/mcp/mcptest"
+	"focalors-go/service"
+	"testing"
+)
+
+func TestMCPTools(t *testing.T) {
+	server := mcptest.NewHTTPServer(t)
+	client, err := mcp.Connect(context.Background(), &config.MCPServerConfig{Name: "my.server", URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	tools, err := NewMCPTools(context.Background(), client, service.DrawAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*MCPTool)
+	for _, tool := range tools {
+		byName[tool.Name()] = tool
+	}
+
+	tests := []struct {
+		name     string
+		args     string
+		wantText string
+		images   int
+	}{
+		{"my_server_echo", `{"text":"hello"}`, "hello", 0},
+		{"my_server_image", "{}", "[an image shown to the user]", 1},
+		{"my_server_fail", "{}", "Tool error: boom", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, ok := byName[tt.name]
+			if !ok {
+				t.Fatalf("tool %s not discovered, got %v", tt.name, byName)
+			}
+			if tool.RequiredAccess() != service.DrawAccess {
+				t.Errorf("access = %v", tool.RequiredAccess())
+			}
+			if def := tool.Definition(); def.Name != tt.name || def.Parameters["type"] != "object" {
+				t.Errorf("definition = %+v", def)
+			}
+			result, err := tool.Execute(context.Background(), tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Text != tt.wantText || len(result.Contents) != tt.images {
+				t.Errorf("result = %q with %d images, want %q with %d", result.Text, len(result.Contents), tt.wantText, tt.images)
+			}
+			if tt.images > 0 && (result.Contents[0].Type != ContentImage || result.Contents[0].Image != mcptest.Image) {
+				t.Errorf("image = %+v", result.Contents[0])
+			}
+		})
+	}
+
+	echo := byName["my_server_echo"].Definition()
+	if required, _ := echo.Parameters["required"].([]any); len(required) != 1 || required[0] != "text" {
+		t.Errorf("input schema not passed through: %v", echo.Parameters)
+	}
+}
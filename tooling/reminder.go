@@ -0,0 +1,87 @@
+package tooling
+
+import (
+	"context"
+	"fmt"
+	"focalors-go/service"
+	"strings"
+	"time"
+)
+
+// ReminderTool lets the model set, list and cancel reminders of the user asking
+type ReminderTool struct {
+	*TypedTool[reminderArgs]
+	reminders *service.ReminderService
+}
+
+type reminderArgs struct {
+	Action       string `json:"action" description:"add a reminder, list the reminders of the user, or cancel one by id" enum:"add,list,cancel" default:"add"`
+	Text         string `json:"text" description:"What to remind the user of, in the language of the user" max:"200"`
+	Time         string `json:"time" description:"Local time of a one-shot reminder, format 'YYYY-MM-DD HH:MM'"`
+	DelayMinutes int    `json:"delay_minutes" description:"Minutes from now of a one-shot reminder, instead of time" min:"0"`
+	Cron         string `json:"cron" description:"5 field cron spec of a recurring reminder in local time, e.g. '0 8 * * 1-5' for weekdays at 8:00"`
+	Id           string `json:"id" description:"Id of the reminder to cancel"`
+}
+
+func NewReminderTool(reminders *service.ReminderService) *ReminderTool {
+	r := &ReminderTool{reminders: reminders}
+	r.TypedTool = NewTypedTool("reminder",
+		"Remind the user at a time or on a schedule, e.g. 'remind me at 8pm tomorrow to ...'. "+
+			"Give exactly one of time, delay_minutes or cron when adding. The reminder is sent to the current chat.",
+		r.execute)
+	return r
+}
+
+func (r *ReminderTool) execute(ctx context.Context, args reminderArgs) (*ToolResult, error) {
+	target, user := GetTarget(ctx), GetUser(ctx)
+	now := time.Now()
+	switch args.Action {
+	case "list":
+		reminders := r.reminders.List(target, user)
+		if len(reminders) == 0 {
+			return NewToolResult("The user has no reminders"), nil
+		}
+		var text strings.Builder
+		for _, reminder := range reminders {
+			fmt.Fprintf(&text, "id %s, %s: %s\n", reminder.Id, describeReminder(reminder, now), reminder.Text)
+		}
+		return NewToolResult(strings.TrimSpace(text.String())), nil
+	case "cancel":
+		if !r.reminders.Cancel(target, user, args.Id) {
+			return NewToolResult(fmt.Sprintf("No reminder with id %q, list the reminders to find it", args.Id)), nil
+		}
+		return NewToolResult(fmt.Sprintf("Reminder %s cancelled", args.Id)), nil
+	}
+
+	var reminder *service.Reminder
+	var err error
+	switch {
+	case args.Cron != "":
+		reminder, err = service.NewRecurring(args.Cron, args.Text)
+	case args.DelayMinutes > 0:
+		reminder, err = service.NewOnce(now.Add(time.Duration(args.DelayMinutes)*time.Minute), args.Text)
+	case args.Time != "":
+		var at time.Time
+		if at, err = time.ParseInLocation("2006-01-02 15:04", args.Time, now.Location()); err == nil {
+			reminder, err = service.NewOnce(at, args.Text)
+		}
+	default:
+		err = fmt.Errorf("one of time, delay_minutes or cron is required")
+	}
+	if err == nil {
+		err = r.reminders.Add(reminder, target, user, IsGroup(ctx))
+	}
+	if err != nil {
+		// the model may not know the current date
+		return NewToolResult(fmt.Sprintf("Failed to add the reminder: %s (now is %s)", err.Error(), now.Format("2006-01-02 15:04 Monday"))), nil
+	}
+	return NewToolResult(fmt.Sprintf("Reminder %s added, %s. The user can cancel it with #提醒 -d %s",
+		reminder.Id, describeReminder(reminder, now), reminder.Id)), nil
+}
+
+func describeReminder(reminder *service.Reminder, now time.Time) string {
+	if reminder.Recurring() {
+		return fmt.Sprintf("recurring %q, next at %s", reminder.Spec, reminder.Next(now).Format("2006-01-02 15:04"))
+	}
+	return "at " + reminder.At.Format("2006-01-02 15:04 Monday")
+}
@@ -3,7 +3,13 @@ package tooling
 import (
 	"context"
 	"encoding/json"
+	"focalors-go/service"
 	"focalors-go/slogger"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/openai/openai-go"
 )
@@ -13,7 +19,11 @@ var logger = slogger.New("tooling")
 // Context keys for tool execution
 type ctxKey string
 
-const targetKey ctxKey = "target"
+const (
+	targetKey ctxKey = "target"
+	userKey   ctxKey = "user"
+	groupKey  ctxKey = "group"
+)
 
 // WithTarget adds a message target to the context
 func WithTarget(ctx context.Context, target string) context.Context {
@@ -28,6 +38,30 @@ func GetTarget(ctx context.Context) string {
 	return ""
 }
 
+// WithUser adds the id of the user asking to the context
+func WithUser(ctx context.Context, userId string) context.Context {
+	return context.WithValue(ctx, userKey, userId)
+}
+
+// GetUser retrieves the id of the user asking from context
+func GetUser(ctx context.Context) string {
+	if v, ok := ctx.Value(userKey).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// WithGroup marks whether the conversation is a group chat
+func WithGroup(ctx context.Context, isGroup bool) context.Context {
+	return context.WithValue(ctx, groupKey, isGroup)
+}
+
+// IsGroup reports whether the conversation is a group chat
+func IsGroup(ctx context.Context) bool {
+	isGroup, _ := ctx.Value(groupKey).(bool)
+	return isGroup
+}
+
 // ContentType represents the type of content in a tool result
 type ContentType int
 
@@ -80,33 +114,84 @@ type Tool interface {
 	Execute(ctx context.Context, argsJSON string) (*ToolResult, error)
 }
 
-// Registry holds all registered tools
+// AccessRequirer is implemented by tools only offered to targets with the access
+type AccessRequirer interface {
+	RequiredAccess() service.Access
+}
+
+// RequiredAccess returns the access a tool requires, 0 if none
+func RequiredAccess(tool Tool) service.Access {
+	if r, ok := tool.(AccessRequirer); ok {
+		return r.RequiredAccess()
+	}
+	return 0
+}
+
+// Registry holds all registered tools and decides which of them a conversation may use, based on
+// the access of its target and the tool switches set by admins. Tools may be registered while
+// messages are already handled, e.g. when MCP servers start up.
 type Registry struct {
-	tools map[string]Tool
+	mu      sync.RWMutex
+	tools   map[string]Tool
+	access  *service.AccessService
+	toggles *service.ToolToggleService
 }
 
 // NewRegistry creates a new tool registry
-func NewRegistry() *Registry {
+func NewRegistry(access *service.AccessService, toggles *service.ToolToggleService) *Registry {
 	return &Registry{
-		tools: make(map[string]Tool),
+		tools:   make(map[string]Tool),
+		access:  access,
+		toggles: toggles,
 	}
 }
 
 // Register adds a tool to the registry
 func (r *Registry) Register(tool Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.tools[tool.Name()] = tool
 }
 
 // Get returns a tool by name
 func (r *Registry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	tool, ok := r.tools[name]
 	return tool, ok
 }
 
-// Definitions returns all tool definitions for OpenAI
-func (r *Registry) Definitions() []openai.ChatCompletionToolParam {
+// Tools returns all registered tools sorted by name
+func (r *Registry) Tools() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.SortedFunc(maps.Values(r.tools), func(a, b Tool) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+}
+
+// Allowed reports whether the conversation in ctx may use the tool
+func (r *Registry) Allowed(ctx context.Context, tool Tool) bool {
+	target := GetTarget(ctx)
+	if required := RequiredAccess(tool); required != 0 {
+		if ok, err := r.access.HasAccess(target, required); err != nil || !ok {
+			return false
+		}
+	}
+	enabled, err := r.toggles.Enabled(target, IsGroup(ctx), tool.Name())
+	if err != nil {
+		logger.Warn("Failed to resolve tool switch", slog.String("tool", tool.Name()), slog.Any("error", err))
+	}
+	return enabled
+}
+
+// Definitions returns the definitions of the tools the conversation in ctx may use
+func (r *Registry) Definitions(ctx context.Context) []openai.ChatCompletionToolParam {
 	var defs []openai.ChatCompletionToolParam
-	for _, tool := range r.tools {
+	for _, tool := range r.Tools() {
+		if !r.Allowed(ctx, tool) {
+			continue
+		}
 		defs = append(defs, openai.ChatCompletionToolParam{
 			Function: tool.Definition(),
 		})
@@ -116,11 +201,19 @@ func (r *Registry) Definitions() []openai.ChatCompletionToolParam {
 
 // Execute runs a tool by name with the given arguments
 func (r *Registry) Execute(ctx context.Context, name string, argsJSON string) (*ToolResult, error) {
-	tool, ok := r.tools[name]
+	tool, ok := r.Get(name)
 	if !ok {
 		return &ToolResult{Text: "Unknown tool"}, nil
 	}
+	// the model may call tools it was not offered
+	if !r.Allowed(ctx, tool) {
+		return &ToolResult{Text: "This tool is not available in this chat"}, nil
+	}
 	result, err := tool.Execute(ctx, argsJSON)
+	if result == nil {
+		// a tool may return nothing, the model still needs an answer to its call
+		result = &ToolResult{}
+	}
 	if err != nil {
 		return result, err
 	}
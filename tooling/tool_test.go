@@ -0,0 +1,93 @@
+package tooling
+
+import (
+	"context"
+	"errors"
+	"focalors-go/db"
+	"focalors-go/service"
+	"testing"
+)
+
+func newTestRegistry(kv db.KV) *Registry {
+	return NewRegistry(service.NewAccessService(kv, nil), service.NewToolToggleService(kv))
+}
+
+func TestRegistryExecute(t *testing.T) {
+	r := newTestRegistry(db.NewMemoryKV())
+	r.Register(NewTypedTool("empty", "Returns nothing", func(ctx context.Context, args struct{}) (*ToolResult, error) {
+		return nil, nil
+	}))
+	r.Register(NewTypedTool("broken", "Fails without a result", func(ctx context.Context, args struct{}) (*ToolResult, error) {
+		return nil, errors.New("boom")
+	}))
+	r.Register(NewTypedTool("draw", "Draws", func(ctx context.Context, args struct{}) (*ToolResult, error) {
+		return NewToolResult("drawn").AddImage("aW1n", "cat"), nil
+	}))
+	ctx := WithTarget(context.Background(), "u1")
+
+	result, err := r.Execute(ctx, "empty", "{}")
+	if err != nil || result == nil || result.Text != "" || len(result.Contents) != 0 {
+		t.Errorf("empty = %+v, %v, want an empty result", result, err)
+	}
+	if result, err := r.Execute(ctx, "broken", "{}"); err == nil || result == nil {
+		t.Errorf("broken = %+v, %v, want an empty result with the error", result, err)
+	}
+	result, err = r.Execute(ctx, "draw", "{}")
+	if err != nil || len(result.Contents) != 1 || result.Contents[0].ToolName != "draw" {
+		t.Errorf("draw = %+v, %v, want the contents tagged with the tool", result, err)
+	}
+	if result, _ := r.Execute(ctx, "missing", "{}"); result.Text != "Unknown tool" {
+		t.Errorf("missing = %q", result.Text)
+	}
+}
+
+func TestRegistryAllowed(t *testing.T) {
+	kv := db.NewMemoryKV()
+	r := newTestRegistry(kv)
+	toggles := service.NewToolToggleService(kv)
+	noop := func(ctx context.Context, args struct{}) (*ToolResult, error) { return NewToolResult("done"), nil }
+	chat := NewTypedTool("chat", "Chats", noop)
+	draw := NewTypedTool("draw", "Draws", noop).WithAccess(service.DrawAccess)
+	r.Register(chat)
+	r.Register(draw)
+	kv.Set("access:g1", "2", 0) // draw
+
+	group := func(id string) context.Context { return WithGroup(WithTarget(context.Background(), id), true) }
+	private := WithTarget(context.Background(), "u1")
+	toggles.Set(service.ToolScopeGroups, "chat", false)
+	toggles.Set("g2", "chat", true)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		tool Tool
+		want bool
+	}{
+		{"scope switched off", group("g1"), chat, false},
+		{"chat switched on", group("g2"), chat, true},
+		{"other scope", private, chat, true},
+		{"access granted", group("g1"), draw, true},
+		{"access missing", private, draw, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Allowed(tt.ctx, tt.tool); got != tt.want {
+				t.Errorf("Allowed = %v, want %v", got, tt.want)
+			}
+			offered := false
+			for _, def := range r.Definitions(tt.ctx) {
+				offered = offered || def.Function.Name == tt.tool.Name()
+			}
+			if offered != tt.want {
+				t.Errorf("offered = %v, want %v", offered, tt.want)
+			}
+			result, err := r.Execute(tt.ctx, tt.tool.Name(), "{}")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refused := result.Text != "done"; refused == tt.want {
+				t.Errorf("executed = %v, want %v", !refused, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"focalors-go/service"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/openai/openai-go"
+)
+
+// TypedTool is a Tool whose parameters are the fields of the struct Args. The JSON schema is derived
+// from the field tags, and the arguments are validated against them before execute runs:
+//
+//	type forecastArgs struct {
+//		City  string `json:"city" description:"City name in Chinese" required:"true"`
+//		Days  int    `json:"days" description:"Days to forecast" min:"1" max:"4" default:"1"`
+//		Units string `json:"units" enum:"metric,imperial"`
+//	}
+//
+// min and max bound numbers, the length of strings and the number of items of slices.
+// Invalid arguments are returned to the model as a tool error.
+type TypedTool[Args any] struct {
+	name        string
+	description string
+	params      []param
+	schema      openai.FunctionParameters
+	execute     func(ctx context.Context, args Args) (*ToolResult, error)
+	access      service.Access
+}
+
+// param is a top level field of Args with its constraints
+type param struct {
+	index    int
+	name     string
+	kind     reflect.Kind
+	required bool
+	enum     []any
+	min, max *float64
+	def      any
+}
+
+// NewTypedTool creates a tool from the Args struct, it panics on invalid tags
+func NewTypedTool[Args any](name, description string, execute func(ctx context.Context, args Args) (*ToolResult, error)) *TypedTool[Args] {
+	t := reflect.TypeFor[Args]()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("tool %s: args must be a struct, got %s", name, t))
+	}
+	params, schema, err := objectSchema(t)
+	if err != nil {
+		panic(fmt.Sprintf("tool %s: %s", name, err))
+	}
+	return &TypedTool[Args]{
+		name:        name,
+		description: description,
+		params:      params,
+		schema:      schema,
+		execute:     execute,
+	}
+}
+
+// WithAccess offers the tool only to targets with the access
+func (t *TypedTool[Args]) WithAccess(access service.Access) *TypedTool[Args] {
+	t.access = access
+	return t
+}
+
+func (t *TypedTool[Args]) RequiredAccess() service.Access {
+	return t.access
+}
+
+func (t *TypedTool[Args]) Name() string {
+	return t.name
+}
+
+func (t *TypedTool[Args]) Definition() openai.FunctionDefinitionParam {
+	return openai.FunctionDefinitionParam{
+		Name:        t.name,
+		Description: openai.String(t.description),
+		Parameters:  t.schema,
+	}
+}
+
+func (t *TypedTool[Args]) Execute(ctx context.Context, argsJSON string) (*ToolResult, error) {
+	args, err := t.parse(argsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	return t.execute(ctx, args)
+}
+
+// parse decodes the arguments, fills the defaults and checks the constraints
+func (t *TypedTool[Args]) parse(argsJSON string) (Args, error) {
+	var args Args
+	if strings.TrimSpace(argsJSON) == "" {
+		argsJSON = "{}"
+	}
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(argsJSON), &present); err != nil {
+		return args, err
+	}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return args, err
+	}
+
+	value := reflect.ValueOf(&args).Elem()
+	for _, p := range t.params {
+		field := value.Field(p.index)
+		if raw, ok := present[p.name]; !ok || string(raw) == "null" {
+			if p.required {
+				return args, fmt.Errorf("%s is required", p.name)
+			}
+			if p.def != nil {
+				setDefault(field, p.def)
+			}
+			continue
+		}
+		if err := p.check(field); err != nil {
+			return args, err
+		}
+	}
+	return args, nil
+}
+
+func setDefault(field reflect.Value, def any) {
+	v := reflect.ValueOf(def)
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(field.Type().Elem())
+		ptr.Elem().Set(v.Convert(field.Type().Elem()))
+		field.Set(ptr)
+		return
+	}
+	field.Set(v.Convert(field.Type()))
+}
+
+func (p *param) check(field reflect.Value) error {
+	for field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return nil
+		}
+		field = field.Elem()
+	}
+	if len(p.enum) > 0 && !slices.ContainsFunc(p.enum, func(v any) bool {
+		return reflect.ValueOf(v).Convert(field.Type()).Equal(field)
+	}) {
+		return fmt.Errorf("%s must be one of %v", p.name, p.enum)
+	}
+
+	var size float64
+	var unit string
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = field.Float()
+	case reflect.String:
+		size, unit = float64(utf8.RuneCountInString(field.String())), " characters"
+	case reflect.Slice, reflect.Array:
+		size, unit = float64(field.Len()), " items"
+	default:
+		return nil
+	}
+	if p.min != nil && size < *p.min {
+		return fmt.Errorf("%s must be at least %v%s", p.name, *p.min, unit)
+	}
+	if p.max != nil && size > *p.max {
+		return fmt.Errorf("%s must be at most %v%s", p.name, *p.max, unit)
+	}
+	return nil
+}
+
+// objectSchema describes the exported fields of a struct
+func objectSchema(t reflect.Type) ([]param, map[string]any, error) {
+	properties := map[string]any{}
+	var required []string
+	var params []param
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		p, schema, err := fieldSchema(f, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		p.index = i
+		params = append(params, p)
+		properties[name] = schema
+		if p.required {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return params, schema, nil
+}
+
+func fieldSchema(f reflect.StructField, name string) (param, map[string]any, error) {
+	p := param{name: name, required: f.Tag.Get("required") == "true"}
+	t := f.Type
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	p.kind = t.Kind()
+	schema, err := typeSchema(t)
+	if err != nil {
+		return p, nil, err
+	}
+	if description := f.Tag.Get("description"); description != "" {
+		schema["description"] = description
+	}
+
+	if enum := f.Tag.Get("enum"); enum != "" {
+		for _, raw := range strings.Split(enum, ",") {
+			v, err := parseTagValue(t, strings.TrimSpace(raw))
+			if err != nil {
+				return p, nil, fmt.Errorf("enum: %w", err)
+			}
+			p.enum = append(p.enum, v)
+		}
+		schema["enum"] = p.enum
+	}
+	if def := f.Tag.Get("default"); def != "" {
+		v, err := parseTagValue(t, def)
+		if err != nil {
+			return p, nil, fmt.Errorf("default: %w", err)
+		}
+		p.def = v
+		schema["default"] = v
+	}
+
+	minKey, maxKey := "minimum", "maximum"
+	switch p.kind {
+	case reflect.String:
+		minKey, maxKey = "minLength", "maxLength"
+	case reflect.Slice, reflect.Array:
+		minKey, maxKey = "minItems", "maxItems"
+	}
+	for _, bound := range []struct {
+		tag, key string
+		dst      **float64
+	}{{"min", minKey, &p.min}, {"max", maxKey, &p.max}} {
+		raw := f.Tag.Get(bound.tag)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return p, nil, fmt.Errorf("%s: %w", bound.tag, err)
+		}
+		*bound.dst = &v
+		schema[bound.key] = v
+	}
+	return p, schema, nil
+}
+
+func typeSchema(t reflect.Type) (map[string]any, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		_, schema, err := objectSchema(t)
+		return schema, err
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// parseTagValue converts an enum or default tag value to the type of the field
+func parseTagValue(t reflect.Type, raw string) (any, error) {
+	if t.Kind() == reflect.String {
+		return raw, nil
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal([]byte(raw), v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
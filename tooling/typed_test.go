@@ -0,0 +1,149 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type nested struct {
+	Lat float64 `json:"lat" required:"true"`
+}
+
+type typedArgs struct {
+	City    string   `json:"city" description:"City name" required:"true" min:"1" max:"4"`
+	Days    int      `json:"days" min:"1" max:"4" default:"1"`
+	Units   string   `json:"units,omitempty" enum:"metric, imperial" default:"metric"`
+	Tags    []string `json:"tags" max:"2"`
+	Hourly  *bool    `json:"hourly"`
+	Limit   *int     `json:"limit" default:"3"`
+	Level   int      `json:"level" enum:"1,2"`
+	Where   *nested  `json:"where"`
+	Ignored string   `json:"-"`
+	hidden  string
+	Plain   bool
+}
+
+func TestTypedToolSchema(t *testing.T) {
+	tool := NewTypedTool("forecast", "Forecast", func(ctx context.Context, args typedArgs) (*ToolResult, error) {
+		return nil, nil
+	})
+	schema := tool.Definition().Parameters
+	if schema["type"] != "object" {
+		t.Errorf("type = %v", schema["type"])
+	}
+	if required, _ := json.Marshal(schema["required"]); string(required) != `["city"]` {
+		t.Errorf("required = %s", required)
+	}
+	properties := schema["properties"].(map[string]any)
+	tests := []struct {
+		property string
+		want     string
+	}{
+		{"city", `{"description":"City name","maxLength":4,"minLength":1,"type":"string"}`},
+		{"days", `{"default":1,"maximum":4,"minimum":1,"type":"integer"}`},
+		{"units", `{"default":"metric","enum":["metric","imperial"],"type":"string"}`},
+		{"tags", `{"items":{"type":"string"},"maxItems":2,"type":"array"}`},
+		{"hourly", `{"type":"boolean"}`},
+		{"limit", `{"default":3,"type":"integer"}`},
+		{"level", `{"enum":[1,2],"type":"integer"}`},
+		{"where", `{"properties":{"lat":{"type":"number"}},"required":["lat"],"type":"object"}`},
+		{"Plain", `{"type":"boolean"}`},
+	}
+	for _, tt := range tests {
+		raw, _ := json.Marshal(properties[tt.property])
+		if string(raw) != tt.want {
+			t.Errorf("%s = %s, want %s", tt.property, raw, tt.want)
+		}
+	}
+	if len(properties) != len(tests) {
+		t.Errorf("properties = %v, want ignored and unexported fields left out", properties)
+	}
+}
+
+func TestTypedToolParse(t *testing.T) {
+	tool := NewTypedTool("forecast", "Forecast", func(ctx context.Context, args typedArgs) (*ToolResult, error) {
+		return nil, nil
+	})
+	tests := []struct {
+		name    string
+		args    string
+		wantErr string
+		check   func(args typedArgs) bool
+	}{
+		{"defaults", `{"city":"北京"}`, "", func(a typedArgs) bool {
+			return a.Days == 1 && a.Units == "metric" && a.Limit != nil && *a.Limit == 3 && a.Hourly == nil
+		}},
+		{"explicit values", `{"city":"上海","days":4,"units":"imperial","limit":0,"hourly":true}`, "", func(a typedArgs) bool {
+			return a.Days == 4 && a.Units == "imperial" && *a.Limit == 0 && *a.Hourly
+		}},
+		{"null means missing", `{"city":"北京","days":null}`, "", func(a typedArgs) bool { return a.Days == 1 }},
+		{"missing required", `{}`, "city is required", nil},
+		{"empty arguments", ``, "city is required", nil},
+		{"string counted in runes", `{"city":"乌鲁木齐市"}`, "city must be at most 4 characters", nil},
+		{"below minimum", `{"city":"北京","days":0}`, "days must be at least 1", nil},
+		{"above maximum", `{"city":"北京","days":5}`, "days must be at most 4", nil},
+		{"too many items", `{"city":"北京","tags":["a","b","c"]}`, "tags must be at most 2 items", nil},
+		{"not in string enum", `{"city":"北京","units":"kelvin"}`, "units must be one of", nil},
+		{"not in integer enum", `{"city":"北京","level":3}`, "level must be one of", nil},
+		{"wrong type", `{"city":1}`, "cannot unmarshal", nil},
+		{"not an object", `[]`, "cannot unmarshal", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := tool.parse(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(args) {
+				t.Errorf("args = %+v", args)
+			}
+		})
+	}
+}
+
+func TestTypedToolInvalidTags(t *testing.T) {
+	tests := []struct {
+		name string
+		new  func()
+	}{
+		{"not a struct", func() {
+			NewTypedTool("t", "", func(ctx context.Context, args string) (*ToolResult, error) { return nil, nil })
+		}},
+		{"bad default", func() {
+			type args struct {
+				N int `json:"n" default:"x"`
+			}
+			NewTypedTool("t", "", func(ctx context.Context, a args) (*ToolResult, error) { return nil, nil })
+		}},
+		{"bad bound", func() {
+			type args struct {
+				N int `json:"n" min:"one"`
+			}
+			NewTypedTool("t", "", func(ctx context.Context, a args) (*ToolResult, error) { return nil, nil })
+		}},
+		{"unsupported type", func() {
+			type args struct {
+				M map[string]string `json:"m"`
+			}
+			NewTypedTool("t", "", func(ctx context.Context, a args) (*ToolResult, error) { return nil, nil })
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("NewTypedTool should panic")
+				}
+			}()
+			tt.new()
+		})
+	}
+}
@@ -5,53 +5,33 @@ import (
 	"fmt"
 	"focalors-go/service"
 	"log/slog"
-
-	"github.com/openai/openai-go"
+	"strings"
 )
 
 // WeatherTool provides weather information
 type WeatherTool struct {
+	*TypedTool[weatherArgs]
 	weather *service.WeatherService
 }
 
 type weatherArgs struct {
-	Location string `json:"location"`
+	Location string `json:"location" description:"City or district name in Chinese, e.g. 北京, 深圳, 南山区" required:"true"`
+	Days     int    `json:"days" description:"Days to forecast starting today, e.g. 3 to answer questions about the weekend; 0 for the current weather only" min:"0" max:"4" default:"0"`
 }
 
 // NewWeatherTool creates a new weather tool
 func NewWeatherTool(weather *service.WeatherService) *WeatherTool {
-	return &WeatherTool{weather: weather}
-}
-
-func (w *WeatherTool) Name() string {
-	return "get_weather"
-}
-
-func (w *WeatherTool) Definition() openai.FunctionDefinitionParam {
-	return openai.FunctionDefinitionParam{
-		Name:        "get_weather",
-		Description: openai.String("Get current weather at the given location in China"),
-		Parameters: openai.FunctionParameters{
-			"type": "object",
-			"properties": map[string]interface{}{
-				"location": map[string]string{
-					"type":        "string",
-					"description": "City or district name in Chinese, e.g. 北京, 深圳, 南山区",
-				},
-			},
-			"required": []string{"location"},
-		},
-	}
+	w := &WeatherTool{weather: weather}
+	w.TypedTool = NewTypedTool("get_weather", "Get the current weather, or the forecast of up to 4 days, at the given location in China", w.execute)
+	return w
 }
 
-func (w *WeatherTool) Execute(ctx context.Context, argsJSON string) (*ToolResult, error) {
-	args, err := ParseArgs[weatherArgs](argsJSON)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse weather args: %w", err)
+func (w *WeatherTool) execute(ctx context.Context, args weatherArgs) (*ToolResult, error) {
+	logger.Info("Getting weather data", slog.String("location", args.Location), slog.Int("days", args.Days))
+	if args.Days > 0 {
+		return w.forecast(ctx, args)
 	}
 
-	logger.Info("Getting weather data", slog.String("location", args.Location))
-
 	weatherLives, err := w.weather.GetWeather(ctx, args.Location)
 	if err != nil {
 		logger.Error("Failed to get weather data", slog.String("location", args.Location), slog.Any("error", err))
@@ -73,3 +53,29 @@ func (w *WeatherTool) Execute(ctx context.Context, argsJSON string) (*ToolResult
 	)
 	return NewToolResult(text), nil
 }
+
+func (w *WeatherTool) forecast(ctx context.Context, args weatherArgs) (*ToolResult, error) {
+	forecasts, err := w.weather.GetForecast(ctx, args.Location)
+	if err != nil {
+		logger.Error("Failed to get weather forecast", slog.String("location", args.Location), slog.Any("error", err))
+		return NewToolResult("Failed to get weather forecast"), nil
+	}
+	if len(forecasts) == 0 || len(forecasts[0].Casts) == 0 {
+		return NewToolResult(fmt.Sprintf("No weather forecast found for %s", args.Location)), nil
+	}
+
+	forecast := forecasts[0]
+	lines := []string{fmt.Sprintf("%s %s 天气预报 (发布于 %s):", forecast.Province, forecast.City, forecast.ReportTime)}
+	for i, cast := range forecast.Casts {
+		if i >= args.Days {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: 白天%s, 夜间%s, 气温 %s~%s°C, 白天%s风%s级, 夜间%s风%s级",
+			cast.Date, cast.Weekday(),
+			cast.DayWeather, cast.NightWeather,
+			cast.NightTemp, cast.DayTemp,
+			cast.DayWind, cast.DayPower, cast.NightWind, cast.NightPower,
+		))
+	}
+	return NewToolResult(strings.Join(lines, "\n")), nil
+}